@@ -0,0 +1,182 @@
+package scyllacdc
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/gocql/gocql"
+)
+
+// AsyncChangeConsumer is an extension to the ChangeConsumer interface.
+// It allows the consumer to process changes asynchronously - for example,
+// to pipeline them to a slow downstream system - without blocking
+// the reader.
+//
+// If a consumer implements this interface, the library calls ConsumeAsync
+// instead of Consume. The library itself saves progress of the stream
+// through the ProgressManager: it is advanced up to the last change such
+// that it and all earlier changes in the stream were acknowledged.
+// This gives at-least-once delivery without additional bookkeeping
+// in the consumer.
+//
+// At most AdvancedReaderConfig.MaxInFlightChanges changes of a stream
+// can be unacknowledged at once. If that limit is reached, the library
+// stops fetching changes for the stream until some of them are acknowledged.
+type AsyncChangeConsumer interface {
+	ChangeConsumer
+
+	// ConsumeAsync hands a change over to the consumer. This method is called
+	// in a sequential manner for each change that appears in the stream,
+	// and it should return quickly. After the change is processed, the consumer
+	// must call Ack or Fail on the ack handle, possibly from another goroutine.
+	// The consumer must not wait for further changes or for the End call before
+	// acknowledging a change.
+	//
+	// If this method returns an error, the library will stop with an error.
+	ConsumeAsync(ctx context.Context, change Change, ack *ChangeAck) error
+}
+
+// ChangeAck is a handle used by an AsyncChangeConsumer to acknowledge that
+// processing of a change has finished. Exactly one of its methods should
+// be called, once.
+type ChangeAck struct {
+	tracker *ackTracker
+	entry   *ackEntry
+	once    sync.Once
+}
+
+// Ack marks the change as successfully processed.
+func (ca *ChangeAck) Ack() {
+	ca.once.Do(func() {
+		ca.tracker.ack(ca.entry)
+	})
+}
+
+// Fail reports that the change could not be processed. The library will stop
+// with the given error, and the progress will not be advanced past the change.
+func (ca *ChangeAck) Fail(err error) {
+	if err == nil {
+		err = errors.New("change processing failed")
+	}
+	ca.once.Do(func() {
+		ca.tracker.failure.fail(err)
+	})
+}
+
+// Shared by all ack trackers of a stream batch reader. The channel is closed
+// after the first failure, so that the reader can stop right away.
+type asyncFailure struct {
+	once sync.Once
+	ch   chan struct{}
+	err  error
+}
+
+func newAsyncFailure() *asyncFailure {
+	return &asyncFailure{ch: make(chan struct{})}
+}
+
+func (af *asyncFailure) fail(err error) {
+	af.once.Do(func() {
+		af.err = err
+		close(af.ch)
+	})
+}
+
+type ackEntry struct {
+	time gocql.UUID
+	done bool
+}
+
+// ackTracker keeps track of changes of a single stream which were handed
+// over to an AsyncChangeConsumer, and reports progress up to the last change
+// which was acknowledged along with all the previous ones.
+type ackTracker struct {
+	consumer AsyncChangeConsumer
+	reporter *PeriodicProgressReporter
+	failure  *asyncFailure
+
+	// Each unacknowledged change occupies a slot
+	slots chan struct{}
+
+	mu sync.Mutex
+	// Changes and window ends in the order they were handed over
+	pending []*ackEntry
+}
+
+func newAckTracker(
+	consumer AsyncChangeConsumer,
+	reporter *PeriodicProgressReporter,
+	failure *asyncFailure,
+	maxInFlight int,
+) *ackTracker {
+	return &ackTracker{
+		consumer: consumer,
+		reporter: reporter,
+		failure:  failure,
+
+		slots: make(chan struct{}, maxInFlight),
+	}
+}
+
+func (at *ackTracker) consume(ctx context.Context, change Change) error {
+	select {
+	case at.slots <- struct{}{}:
+	case <-at.failure.ch:
+		return at.failure.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	entry := &ackEntry{time: change.Time}
+	at.mu.Lock()
+	at.pending = append(at.pending, entry)
+	at.mu.Unlock()
+
+	return at.consumer.ConsumeAsync(ctx, change, &ChangeAck{
+		tracker: at,
+		entry:   entry,
+	})
+}
+
+// Marks that there are no more changes in the stream up to given point.
+// The progress will be advanced to this point after all changes handed
+// over before are acknowledged.
+func (at *ackTracker) advanceTo(point gocql.UUID) {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+
+	if len(at.pending) > 0 {
+		last := at.pending[len(at.pending)-1]
+		if last.done {
+			// Not a change, but a previous window end which was not
+			// reported yet - just move it forward
+			last.time = point
+			return
+		}
+	}
+
+	at.pending = append(at.pending, &ackEntry{time: point, done: true})
+	at.reportContiguous()
+}
+
+func (at *ackTracker) ack(entry *ackEntry) {
+	at.mu.Lock()
+	entry.done = true
+	at.reportContiguous()
+	at.mu.Unlock()
+
+	<-at.slots
+}
+
+// Must be called with the mutex held.
+func (at *ackTracker) reportContiguous() {
+	var last *ackEntry
+	for len(at.pending) > 0 && at.pending[0].done {
+		last = at.pending[0]
+		at.pending = at.pending[1:]
+	}
+	if last != nil {
+		at.reporter.Update(last.time)
+	}
+}
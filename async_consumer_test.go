@@ -0,0 +1,180 @@
+package scyllacdc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Acknowledges changes asynchronously, skipping those with given times.
+type ackingConsumer struct {
+	mu       *sync.Mutex
+	consumed []gocql.UUID
+	skip     map[gocql.UUID]bool
+	wg       *sync.WaitGroup
+}
+
+func (ac *ackingConsumer) CreateChangeConsumer(ctx context.Context, input CreateChangeConsumerInput) (ChangeConsumer, error) {
+	return ac, nil
+}
+
+func (ac *ackingConsumer) Consume(ctx context.Context, change Change) error {
+	panic("Consume should not be called for an AsyncChangeConsumer")
+}
+
+func (ac *ackingConsumer) ConsumeAsync(ctx context.Context, change Change, ack *ChangeAck) error {
+	ac.mu.Lock()
+	ac.consumed = append(ac.consumed, change.Time)
+	ac.mu.Unlock()
+
+	if ac.skip[change.Time] {
+		return nil
+	}
+
+	ac.wg.Add(1)
+	go func() {
+		defer ac.wg.Done()
+		time.Sleep(10 * time.Millisecond)
+		ack.Ack()
+	}()
+	return nil
+}
+
+func (ac *ackingConsumer) End() error {
+	ac.wg.Wait()
+	return nil
+}
+
+func (ac *ackingConsumer) getConsumedCount() int {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	return len(ac.consumed)
+}
+
+var _ AsyncChangeConsumer = (*ackingConsumer)(nil)
+
+func runAsyncConsumerTest(t *testing.T, skipSecond bool) (times []gocql.UUID, saved Progress) {
+	now := time.Now()
+	streamID := StreamID{0x0A}
+
+	ds := NewInMemoryDataSource()
+	ds.AddGeneration(now.Add(-time.Hour), []StreamID{streamID})
+	newTestInMemoryTable(t, ds, "tbl")
+
+	for i := 0; i < 3; i++ {
+		times = append(times, addTestUpdate(t, ds, "tbl", streamID, now.Add(-time.Duration(90-10*i)*time.Second), 1, i))
+	}
+
+	consumer := &ackingConsumer{
+		mu:   &sync.Mutex{},
+		skip: make(map[gocql.UUID]bool),
+		wg:   &sync.WaitGroup{},
+	}
+	if skipSecond {
+		consumer.skip[times[1]] = true
+	}
+
+	progressManager := NewInMemoryProgressManager()
+	adv := testAdvancedConfig
+	adv.MaxInFlightChanges = 2
+	cfg := &ReaderConfig{
+		DataSource:            ds,
+		ChangeConsumerFactory: consumer,
+		TableNames:            []string{"ks.tbl"},
+		ProgressManager:       progressManager,
+		Advanced:              adv,
+	}
+
+	reader, err := NewReader(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errC := make(chan error)
+	go func() { errC <- reader.Run(context.Background()) }()
+
+	waitFor(t, 5*time.Second, func() bool {
+		return consumer.getConsumedCount() == len(times)
+	})
+
+	reader.StopAt(time.Now())
+	if err := <-errC; err != nil {
+		t.Fatal(err)
+	}
+
+	saved, _ = progressManager.GetSavedProgress(now.Add(-time.Hour), "ks.tbl", streamID)
+	return times, saved
+}
+
+func TestAsyncConsumerSavesAcknowledgedProgress(t *testing.T) {
+	times, saved := runAsyncConsumerTest(t, false)
+	if compareTimeuuid(saved.LastProcessedRecordTime, times[len(times)-1]) < 0 {
+		t.Errorf("expected progress to be saved past %s, got %s", times[len(times)-1].Time(), saved.LastProcessedRecordTime.Time())
+	}
+}
+
+func TestAsyncConsumerDoesNotSkipUnacknowledgedChanges(t *testing.T) {
+	times, saved := runAsyncConsumerTest(t, true)
+
+	// The second change was never acknowledged, so the progress
+	// must stop right before it
+	if saved.LastProcessedRecordTime != times[0] {
+		t.Errorf("expected progress to be saved at %s, got %s", times[0].Time(), saved.LastProcessedRecordTime.Time())
+	}
+}
+
+type failingSaveProgressManager struct {
+	noProgressManager
+}
+
+func (fspm failingSaveProgressManager) SaveProgress(ctx context.Context, gen time.Time, table string, streamID StreamID, progress Progress) error {
+	return errors.New("failed to save progress")
+}
+
+func TestAsyncConsumerReportsFailedFinalSave(t *testing.T) {
+	now := time.Now()
+	streamID := StreamID{0x0A}
+
+	ds := NewInMemoryDataSource()
+	ds.AddGeneration(now.Add(-time.Hour), []StreamID{streamID})
+	newTestInMemoryTable(t, ds, "tbl")
+	addTestUpdate(t, ds, "tbl", streamID, now.Add(-90*time.Second), 1, 1)
+
+	consumer := &ackingConsumer{
+		mu:   &sync.Mutex{},
+		skip: make(map[gocql.UUID]bool),
+		wg:   &sync.WaitGroup{},
+	}
+
+	// Only the final save happens during the test
+	adv := testAdvancedConfig
+	adv.AsyncProgressSaveInterval = time.Hour
+	cfg := &ReaderConfig{
+		DataSource:            ds,
+		ChangeConsumerFactory: consumer,
+		TableNames:            []string{"ks.tbl"},
+		ProgressManager:       failingSaveProgressManager{},
+		Advanced:              adv,
+	}
+
+	reader, err := NewReader(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errC := make(chan error)
+	go func() { errC <- reader.Run(context.Background()) }()
+
+	waitFor(t, 5*time.Second, func() bool {
+		return consumer.getConsumedCount() == 1
+	})
+
+	reader.StopAt(time.Now())
+	if err := <-errC; err == nil {
+		t.Error("expected the failed save of the final progress to be reported")
+	}
+}
@@ -2,6 +2,7 @@ package scyllacdc
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"reflect"
 	"strconv"
@@ -122,7 +123,8 @@ type ChangeRow struct {
 	data     []interface{}
 	colInfos []gocql.ColumnInfo
 
-	cdcCols cdcChangeRowCols
+	batchCols cdcChangeBatchCols
+	cdcCols   cdcChangeRowCols
 }
 
 // Contains columns specific to a change row batch (rows which have
@@ -555,7 +557,7 @@ func newChangeRowQuerier(session *gocql.Session, streams []StreamID, keyspaceNam
 	}
 }
 
-func (crq *changeRowQuerier) queryRange(start, end gocql.UUID) (*changeRowIterator, error) {
+func (crq *changeRowQuerier) queryRange(ctx context.Context, start, end gocql.UUID, projection []string) (*changeRowIterator, error) {
 	// We need metadata to check if there are any tuples
 	kmeta, err := crq.session.KeyspaceMetadata(crq.keyspaceName)
 	if err != nil {
@@ -567,9 +569,14 @@ func (crq *changeRowQuerier) queryRange(start, end gocql.UUID) (*changeRowIterat
 		return nil, fmt.Errorf("no such table: %s.%s", crq.keyspaceName, crq.tableName)
 	}
 
+	projectedCols := makeColumnSet(projection)
+
 	var colNames []string
 	var tupleNames []string
 	for _, col := range tmeta.Columns {
+		if !isLogColumnProjected(col.Name, projectedCols) {
+			continue
+		}
 		var ct interface{} = col.Type
 		var ctStr string
 		switch ct := ct.(type) {
@@ -584,11 +591,13 @@ func (crq *changeRowQuerier) queryRange(start, end gocql.UUID) (*changeRowIterat
 		}
 	}
 
-	if len(tupleNames) == 0 {
+	if len(tupleNames) == 0 && projectedCols == nil {
 		colNames = []string{"*"}
 	} else {
 		for name := range tmeta.Columns {
-			colNames = append(colNames, escapeColumnNameIfNeeded(name))
+			if isLogColumnProjected(name, projectedCols) {
+				colNames = append(colNames, escapeColumnNameIfNeeded(name))
+			}
 		}
 	}
 
@@ -604,7 +613,7 @@ func (crq *changeRowQuerier) queryRange(start, end gocql.UUID) (*changeRowIterat
 	crq.bindArgs[len(crq.bindArgs)-2] = start
 	crq.bindArgs[len(crq.bindArgs)-1] = end
 
-	iter := crq.session.Query(queryStr, crq.bindArgs...).Consistency(crq.consistency).Iter()
+	iter := crq.session.Query(queryStr, crq.bindArgs...).WithContext(ctx).Consistency(crq.consistency).Iter()
 	return newChangeRowIterator(iter, tupleNames)
 }
 
@@ -713,7 +722,10 @@ func newChangeRowIterator(iter *gocql.Iter, tupleNames []string) (*changeRowIter
 
 	if len(allCols) == 0 {
 		// No columns indicate an error
-		return nil, iter.Close()
+		if err := iter.Close(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("the query returned no columns")
 	}
 
 	// If there are tuples in the table, the query will have form
@@ -787,9 +799,9 @@ func newChangeRowIterator(iter *gocql.Iter, tupleNames []string) (*changeRowIter
 	return ci, nil
 }
 
-func (ci *changeRowIterator) Next() (cdcChangeBatchCols, *ChangeRow) {
+func (ci *changeRowIterator) Next() *ChangeRow {
 	if !ci.iter.Scan(ci.columnValues...) {
-		return cdcChangeBatchCols{}, nil
+		return nil
 	}
 
 	change := &ChangeRow{
@@ -798,7 +810,8 @@ func (ci *changeRowIterator) Next() (cdcChangeBatchCols, *ChangeRow) {
 		data:     make([]interface{}, len(ci.colInfos)),
 		colInfos: ci.colInfos,
 
-		cdcCols: ci.cdcChangeRowCols,
+		batchCols: ci.cdcChangeBatchCols,
+		cdcCols:   ci.cdcChangeRowCols,
 	}
 
 	// Beginning of tupleWriteTimes contains
@@ -847,7 +860,7 @@ func (ci *changeRowIterator) Next() (cdcChangeBatchCols, *ChangeRow) {
 			pos++
 		}
 	}
-	return ci.cdcChangeBatchCols, change
+	return change
 }
 
 func (ci *changeRowIterator) Close() error {
@@ -981,6 +994,27 @@ func (wnu *withNullUnmarshaler) UnmarshalCQL(info gocql.TypeInfo, data []byte) e
 	}
 }
 
+// Returns a value representing null of given type, the same as
+// the one withNullUnmarshaler produces for a null cell.
+func nullValueForType(info gocql.TypeInfo) interface{} {
+	switch info.Type() {
+	case gocql.TypeUDT:
+		return (map[string]interface{})(nil)
+	case gocql.TypeTuple:
+		return ([]interface{})(nil)
+	case gocql.TypeList, gocql.TypeSet, gocql.TypeMap:
+		return reflect.ValueOf(info.New()).Elem().Interface()
+	case gocql.TypeBlob:
+		return ([]byte)(nil)
+	default:
+		v := info.New()
+		if v == nil {
+			return nil
+		}
+		return reflect.Zero(reflect.TypeOf(v)).Interface()
+	}
+}
+
 func (wnu *withNullUnmarshaler) derefForListOrMap() interface{} {
 	v := reflect.ValueOf(wnu.value)
 	if v.Kind() == reflect.Ptr {
@@ -0,0 +1,252 @@
+package scyllacdc
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/gocql/gocql"
+)
+
+// ClusterEventPolicy is a gocql.HostSelectionPolicy which delegates host
+// selection to another policy, and notifies subscribers about changes
+// of the cluster's topology and schema reported by the driver.
+//
+// gocql doesn't provide a public way to listen to the events sent by
+// the cluster, but it passes them to the host selection policy. In order
+// to make the Reader notice new generations as soon as possible, use this
+// policy in the cluster configuration and subscribe the Reader to it:
+//
+//	policy := scyllacdc.NewClusterEventPolicy(gocql.TokenAwareHostPolicy(gocql.RoundRobinHostPolicy()))
+//	cluster.PoolConfig.HostSelectionPolicy = policy
+//
+//	// ... create the session and the reader ...
+//
+//	unsubscribe := policy.Subscribe(reader.TriggerRefresh)
+//	defer unsubscribe()
+//
+// The policy also keeps track of the nodes of the cluster and their tokens,
+// and implements the ReplicaLocator interface. If it is set
+// in ReaderConfig.ReplicaLocator, the Reader groups streams by the nodes
+// which own them, and the policy routes queries of each group to one
+// of these nodes.
+type ClusterEventPolicy struct {
+	gocql.HostSelectionPolicy
+
+	mu          sync.Mutex
+	nextID      int
+	subscribers map[int]func()
+
+	session *gocql.Session
+	hosts   map[string]*gocql.HostInfo
+
+	// Built lazily, reset when the set of hosts changes
+	ring *tokenRing
+}
+
+// NewClusterEventPolicy creates a ClusterEventPolicy which uses given policy
+// for host selection.
+func NewClusterEventPolicy(policy gocql.HostSelectionPolicy) *ClusterEventPolicy {
+	return &ClusterEventPolicy{
+		HostSelectionPolicy: policy,
+		subscribers:         make(map[int]func()),
+		hosts:               make(map[string]*gocql.HostInfo),
+	}
+}
+
+// Subscribe registers a function which will be called after a node joins
+// or leaves the cluster, goes up, or after a schema of a keyspace changes.
+// The function is called synchronously from the driver's goroutines, so it
+// should return quickly. Returns a function which cancels the subscription.
+func (cep *ClusterEventPolicy) Subscribe(f func()) (unsubscribe func()) {
+	cep.mu.Lock()
+	defer cep.mu.Unlock()
+
+	id := cep.nextID
+	cep.nextID++
+	cep.subscribers[id] = f
+
+	return func() {
+		cep.mu.Lock()
+		defer cep.mu.Unlock()
+		delete(cep.subscribers, id)
+	}
+}
+
+func (cep *ClusterEventPolicy) notify() {
+	cep.mu.Lock()
+	subscribers := make([]func(), 0, len(cep.subscribers))
+	for _, f := range cep.subscribers {
+		subscribers = append(subscribers, f)
+	}
+	cep.mu.Unlock()
+
+	for _, f := range subscribers {
+		f()
+	}
+}
+
+func (cep *ClusterEventPolicy) trackHosts(added []*gocql.HostInfo, removed []*gocql.HostInfo) {
+	cep.mu.Lock()
+	defer cep.mu.Unlock()
+
+	for _, host := range added {
+		cep.hosts[host.HostID()] = host
+	}
+	for _, host := range removed {
+		delete(cep.hosts, host.HostID())
+	}
+	cep.ring = nil
+}
+
+// GetReplicas is needed to implement the ReplicaLocator interface.
+func (cep *ClusterEventPolicy) GetReplicas(keyspace string, token int64) ([]string, error) {
+	cep.mu.Lock()
+	session := cep.session
+	ring := cep.ring
+	if ring == nil && session != nil {
+		nodes := make([]*ringNode, 0, len(cep.hosts))
+		for _, host := range cep.hosts {
+			nodes = append(nodes, &ringNode{
+				id:     host.HostID(),
+				dc:     host.DataCenter(),
+				rack:   host.Rack(),
+				tokens: host.Tokens(),
+			})
+		}
+		var err error
+		ring, err = newTokenRing(nodes)
+		if err != nil {
+			cep.mu.Unlock()
+			return nil, err
+		}
+		cep.ring = ring
+	}
+	cep.mu.Unlock()
+
+	if session == nil {
+		return nil, errors.New("the policy was not initialized by a session")
+	}
+
+	kmeta, err := session.KeyspaceMetadata(keyspace)
+	if err != nil {
+		return nil, err
+	}
+	return ring.getReplicas(kmeta, token)
+}
+
+// Init is needed to implement the gocql.HostSelectionPolicy interface.
+func (cep *ClusterEventPolicy) Init(session *gocql.Session) {
+	cep.mu.Lock()
+	cep.session = session
+	cep.mu.Unlock()
+
+	cep.HostSelectionPolicy.Init(session)
+}
+
+// Pick is needed to implement the gocql.HostSelectionPolicy interface.
+// If the query reads from a group of streams which share their replicas,
+// the replicas are tried first, in the order chosen by the wrapped policy.
+func (cep *ClusterEventPolicy) Pick(qry gocql.ExecutableQuery) gocql.NextHost {
+	next := cep.HostSelectionPolicy.Pick(qry)
+	if qry == nil {
+		return next
+	}
+	rt, ok := qry.Context().Value(routingTokenKey{}).(routingToken)
+	if !ok {
+		return next
+	}
+	replicas, err := cep.GetReplicas(rt.keyspace, rt.token)
+	if err != nil || len(replicas) == 0 {
+		return next
+	}
+
+	isReplica := make(map[string]struct{}, len(replicas))
+	for _, id := range replicas {
+		isReplica[id] = struct{}{}
+	}
+
+	var others []gocql.SelectedHost
+	exhausted := false
+	return func() gocql.SelectedHost {
+		for !exhausted {
+			host := next()
+			if host == nil {
+				exhausted = true
+				break
+			}
+			if _, ok := isReplica[host.Info().HostID()]; ok {
+				return host
+			}
+			others = append(others, host)
+		}
+		if len(others) == 0 {
+			return nil
+		}
+		host := others[0]
+		others = others[1:]
+		return host
+	}
+}
+
+// AddHost is needed to implement the gocql.HostSelectionPolicy interface.
+func (cep *ClusterEventPolicy) AddHost(host *gocql.HostInfo) {
+	cep.trackHosts([]*gocql.HostInfo{host}, nil)
+	cep.HostSelectionPolicy.AddHost(host)
+	cep.notify()
+}
+
+// AddHosts is used by gocql to add the initial hosts of the cluster.
+// It doesn't notify the subscribers.
+func (cep *ClusterEventPolicy) AddHosts(hosts []*gocql.HostInfo) {
+	cep.trackHosts(hosts, nil)
+
+	type bulkAddHosts interface {
+		AddHosts([]*gocql.HostInfo)
+	}
+	if p, ok := cep.HostSelectionPolicy.(bulkAddHosts); ok {
+		p.AddHosts(hosts)
+		return
+	}
+	for _, host := range hosts {
+		cep.HostSelectionPolicy.AddHost(host)
+	}
+}
+
+// RemoveHost is needed to implement the gocql.HostSelectionPolicy interface.
+func (cep *ClusterEventPolicy) RemoveHost(host *gocql.HostInfo) {
+	cep.trackHosts(nil, []*gocql.HostInfo{host})
+	cep.HostSelectionPolicy.RemoveHost(host)
+	cep.notify()
+}
+
+// HostUp is needed to implement the gocql.HostSelectionPolicy interface.
+func (cep *ClusterEventPolicy) HostUp(host *gocql.HostInfo) {
+	// The tokens of the host could have changed
+	cep.trackHosts(nil, nil)
+	cep.HostSelectionPolicy.HostUp(host)
+	cep.notify()
+}
+
+// KeyspaceChanged is needed to implement the gocql.HostSelectionPolicy interface.
+func (cep *ClusterEventPolicy) KeyspaceChanged(event gocql.KeyspaceUpdateEvent) {
+	cep.HostSelectionPolicy.KeyspaceChanged(event)
+	cep.notify()
+}
+
+var _ gocql.HostSelectionPolicy = (*ClusterEventPolicy)(nil)
+var _ ReplicaLocator = (*ClusterEventPolicy)(nil)
+
+// Identifies the token whose replicas should serve a query. It is passed
+// through the query's context, because gocql doesn't allow choosing
+// the partitioner used to compute the token of a routing key.
+type routingToken struct {
+	keyspace string
+	token    int64
+}
+
+type routingTokenKey struct{}
+
+func withRoutingToken(ctx context.Context, keyspace string, token int64) context.Context {
+	return context.WithValue(ctx, routingTokenKey{}, routingToken{keyspace, token})
+}
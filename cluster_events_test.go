@@ -0,0 +1,56 @@
+package scyllacdc
+
+import (
+	"testing"
+
+	"github.com/gocql/gocql"
+)
+
+// A host selection policy which only counts the hosts which are up.
+type testHostSelectionPolicy struct {
+	gocql.HostSelectionPolicy
+	up int
+}
+
+func (p *testHostSelectionPolicy) AddHost(host *gocql.HostInfo)                    { p.up++ }
+func (p *testHostSelectionPolicy) RemoveHost(host *gocql.HostInfo)                 { p.up-- }
+func (p *testHostSelectionPolicy) HostUp(host *gocql.HostInfo)                     { p.up++ }
+func (p *testHostSelectionPolicy) HostDown(host *gocql.HostInfo)                   { p.up-- }
+func (p *testHostSelectionPolicy) KeyspaceChanged(event gocql.KeyspaceUpdateEvent) {}
+
+func TestClusterEventPolicyNotifiesSubscribers(t *testing.T) {
+	wrapped := &testHostSelectionPolicy{}
+	policy := NewClusterEventPolicy(wrapped)
+
+	var count1, count2 int
+	unsubscribe1 := policy.Subscribe(func() { count1++ })
+	unsubscribe2 := policy.Subscribe(func() { count2++ })
+	defer unsubscribe2()
+
+	host := &gocql.HostInfo{}
+
+	// Initial hosts are added in bulk and don't cause notifications
+	policy.AddHosts([]*gocql.HostInfo{host})
+	if count1 != 0 || count2 != 0 {
+		t.Fatalf("expected no notifications after adding initial hosts, got %d and %d", count1, count2)
+	}
+
+	policy.HostDown(host)
+	policy.HostUp(host)
+	policy.KeyspaceChanged(gocql.KeyspaceUpdateEvent{Keyspace: "ks", Change: "UPDATED"})
+	if count1 != 2 || count2 != 2 {
+		t.Fatalf("expected 2 notifications, got %d and %d", count1, count2)
+	}
+
+	unsubscribe1()
+	policy.RemoveHost(host)
+	if count1 != 2 {
+		t.Errorf("expected no notifications after unsubscribing, got %d", count1-2)
+	}
+	if count2 != 3 {
+		t.Errorf("expected 3 notifications, got %d", count2)
+	}
+	if wrapped.up != 0 {
+		t.Errorf("expected the events to be passed to the wrapped policy, got %d hosts up", wrapped.up)
+	}
+}
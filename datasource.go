@@ -0,0 +1,302 @@
+package scyllacdc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// DataSource provides the Reader with access to the data it needs
+// from the cluster: CDC generations, their streams, CDC log rows and
+// CDC options of the tables.
+//
+// By default, the Reader uses GocqlDataSource which fetches the data
+// from a Scylla cluster. A different implementation can be provided in
+// ReaderConfig.DataSource - for example, InMemoryDataSource allows running
+// the Reader against synthetic data without a live cluster.
+type DataSource interface {
+	// GetGenerationTimes returns start timestamps of all CDC generations
+	// known to the cluster. The timestamps do not need to be sorted.
+	GetGenerationTimes(ctx context.Context) ([]time.Time, error)
+
+	// GetGenerationStreams returns IDs of all streams which belong to
+	// the generation started at given timestamp.
+	GetGenerationStreams(ctx context.Context, genTime time.Time) ([]StreamID, error)
+
+	// QueryRange returns an iterator over rows from the CDC log of a table
+	// which belong to one of given streams and whose cdc$time lies in
+	// the (Start, End] range. Rows from the same stream must be ordered
+	// by cdc$time and cdc$batch_seq_no.
+	QueryRange(ctx context.Context, input QueryRangeInput) (ChangeRowIterator, error)
+
+	// GetTableCDCOptions returns CDC options of given base table.
+	GetTableCDCOptions(ctx context.Context, keyspaceName, tableName string) (TableCDCOptions, error)
+}
+
+// DataSourceWithTableGenerations is an extension to the DataSource interface.
+// It should be implemented by DataSources which support tables with their
+// own generations, such as tables of tablet-based keyspaces. Streams of such
+// tables don't change with the cluster-wide generations, but when tablets
+// of the table are split or merged.
+type DataSourceWithTableGenerations interface {
+	DataSource
+
+	// HasTableGenerations returns true if given base table has its own
+	// generations, and false if it uses the cluster-wide ones.
+	HasTableGenerations(ctx context.Context, keyspaceName, tableName string) (bool, error)
+
+	// GetTableGenerationTimes returns start timestamps of all generations
+	// of given table. The timestamps do not need to be sorted.
+	GetTableGenerationTimes(ctx context.Context, keyspaceName, tableName string) ([]time.Time, error)
+
+	// GetTableGenerationStreams returns IDs of all streams which belong to
+	// the generation of given table started at given timestamp.
+	GetTableGenerationStreams(ctx context.Context, keyspaceName, tableName string, genTime time.Time) ([]StreamID, error)
+}
+
+// QueryRangeInput represents input to the DataSource.QueryRange function.
+type QueryRangeInput struct {
+	// Name of the keyspace of the base table.
+	KeyspaceName string
+
+	// Name of the base table, not the cdc log table.
+	TableName string
+
+	// Streams from which the rows should be fetched.
+	Streams []StreamID
+
+	// Lower, exclusive bound on cdc$time of returned rows.
+	Start gocql.UUID
+
+	// Upper, inclusive bound on cdc$time of returned rows.
+	End gocql.UUID
+
+	// Consistency to use when querying the CDC log.
+	Consistency gocql.Consistency
+
+	// Names of the base table columns to fetch. Apart from them, their
+	// cdc$deleted_ and cdc$deleted_elements_ columns and all cdc$ metadata
+	// columns must be fetched. If nil, all columns are fetched.
+	Columns []string
+
+	// If not nil, all Streams are owned by the same replicas as this stream,
+	// and the query can be routed to one of them.
+	RoutingStream StreamID
+}
+
+// ChangeRowIterator iterates over rows returned by DataSource.QueryRange.
+type ChangeRowIterator interface {
+	// Next returns the next row, or nil if there are no more rows.
+	Next() *ChangeRow
+
+	// Close finishes the iteration and returns an error if any occurred
+	// while fetching the rows.
+	Close() error
+}
+
+// TableCDCOptions describes CDC options set on a base table.
+type TableCDCOptions struct {
+	// TTL of the rows in the CDC log table. Zero means that the rows
+	// do not expire.
+	TTL time.Duration
+
+	// All options from the "cdc" schema extension of the table,
+	// e.g. "enabled", "preimage", "postimage", "delta" or "ttl".
+	Options map[string]string
+}
+
+// GocqlDataSource is a DataSource which reads data from a Scylla cluster
+// through a gocql session.
+type GocqlDataSource struct {
+	session *gocql.Session
+	logger  Logger
+
+	mu        sync.Mutex
+	genSource generationSource
+}
+
+// NewGocqlDataSource creates a new GocqlDataSource. It detects the version
+// of the generation tables used by the cluster, and returns an error
+// if none of the supported versions is present.
+func NewGocqlDataSource(session *gocql.Session, logger Logger) (*GocqlDataSource, error) {
+	if logger == nil {
+		logger = noLogger{}
+	}
+
+	genSource, err := chooseGenerationSource(session, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect version of the generation tables used by the cluster: %v", err)
+	}
+
+	return &GocqlDataSource{
+		session:   session,
+		logger:    logger,
+		genSource: genSource,
+	}, nil
+}
+
+// GetGenerationTimes is needed to implement the DataSource interface.
+func (ds *GocqlDataSource) GetGenerationTimes(ctx context.Context) ([]time.Time, error) {
+	consistency, err := ds.getGenerationConsistency(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	ds.maybeUpgradeGenerationSource()
+	return ds.genSource.getGenerationTimes(consistency)
+}
+
+// GetGenerationStreams is needed to implement the DataSource interface.
+func (ds *GocqlDataSource) GetGenerationStreams(ctx context.Context, genTime time.Time) ([]StreamID, error) {
+	consistency, err := ds.getGenerationConsistency(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	// The timestamp could have been fetched by a different data source
+	// which already switched to the new format
+	ds.maybeUpgradeGenerationSource()
+	return ds.genSource.getGeneration(genTime, consistency)
+}
+
+// HasTableGenerations is needed to implement the DataSourceWithTableGenerations interface.
+// Tables of tablet-based keyspaces have their own generations.
+func (ds *GocqlDataSource) HasTableGenerations(ctx context.Context, keyspaceName, tableName string) (bool, error) {
+	return isTabletKeyspace(ctx, ds.session, keyspaceName)
+}
+
+// GetTableGenerationTimes is needed to implement the DataSourceWithTableGenerations interface.
+func (ds *GocqlDataSource) GetTableGenerationTimes(ctx context.Context, keyspaceName, tableName string) ([]time.Time, error) {
+	// The tables which describe generations of tablets are local tables,
+	// kept consistent on all nodes by Scylla
+	return ds.newTabletGenerationSource(keyspaceName, tableName).getGenerationTimes(gocql.One)
+}
+
+// GetTableGenerationStreams is needed to implement the DataSourceWithTableGenerations interface.
+func (ds *GocqlDataSource) GetTableGenerationStreams(ctx context.Context, keyspaceName, tableName string, genTime time.Time) ([]StreamID, error) {
+	return ds.newTabletGenerationSource(keyspaceName, tableName).getGeneration(genTime, gocql.One)
+}
+
+func (ds *GocqlDataSource) newTabletGenerationSource(keyspaceName, tableName string) generationSource {
+	return &generationSourceTablets{
+		session:      ds.session,
+		keyspaceName: keyspaceName,
+		tableName:    tableName,
+	}
+}
+
+// QueryRange is needed to implement the DataSource interface.
+func (ds *GocqlDataSource) QueryRange(ctx context.Context, input QueryRangeInput) (ChangeRowIterator, error) {
+	if token, ok := getTokenForStream(input.RoutingStream); ok {
+		// Used by ClusterEventPolicy, if the session uses it
+		ctx = withRoutingToken(ctx, input.KeyspaceName, token)
+	}
+	crq := newChangeRowQuerier(ds.session, input.Streams, input.KeyspaceName, input.TableName, input.Consistency)
+	iter, err := crq.queryRange(ctx, input.Start, input.End, input.Columns)
+	if err != nil {
+		return nil, err
+	}
+	return iter, nil
+}
+
+// GetTableCDCOptions is needed to implement the DataSource interface.
+func (ds *GocqlDataSource) GetTableCDCOptions(ctx context.Context, keyspaceName, tableName string) (TableCDCOptions, error) {
+	opts, err := fetchScyllaCDCExtension(ctx, ds.session, keyspaceName, tableName)
+	if err != nil {
+		return TableCDCOptions{}, err
+	}
+
+	ttlS, ok := opts["ttl"]
+	if !ok {
+		return TableCDCOptions{}, errors.New("ttl not set")
+	}
+
+	ttl, err := strconv.ParseInt(ttlS, 10, 64)
+	if err != nil {
+		return TableCDCOptions{}, fmt.Errorf("failed to parse TTL from schema extension: %w", err)
+	}
+
+	return TableCDCOptions{
+		TTL:     time.Duration(ttl) * time.Second,
+		Options: opts,
+	}, nil
+}
+
+// Tries switching to a new format of the generation tables before fetching
+// any generations. Must be called with the mutex held.
+func (ds *GocqlDataSource) maybeUpgradeGenerationSource() {
+	newSource, err := ds.genSource.maybeUpgrade()
+	if err != nil {
+		ds.logger.Printf("an error occurred while trying to switch to new generations format: %s", err)
+	} else {
+		ds.genSource = newSource
+	}
+}
+
+// Decides on the consistency to use when reading generation tables.
+func (ds *GocqlDataSource) getGenerationConsistency(ctx context.Context) (gocql.Consistency, error) {
+	size, err := getClusterSize(ctx, ds.session)
+	if err != nil {
+		return 0, fmt.Errorf("an error occurred while determining cluster size: %w", err)
+	}
+
+	if size >= 2 {
+		return gocql.Quorum, nil
+	}
+	return gocql.One, nil
+}
+
+// Unfortunately, gocql does not expose information about the cluster,
+// therefore we need to poll system.peers manually
+func getClusterSize(ctx context.Context, session *gocql.Session) (int, error) {
+	var size int
+	err := session.Query("SELECT COUNT(*) FROM system.peers").WithContext(ctx).Scan(&size)
+	if err != nil {
+		return 0, err
+	}
+	return size + 1, nil
+}
+
+var _ DataSource = (*GocqlDataSource)(nil)
+var _ DataSourceWithTableGenerations = (*GocqlDataSource)(nil)
+
+// Reports whether a column of the CDC log table should be fetched if
+// given base table columns were requested. A nil set means all columns.
+func isLogColumnProjected(name string, columns map[string]struct{}) bool {
+	if columns == nil {
+		return true
+	}
+	switch {
+	case strings.HasPrefix(name, "cdc$deleted_elements_"):
+		name = strings.TrimPrefix(name, "cdc$deleted_elements_")
+	case strings.HasPrefix(name, "cdc$deleted_"):
+		name = strings.TrimPrefix(name, "cdc$deleted_")
+	case strings.HasPrefix(name, "cdc$"):
+		return true
+	}
+	_, ok := columns[name]
+	return ok
+}
+
+func makeColumnSet(columns []string) map[string]struct{} {
+	if columns == nil {
+		return nil
+	}
+	set := make(map[string]struct{}, len(columns))
+	for _, col := range columns {
+		set[col] = struct{}{}
+	}
+	return set
+}
@@ -140,13 +140,102 @@ Example:
 
 Then, you need to specify an appropriate ProgressManager in the configuration.
 ProgressManager represents a mechanism of saving and restoring progress. You can
-use the provided implementations (TableBackedProgressManager), or implement
-it yourself.
+use the provided implementations (TableBackedProgressManager, which saves
+progress in a Scylla table, or FileBackedProgressManager, which saves progress
+in a local directory), or implement it yourself.
 
 In the main function:
 
 	cfg.ProgressReporter = scyllacdc.NewTableBackedProgressManager("my_keyspace.progress_table", "my_application_name")
 
+If the consumer writes to the same cluster in which progress is saved, it can
+save progress in the same logged batch as its writes, so that a change is
+never applied twice. TableBackedProgressManager supports this through
+(*ProgressReporter).ProgressStatement:
+
+	stmt, err := mc.reporter.ProgressStatement(ctx, scyllacdc.Progress{change.Time})
+	if err != nil {
+		return err
+	}
+	batch.Query(stmt.Query, stmt.Values...)
+
+The statement sets its own write timestamp with USING TIMESTAMP, which takes
+precedence over the default timestamp of the batch. The batch can therefore
+apply the writes with the timestamp of the change, set with WithTimestamp,
+as the example replicator does.
+
+Reacting to topology changes
+
+The Reader checks for new CDC generations periodically. The longest period
+between the checks can be set with AdvancedReaderConfig.GenerationFetchPeriod.
+In order to notice a new generation as soon as the topology of the cluster
+changes, use ClusterEventPolicy as the host selection policy of the session
+and subscribe the Reader to it:
+
+	policy := scyllacdc.NewClusterEventPolicy(gocql.TokenAwareHostPolicy(gocql.RoundRobinHostPolicy()))
+	cluster.PoolConfig.HostSelectionPolicy = policy
+
+	// ... create the session and the reader ...
+
+	policy.Subscribe(reader.TriggerRefresh)
+
+The policy also keeps track of the tokens of the nodes. If it is set as
+ReaderConfig.ReplicaLocator, the Reader groups streams by the nodes which
+own them, and the policy sends the queries of each group directly to one
+of these nodes:
+
+	cfg.ReplicaLocator = policy
+
+Tablet-based keyspaces
+
+Tables of keyspaces which use tablets don't follow the cluster-wide CDC
+generations. Each of them has its own generations, which change when its
+tablets are split or merged. GocqlDataSource detects such tables by looking
+at the schema, and the Reader switches generations of each of them
+independently of the other tables. If the ProgressManager implements
+ProgressManagerWithTableGeneration, the current generation of each such
+table is saved, so that the Reader resumes from it after a restart.
+All progress managers provided by the library implement it.
+
+Reading such tables is not supported together with
+ReaderConfig.Coordination. Their generations are reported to
+the GenerationObserver with the name of the table in GenerationInfo.
+
+Testing without a cluster
+
+The Reader accesses the cluster only through the DataSource interface.
+By default it uses GocqlDataSource, but in tests you can provide
+an InMemoryDataSource loaded with synthetic generations and CDC log rows
+instead:
+
+	ds := scyllacdc.NewInMemoryDataSource()
+	ds.AddGeneration(genTime, []scyllacdc.StreamID{streamID})
+	_ = ds.AddTable("my_keyspace", "my_table", columns, scyllacdc.TableCDCOptions{})
+	_ = ds.AddChange("my_keyspace", "my_table", streamID, cdcTime, scyllacdc.InMemoryLogRow{
+		Operation: scyllacdc.Insert,
+		Values:    map[string]interface{}{"pk": &pk, "v": &v},
+	})
+
+	cfg.DataSource = ds
+
+Sharing the work between processes
+
+Multiple Readers, possibly running in separate processes, can share the work
+of reading changes. Each of them needs to set the Coordination field with
+the same StreamLeaseStore, and use a ProgressManager which shares progress
+between them:
+
+	leaseStore, err := scyllacdc.NewTableBackedStreamLeaseStore(session, "my_keyspace.leases", "my_application_name")
+	if err != nil {
+		return err
+	}
+	cfg.Coordination = &scyllacdc.StreamCoordinationConfig{
+		LeaseStore: leaseStore,
+	}
+
+The Readers split groups of streams between themselves using leases. If one
+of them crashes, the others take over its groups after the leases expire.
+
 Processing changes
 
 Data from the CDC log is supplied to the ChangeConsumer through Change objects,
@@ -180,5 +269,19 @@ to a single, full (all columns included) row from the CDC log.
 		return nil
 	}
 
+Instead of accessing columns one by one, a ChangeRow can be scanned into
+a struct with fields annotated with `cql` tags:
+
+	type myRow struct {
+		ColInt        *int                 `cql:"col_int"`
+		ColIntDeleted bool                 `cql:"col_int,deleted"`
+		ColList       scyllacdc.ListChange `cql:"col_list"`
+	}
+
+	var row myRow
+	if err := changeRow.Scan(&row); err != nil {
+		return err
+	}
+
 */
 package scyllacdc
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/gocql/gocql"
+	scyllacdc "github.com/scylladb/scylla-cdc-go"
+)
+
+const usage = `Usage: progress-admin [flags] <command> [arguments]
+
+Administers progress saved by applications which use scylla-cdc-go.
+Progress is read either from a progress table (-progress-table) or from
+a directory of FileBackedProgressManager (-dir). Commands which modify
+progress should not be run while the application is running.
+
+Commands:
+  apps                 list applications which saved progress in the progress table
+  show                 show current generation, start time and per-table progress
+                       of the application; with -streams, progress of each stream
+  reset <timestamp>    make the application start reading from given timestamp
+                       (RFC 3339); all saved progress of the application is removed
+  copy                 copy progress of the application to another application
+                       (-to-application) or directory (-to-dir); progress previously
+                       saved in the destination is removed
+  delete               remove all progress of the application
+  generations          list CDC generations of the cluster; with -streams,
+                       also the token and vnode index of each stream
+
+Flags:
+`
+
+func main() {
+	var (
+		source        string
+		progressTable string
+		application   string
+		dir           string
+		toApplication string
+		toDir         string
+		tableFilter   string
+		showStreams   bool
+	)
+
+	flag.StringVar(&source, "source", "", "address of a node in the cluster; required for the progress table, optional for -dir")
+	flag.StringVar(&progressTable, "progress-table", "", "fully-qualified name of the progress table")
+	flag.StringVar(&application, "application", "", "name of the application")
+	flag.StringVar(&dir, "dir", "", "directory used by FileBackedProgressManager; if set, it is used instead of the progress table")
+	flag.StringVar(&toApplication, "to-application", "", "name of the destination application for the copy command")
+	flag.StringVar(&toDir, "to-dir", "", "destination directory for the copy command")
+	flag.StringVar(&tableFilter, "table", "", "show only progress of given fully-qualified table")
+	flag.BoolVar(&showStreams, "streams", false, "show progress of each stream, or streams of each generation")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+
+	var session *gocql.Session
+	if source != "" {
+		cluster := gocql.NewCluster(source)
+		cluster.PoolConfig.HostSelectionPolicy = gocql.TokenAwareHostPolicy(gocql.RoundRobinHostPolicy())
+		var err error
+		session, err = cluster.CreateSession()
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer session.Close()
+	}
+
+	openManager := func(application, dir string) scyllacdc.ProgressManagerWithEnumeration {
+		if dir != "" {
+			fbpm, err := scyllacdc.NewFileBackedProgressManager(dir)
+			if err != nil {
+				log.Fatal(err)
+			}
+			return fbpm
+		}
+		if session == nil || progressTable == "" {
+			log.Fatal("either -dir, or -source and -progress-table must be specified")
+		}
+		if application == "" {
+			log.Fatal("no application name specified")
+		}
+		tbpm, err := scyllacdc.NewTableBackedProgressManager(session, progressTable, application)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return tbpm
+	}
+
+	var err error
+	switch cmd := flag.Arg(0); cmd {
+	case "apps":
+		if session == nil || progressTable == "" {
+			log.Fatal("-source and -progress-table must be specified")
+		}
+		err = listApplications(ctx, session, progressTable)
+	case "show":
+		err = showProgress(ctx, openManager(application, dir), tableFilter, showStreams)
+	case "reset":
+		if flag.NArg() < 2 {
+			log.Fatal("no timestamp specified")
+		}
+		var at time.Time
+		at, err = time.Parse(time.RFC3339, flag.Arg(1))
+		if err != nil {
+			log.Fatalf("invalid timestamp: %s", err)
+		}
+		err = resetProgress(ctx, openManager(application, dir), session, at)
+	case "copy":
+		if toApplication == "" && toDir == "" {
+			log.Fatal("either -to-application or -to-dir must be specified")
+		}
+		err = copyProgress(ctx, openManager(application, dir), openManager(toApplication, toDir))
+	case "delete":
+		err = openManager(application, dir).Clear(ctx)
+	case "generations":
+		if session == nil {
+			log.Fatal("-source must be specified")
+		}
+		err = listGenerations(ctx, session, showStreams)
+	case "export", "import":
+		if flag.NArg() < 2 {
+			log.Fatal("no file specified")
+		}
+		if cmd == "export" {
+			err = exportProgress(ctx, openManager(application, dir), flag.Arg(1))
+		} else {
+			err = importProgress(ctx, openManager(application, dir), flag.Arg(1))
+		}
+	default:
+		log.Fatalf("unknown command: %s", cmd)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func listApplications(ctx context.Context, session *gocql.Session, progressTable string) error {
+	names, err := scyllacdc.ListTableBackedProgressApplications(ctx, session, progressTable)
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Println(name)
+	}
+	return nil
+}
+
+func listGenerations(ctx context.Context, session *gocql.Session, showStreams bool) error {
+	times, err := scyllacdc.GetGenerationTimes(ctx, session)
+	if err != nil {
+		return err
+	}
+	for _, t := range times {
+		streams, err := scyllacdc.GetGenerationStreams(ctx, session, t)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Generation %s: %d streams\n", formatTime(t), len(streams))
+		if !showStreams {
+			continue
+		}
+		for _, stream := range streams {
+			info, err := scyllacdc.DecodeStreamID(stream)
+			if err != nil {
+				fmt.Printf("  %s: %s\n", stream, err)
+				continue
+			}
+			fmt.Printf("  %s: token %d, vnode %d\n", stream, info.Token, info.VnodeIndex)
+		}
+	}
+	return nil
+}
+
+func showProgress(ctx context.Context, pm scyllacdc.ProgressManagerWithEnumeration, tableFilter string, showStreams bool) error {
+	now := time.Now()
+
+	gen, err := pm.GetCurrentGeneration(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Current generation: %s\n", formatTime(gen))
+
+	if withStartTime, ok := pm.(scyllacdc.ProgressManagerWithStartTime); ok {
+		startTime, err := withStartTime.GetApplicationReadStartTime(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Application start time: %s\n", formatTime(startTime))
+	}
+
+	// Tables with their own generations are read in them, and not
+	// in the generation of the cluster
+	var tableGens map[string]time.Time
+	if withTableGen, ok := pm.(scyllacdc.ProgressManagerWithTableGeneration); ok {
+		tableGens, err = withTableGen.ListTableGenerations(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	tableGenNames := make([]string, 0, len(tableGens))
+	for name := range tableGens {
+		if tableFilter == "" || name == tableFilter {
+			tableGenNames = append(tableGenNames, name)
+		}
+	}
+	sort.Strings(tableGenNames)
+	for _, name := range tableGenNames {
+		fmt.Printf("Current generation of table %s: %s\n", name, formatTime(tableGens[name]))
+	}
+	generationOf := func(tableName string) time.Time {
+		if tableGen, ok := tableGens[tableName]; ok {
+			return tableGen
+		}
+		return gen
+	}
+
+	entries, err := pm.ListProgress(ctx)
+	if err != nil {
+		return err
+	}
+
+	type tableSummary struct {
+		streams  int
+		earliest time.Time
+		latest   time.Time
+	}
+	summaries := make(map[string]*tableSummary)
+	var tableNames []string
+
+	for _, entry := range entries {
+		if !entry.Generation.Equal(generationOf(entry.TableName)) {
+			continue
+		}
+		if tableFilter != "" && entry.TableName != tableFilter {
+			continue
+		}
+		t := entry.Progress.LastProcessedRecordTime.Time()
+		summary, ok := summaries[entry.TableName]
+		if !ok {
+			summary = &tableSummary{earliest: t, latest: t}
+			summaries[entry.TableName] = summary
+			tableNames = append(tableNames, entry.TableName)
+		}
+		summary.streams++
+		if t.Before(summary.earliest) {
+			summary.earliest = t
+		}
+		if t.After(summary.latest) {
+			summary.latest = t
+		}
+		if showStreams {
+			fmt.Printf("  %s %s: %s (lag %s)\n", entry.TableName, entry.StreamID, formatTime(t), formatLag(now, t))
+		}
+	}
+
+	sort.Strings(tableNames)
+	for _, name := range tableNames {
+		summary := summaries[name]
+		fmt.Printf("Table %s: %d streams with progress, earliest %s (lag %s), latest %s (lag %s)\n",
+			name, summary.streams,
+			formatTime(summary.earliest), formatLag(now, summary.earliest),
+			formatTime(summary.latest), formatLag(now, summary.latest),
+		)
+	}
+	if len(tableNames) == 0 {
+		fmt.Println("No progress saved in the current generation")
+	}
+
+	older := 0
+	for _, entry := range entries {
+		if entry.Generation.Before(generationOf(entry.TableName)) {
+			older++
+		}
+	}
+	if older > 0 {
+		fmt.Printf("%d streams have progress saved in older generations\n", older)
+	}
+	return nil
+}
+
+func resetProgress(ctx context.Context, pm scyllacdc.ProgressManagerWithEnumeration, session *gocql.Session, at time.Time) error {
+	withStartTime, ok := pm.(scyllacdc.ProgressManagerWithStartTime)
+	if !ok {
+		return errors.New("the progress manager does not support saving the application start time")
+	}
+
+	// The generation is optional - if it is not saved, the reader will find
+	// the generation to start from using the application start time
+	var gen time.Time
+	if session != nil {
+		dataSource, err := scyllacdc.NewGocqlDataSource(session, nil)
+		if err != nil {
+			return err
+		}
+		times, err := dataSource.GetGenerationTimes(ctx)
+		if err != nil {
+			return err
+		}
+		for _, t := range times {
+			if !t.After(at) && t.After(gen) {
+				gen = t
+			}
+		}
+	}
+
+	// Tables which were read should also be read from the new start time,
+	// and not be considered new by the reader
+	entries, err := pm.ListProgress(ctx)
+	if err != nil {
+		return err
+	}
+	tableNames := make(map[string]struct{})
+	for _, entry := range entries {
+		tableNames[entry.TableName] = struct{}{}
+	}
+
+	// Tables which were added, but have no progress yet, are known only
+	// by their start times
+	withTableStartTime, hasTableStartTimes := pm.(scyllacdc.ProgressManagerWithTableStartTime)
+	if hasTableStartTimes {
+		startTimes, err := withTableStartTime.ListTableReadStartTimes(ctx)
+		if err != nil {
+			return err
+		}
+		for tableName := range startTimes {
+			tableNames[tableName] = struct{}{}
+		}
+	}
+
+	if err := pm.Clear(ctx); err != nil {
+		return err
+	}
+	if err := withStartTime.SaveApplicationReadStartTime(ctx, at); err != nil {
+		return err
+	}
+	if hasTableStartTimes {
+		for tableName := range tableNames {
+			if err := withTableStartTime.SaveTableReadStartTime(ctx, tableName, at); err != nil {
+				return err
+			}
+		}
+	}
+	if !gen.IsZero() {
+		if err := pm.StartGeneration(ctx, gen); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("The application will start reading from %s, in generation %s\n", formatTime(at), formatTime(gen))
+	return nil
+}
+
+func copyProgress(ctx context.Context, from, to scyllacdc.ProgressManager) error {
+	snapshot, err := scyllacdc.ExportProgress(ctx, from)
+	if err != nil {
+		return err
+	}
+	if err := scyllacdc.ImportProgress(ctx, to, snapshot); err != nil {
+		return err
+	}
+	fmt.Printf("Copied progress of %d streams\n", len(snapshot.Entries))
+	return nil
+}
+
+func exportProgress(ctx context.Context, pm scyllacdc.ProgressManager, path string) error {
+	snapshot, err := scyllacdc.ExportProgress(ctx, pm)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+func importProgress(ctx context.Context, pm scyllacdc.ProgressManager, path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var snapshot scyllacdc.ProgressSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return err
+	}
+	if err := scyllacdc.ImportProgress(ctx, pm, &snapshot); err != nil {
+		return err
+	}
+	fmt.Printf("Imported progress of %d streams\n", len(snapshot.Entries))
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "none"
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func formatLag(now, t time.Time) string {
+	if t.IsZero() {
+		return "unknown"
+	}
+	return now.Sub(t).Truncate(time.Second).String()
+}
@@ -175,7 +175,9 @@ func newReplicator(
 	// Configure a session
 	cluster := gocql.NewCluster(source)
 	cluster.Timeout = 10 * time.Second
-	cluster.PoolConfig.HostSelectionPolicy = gocql.TokenAwareHostPolicy(gocql.RoundRobinHostPolicy())
+	// Look for new generations as soon as the topology of the source cluster changes
+	eventPolicy := scyllacdc.NewClusterEventPolicy(gocql.TokenAwareHostPolicy(gocql.RoundRobinHostPolicy()))
+	cluster.PoolConfig.HostSelectionPolicy = eventPolicy
 	sourceSession, err := cluster.CreateSession()
 	if err != nil {
 		destinationSession.Close()
@@ -207,6 +209,7 @@ func newReplicator(
 		ProgressManager:       progressManager,
 		TableNames:            tableNames,
 		Consistency:           readConsistency,
+		ReplicaLocator:        eventPolicy,
 	}
 
 	if advancedParams != nil {
@@ -221,6 +224,7 @@ func newReplicator(
 		destinationSession.Close()
 		return nil, err
 	}
+	eventPolicy.Subscribe(reader.TriggerRefresh)
 
 	repl := &replicator{
 		reader: reader,
@@ -303,6 +307,11 @@ type DeltaReplicator struct {
 
 	streamID scyllacdc.StreamID
 	reporter *scyllacdc.PeriodicProgressReporter
+
+	// If the progress manager supports progress statements, progress
+	// is saved in the same batch as the change, and reporter is not used
+	progressReporter  *scyllacdc.ProgressReporter
+	lastProgressSaved time.Time
 }
 
 type updateQuerySet struct {
@@ -366,6 +375,9 @@ func NewDeltaReplicator(
 		streamID: streamID,
 		reporter: scyllacdc.NewPeriodicProgressReporter(logger, reportPeriod, reporter),
 	}
+	if reporter.SupportsProgressStatement() {
+		dr.progressReporter = reporter
+	}
 
 	dr.precomputeQueries()
 
@@ -403,28 +415,34 @@ func (r *DeltaReplicator) Consume(ctx context.Context, c scyllacdc.Change) error
 	timestamp := c.GetCassandraTimestamp()
 	pos := 0
 
+	// All writes of the change are applied with its timestamp. The progress
+	// statement sets its own timestamp, which takes precedence over
+	// the timestamp of the batch.
+	batch := r.session.NewBatch(gocql.LoggedBatch).WithContext(ctx)
+	batch.SetConsistency(r.consistency)
+	batch.WithTimestamp(timestamp)
+
 	if showTimestamps {
 		log.Printf("[%s] Processing timestamp: %s (%s)\n", c.StreamID, c.Time, c.Time.Time())
 	}
 
 	for pos < len(c.Delta) {
 		change := c.Delta[pos]
-		var err error
 		switch change.GetOperation() {
 		case scyllacdc.Update:
-			err = r.processUpdate(ctx, timestamp, change)
+			r.processUpdate(batch, timestamp, change)
 			pos++
 
 		case scyllacdc.Insert:
-			err = r.processInsert(ctx, timestamp, change)
+			r.processInsert(batch, timestamp, change)
 			pos++
 
 		case scyllacdc.RowDelete:
-			err = r.processRowDelete(ctx, timestamp, change)
+			r.processRowDelete(batch, change)
 			pos++
 
 		case scyllacdc.PartitionDelete:
-			err = r.processPartitionDelete(ctx, timestamp, change)
+			r.processPartitionDelete(batch, change)
 			pos++
 
 		case scyllacdc.RangeDeleteStartInclusive, scyllacdc.RangeDeleteStartExclusive:
@@ -438,7 +456,7 @@ func (r *DeltaReplicator) Consume(ctx context.Context, c scyllacdc.Change) error
 			if end.GetOperation() != scyllacdc.RangeDeleteEndInclusive && end.GetOperation() != scyllacdc.RangeDeleteEndExclusive {
 				return errors.New("invalid change: range delete start row without corresponding end row")
 			}
-			err = r.processRangeDelete(ctx, timestamp, start, end)
+			r.processRangeDelete(batch, start, end)
 			pos += 2
 
 		case scyllacdc.RangeDeleteEndInclusive, scyllacdc.RangeDeleteEndExclusive:
@@ -449,13 +467,30 @@ func (r *DeltaReplicator) Consume(ctx context.Context, c scyllacdc.Change) error
 		default:
 			return errors.New("unsupported operation: " + change.GetOperation().String())
 		}
+	}
+
+	if r.progressReporter != nil {
+		stmt, err := r.progressReporter.ProgressStatement(ctx, scyllacdc.Progress{LastProcessedRecordTime: c.Time})
+		if err != nil {
+			return err
+		}
+		batch.Query(stmt.Query, stmt.Values...)
+	}
 
+	if len(batch.Entries) > 0 {
+		err := tryWithExponentialBackoff(ctx, func() error {
+			return r.session.ExecuteBatch(batch)
+		})
 		if err != nil {
 			return err
 		}
 	}
 
-	r.reporter.Update(c.Time)
+	if r.progressReporter == nil {
+		r.reporter.Update(c.Time)
+	} else {
+		r.lastProgressSaved = time.Now()
+	}
 	r.localCount += int64(len(c.Delta))
 
 	return nil
@@ -470,38 +505,51 @@ func (r *DeltaReplicator) End() error {
 
 func (r *DeltaReplicator) Empty(ctx context.Context, ackTime gocql.UUID) error {
 	log.Printf("Streams [%s]: saw no changes up to %s", r.streamID, ackTime.Time())
-	r.reporter.Update(ackTime)
+	if r.progressReporter == nil {
+		r.reporter.Update(ackTime)
+		return nil
+	}
+
+	// Consume and Empty are not called concurrently, so the progress
+	// can't overwrite the progress saved with a later change
+	if time.Since(r.lastProgressSaved) < reportPeriod {
+		return nil
+	}
+	stmt, err := r.progressReporter.ProgressStatement(ctx, scyllacdc.Progress{LastProcessedRecordTime: ackTime})
+	if err != nil {
+		return err
+	}
+	err = tryWithExponentialBackoff(ctx, func() error {
+		return r.session.Query(stmt.Query, stmt.Values...).WithContext(ctx).Consistency(r.consistency).Exec()
+	})
+	if err != nil {
+		return err
+	}
+	r.lastProgressSaved = time.Now()
 	return nil
 }
 
 // Make sure that DeltaReplicator supports the ChangeOrEmptyNotificationConsumer interface
 var _ scyllacdc.ChangeOrEmptyNotificationConsumer = (*DeltaReplicator)(nil)
 
-func (r *DeltaReplicator) processUpdate(ctx context.Context, timestamp int64, c *scyllacdc.ChangeRow) error {
-	return r.processInsertOrUpdate(ctx, timestamp, false, c)
+// Adds the query to the batch which applies the change.
+func (r *DeltaReplicator) addQuery(batch *gocql.Batch, q string, vals []interface{}) {
+	if debugQueries {
+		fmt.Println(q)
+		fmt.Println(vals...)
+	}
+	batch.Query(q, vals...)
 }
 
-func (r *DeltaReplicator) processInsert(ctx context.Context, timestamp int64, c *scyllacdc.ChangeRow) error {
-	return r.processInsertOrUpdate(ctx, timestamp, true, c)
+func (r *DeltaReplicator) processUpdate(batch *gocql.Batch, timestamp int64, c *scyllacdc.ChangeRow) {
+	r.processInsertOrUpdate(batch, timestamp, false, c)
 }
 
-func (r *DeltaReplicator) processInsertOrUpdate(ctx context.Context, timestamp int64, isInsert bool, c *scyllacdc.ChangeRow) error {
-	runQuery := func(q string, vals []interface{}) error {
-		if debugQueries {
-			fmt.Println(q)
-			fmt.Println(vals...)
-		}
-
-		return tryWithExponentialBackoff(ctx, func() error {
-			return r.session.
-				Query(q, vals...).
-				Consistency(r.consistency).
-				Idempotent(true).
-				WithTimestamp(timestamp).
-				Exec()
-		})
-	}
+func (r *DeltaReplicator) processInsert(batch *gocql.Batch, timestamp int64, c *scyllacdc.ChangeRow) {
+	r.processInsertOrUpdate(batch, timestamp, true, c)
+}
 
+func (r *DeltaReplicator) processInsertOrUpdate(batch *gocql.Batch, timestamp int64, isInsert bool, c *scyllacdc.ChangeRow) {
 	keyColumns := append(r.pkColumns, r.ckColumns...)
 
 	if isInsert {
@@ -510,9 +558,7 @@ func (r *DeltaReplicator) processInsertOrUpdate(ctx context.Context, timestamp i
 		var vals []interface{}
 		vals = appendKeyValuesToBind(vals, keyColumns, c)
 		vals = append(vals, c.GetTTL())
-		if err := runQuery(r.insertStr, vals); err != nil {
-			return err
-		}
+		r.addQuery(batch, r.insertStr, vals)
 	}
 
 	// Precompute the WHERE x = ? AND y = ? ... part
@@ -533,9 +579,7 @@ func (r *DeltaReplicator) processInsertOrUpdate(ctx context.Context, timestamp i
 
 				var vals []interface{}
 				vals = appendKeyValuesToBind(vals, keyColumns, c)
-				if err := runQuery(deleteStr, vals); err != nil {
-					return err
-				}
+				r.addQuery(batch, deleteStr, vals)
 			} else if !reflect.ValueOf(atomicChange.Value).IsNil() {
 				// The column was overwritten
 				updateStr := fmt.Sprintf(
@@ -547,9 +591,7 @@ func (r *DeltaReplicator) processInsertOrUpdate(ctx context.Context, timestamp i
 				vals = append(vals, c.GetTTL())
 				vals = appendValueByType(vals, atomicChange.Value, typ)
 				vals = appendKeyValuesToBind(vals, keyColumns, c)
-				if err := runQuery(updateStr, vals); err != nil {
-					return err
-				}
+				r.addQuery(batch, updateStr, vals)
 			}
 		} else if typ.Type() == TypeList {
 			listChange := c.GetListChange(colName)
@@ -572,9 +614,7 @@ func (r *DeltaReplicator) processInsertOrUpdate(ctx context.Context, timestamp i
 				var vals []interface{}
 				vals = append(vals, timestamp-1)
 				vals = appendKeyValuesToBind(vals, keyColumns, c)
-				if err := runQuery(deleteStr, vals); err != nil {
-					return err
-				}
+				r.addQuery(batch, deleteStr, vals)
 			}
 			if !reflect.ValueOf(listChange.AppendedElements).IsNil() {
 				// TODO: Explain
@@ -584,19 +624,17 @@ func (r *DeltaReplicator) processInsertOrUpdate(ctx context.Context, timestamp i
 				)
 
 				rAppendedElements := reflect.ValueOf(listChange.AppendedElements)
-				r := rAppendedElements.MapRange()
-				for r.Next() {
-					k := r.Key().Interface()
-					v := r.Value().Interface()
+				iter := rAppendedElements.MapRange()
+				for iter.Next() {
+					k := iter.Key().Interface()
+					v := iter.Value().Interface()
 
 					var vals []interface{}
 					vals = append(vals, c.GetTTL())
 					vals = append(vals, k)
 					vals = appendValueByType(vals, v, typ)
 					vals = appendKeyValuesToBind(vals, keyColumns, c)
-					if err := runQuery(setStr, vals); err != nil {
-						return err
-					}
+					r.addQuery(batch, setStr, vals)
 				}
 			}
 			if !reflect.ValueOf(listChange.RemovedElements).IsNil() {
@@ -614,9 +652,7 @@ func (r *DeltaReplicator) processInsertOrUpdate(ctx context.Context, timestamp i
 					var vals []interface{}
 					vals = append(vals, k)
 					vals = appendKeyValuesToBind(vals, keyColumns, c)
-					if err := runQuery(clearStr, vals); err != nil {
-						return err
-					}
+					r.addQuery(batch, clearStr, vals)
 				}
 			}
 		} else if typ.Type() == TypeSet || typ.Type() == TypeMap {
@@ -651,9 +687,7 @@ func (r *DeltaReplicator) processInsertOrUpdate(ctx context.Context, timestamp i
 				vals = append(vals, c.GetTTL())
 				vals = append(vals, added)
 				vals = appendKeyValuesToBind(vals, keyColumns, c)
-				if err := runQuery(setStr, vals); err != nil {
-					return err
-				}
+				r.addQuery(batch, setStr, vals)
 			} else {
 				if !reflect.ValueOf(added).IsNil() {
 					// Add elements
@@ -666,9 +700,7 @@ func (r *DeltaReplicator) processInsertOrUpdate(ctx context.Context, timestamp i
 					vals = append(vals, c.GetTTL())
 					vals = append(vals, added)
 					vals = appendKeyValuesToBind(vals, keyColumns, c)
-					if err := runQuery(addStr, vals); err != nil {
-						return err
-					}
+					r.addQuery(batch, addStr, vals)
 				}
 				if !reflect.ValueOf(removed).IsNil() {
 					// Removed elements
@@ -681,9 +713,7 @@ func (r *DeltaReplicator) processInsertOrUpdate(ctx context.Context, timestamp i
 					vals = append(vals, c.GetTTL())
 					vals = append(vals, removed)
 					vals = appendKeyValuesToBind(vals, keyColumns, c)
-					if err := runQuery(remStr, vals); err != nil {
-						return err
-					}
+					r.addQuery(batch, remStr, vals)
 				}
 			}
 		} else if typ.Type() == TypeUDT {
@@ -699,9 +729,7 @@ func (r *DeltaReplicator) processInsertOrUpdate(ctx context.Context, timestamp i
 				vals = append(vals, c.GetTTL())
 				vals = appendValueByType(vals, udtChange.AddedFields, typ)
 				vals = appendKeyValuesToBind(vals, keyColumns, c)
-				if err := runQuery(updateStr, vals); err != nil {
-					return err
-				}
+				r.addQuery(batch, updateStr, vals)
 			} else {
 				// Overwrite those columns which are non-null in AddedFields,
 				// and remove those which are listed in RemovedFields.
@@ -735,56 +763,29 @@ func (r *DeltaReplicator) processInsertOrUpdate(ctx context.Context, timestamp i
 					pkConditions,
 				)
 
-				if err := runQuery(updateUDTStr, vals); err != nil {
-					return err
-				}
+				r.addQuery(batch, updateUDTStr, vals)
 			}
 		}
 	}
 
-	return nil
 }
 
-func (r *DeltaReplicator) processRowDelete(ctx context.Context, timestamp int64, c *scyllacdc.ChangeRow) error {
+func (r *DeltaReplicator) processRowDelete(batch *gocql.Batch, c *scyllacdc.ChangeRow) {
 	vals := make([]interface{}, 0, len(r.pkColumns)+len(r.ckColumns))
 	vals = appendKeyValuesToBind(vals, r.pkColumns, c)
 	vals = appendKeyValuesToBind(vals, r.ckColumns, c)
 
-	if debugQueries {
-		fmt.Println(r.rowDeleteQueryStr)
-		fmt.Println(vals...)
-	}
-
-	return tryWithExponentialBackoff(ctx, func() error {
-		return r.session.
-			Query(r.rowDeleteQueryStr, vals...).
-			Consistency(r.consistency).
-			Idempotent(true).
-			WithTimestamp(timestamp).
-			Exec()
-	})
+	r.addQuery(batch, r.rowDeleteQueryStr, vals)
 }
 
-func (r *DeltaReplicator) processPartitionDelete(ctx context.Context, timestamp int64, c *scyllacdc.ChangeRow) error {
+func (r *DeltaReplicator) processPartitionDelete(batch *gocql.Batch, c *scyllacdc.ChangeRow) {
 	vals := make([]interface{}, 0, len(r.pkColumns))
 	vals = appendKeyValuesToBind(vals, r.pkColumns, c)
 
-	if debugQueries {
-		fmt.Println(r.partitionDeleteQueryStr)
-		fmt.Println(vals...)
-	}
-
-	return tryWithExponentialBackoff(ctx, func() error {
-		return r.session.
-			Query(r.partitionDeleteQueryStr, vals...).
-			Consistency(r.consistency).
-			Idempotent(true).
-			WithTimestamp(timestamp).
-			Exec()
-	})
+	r.addQuery(batch, r.partitionDeleteQueryStr, vals)
 }
 
-func (r *DeltaReplicator) processRangeDelete(ctx context.Context, timestamp int64, start, end *scyllacdc.ChangeRow) error {
+func (r *DeltaReplicator) processRangeDelete(batch *gocql.Batch, start, end *scyllacdc.ChangeRow) {
 	vals := make([]interface{}, 0)
 	vals = appendKeyValuesToBind(vals, r.pkColumns, start)
 
@@ -833,19 +834,7 @@ func (r *DeltaReplicator) processRangeDelete(ctx context.Context, timestamp int6
 		strings.Join(conditions, " AND "),
 	)
 
-	if debugQueries {
-		fmt.Println(deleteStr)
-		fmt.Println(vals...)
-	}
-
-	return tryWithExponentialBackoff(ctx, func() error {
-		return r.session.
-			Query(deleteStr, vals...).
-			Consistency(r.consistency).
-			Idempotent(true).
-			WithTimestamp(timestamp).
-			Exec()
-	})
+	r.addQuery(batch, deleteStr, vals)
 }
 
 func (r *DeltaReplicator) makeBindMarkerAssignmentList(columnNames []string) []string {
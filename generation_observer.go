@@ -0,0 +1,112 @@
+package scyllacdc
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// GenerationObserver receives notifications about generations read
+// by the Reader. It can be used to correlate the Reader's activity with
+// changes of the cluster's topology, or to perform actions at generation
+// boundaries.
+//
+// Generations of tables which have their own generations, e.g. tables of
+// tablet-based keyspaces, are reported as well, with the name of the table
+// in GenerationInfo. They are read independently of the generations of
+// the cluster, so notifications about both kinds can be interleaved.
+//
+// The methods are called sequentially by the Reader. If any of them returns
+// an error, the Reader stops with that error.
+type GenerationObserver interface {
+	// GenerationDiscovered is called when the Reader learns about
+	// a generation which it is going to read: the first generation
+	// after the Reader starts, and then each next generation while
+	// the previous one is still being read.
+	GenerationDiscovered(ctx context.Context, info GenerationInfo) error
+
+	// GenerationStarted is called after the streams of the generation
+	// were grouped, before the Reader starts reading them.
+	GenerationStarted(ctx context.Context, info GenerationInfo) error
+
+	// GenerationDrained is called after all streams of the generation
+	// were read up to the point at which the generation was closed,
+	// and all of their consumers were ended.
+	GenerationDrained(ctx context.Context, info GenerationDrainInfo) error
+}
+
+// GenerationInfo describes a generation read by the Reader.
+type GenerationInfo struct {
+	// Timestamp of the generation.
+	StartTime time.Time
+
+	// Fully qualified name of the table if the generation belongs to
+	// a single table with its own generations, or empty for generations
+	// of the cluster.
+	TableName string
+
+	// Number of streams of the generation.
+	StreamCount int
+
+	// Number of groups of streams which are read by the Reader. Streams of
+	// each group are queried by a single stream batch reader per table.
+	// With ReaderConfig.Coordination, the groups are further split between
+	// the Readers.
+	//
+	// It is zero in GenerationDiscovered, as the streams are grouped
+	// when the generation is started.
+	GroupCount int
+}
+
+// GenerationDrainInfo describes a generation which was drained.
+type GenerationDrainInfo struct {
+	GenerationInfo
+
+	// Timestamp of the next generation, or zero if the Reader was stopped.
+	NextStartTime time.Time
+
+	// Points up to which the tables were read in the generation, indexed
+	// by fully qualified table names. Only the tables which were read
+	// when the generation was closed are included. The point is zero
+	// if the Reader was stopped with Stop.
+	TableCloseTimes map[string]time.Time
+}
+
+// Calls the observer sequentially, as the generations of the cluster and
+// of tables with their own generations are read concurrently.
+type syncGenerationObserver struct {
+	mu       sync.Mutex
+	observer GenerationObserver
+}
+
+func (sgo *syncGenerationObserver) GenerationDiscovered(ctx context.Context, info GenerationInfo) error {
+	sgo.mu.Lock()
+	defer sgo.mu.Unlock()
+	return sgo.observer.GenerationDiscovered(ctx, info)
+}
+
+func (sgo *syncGenerationObserver) GenerationStarted(ctx context.Context, info GenerationInfo) error {
+	sgo.mu.Lock()
+	defer sgo.mu.Unlock()
+	return sgo.observer.GenerationStarted(ctx, info)
+}
+
+func (sgo *syncGenerationObserver) GenerationDrained(ctx context.Context, info GenerationDrainInfo) error {
+	sgo.mu.Lock()
+	defer sgo.mu.Unlock()
+	return sgo.observer.GenerationDrained(ctx, info)
+}
+
+type noGenerationObserver struct{}
+
+func (noGenerationObserver) GenerationDiscovered(ctx context.Context, info GenerationInfo) error {
+	return nil
+}
+
+func (noGenerationObserver) GenerationStarted(ctx context.Context, info GenerationInfo) error {
+	return nil
+}
+
+func (noGenerationObserver) GenerationDrained(ctx context.Context, info GenerationDrainInfo) error {
+	return nil
+}
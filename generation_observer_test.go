@@ -0,0 +1,125 @@
+package scyllacdc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingGenerationObserver struct {
+	mu     sync.Mutex
+	events []string
+	drains []GenerationDrainInfo
+
+	startErr error
+}
+
+func (rgo *recordingGenerationObserver) record(event string, info GenerationInfo) {
+	rgo.mu.Lock()
+	defer rgo.mu.Unlock()
+	s := fmt.Sprintf("%s %d %d/%d", event, info.StartTime.Unix(), info.StreamCount, info.GroupCount)
+	if info.TableName != "" {
+		s += " " + info.TableName
+	}
+	rgo.events = append(rgo.events, s)
+}
+
+func (rgo *recordingGenerationObserver) GenerationDiscovered(ctx context.Context, info GenerationInfo) error {
+	rgo.record("discovered", info)
+	return nil
+}
+
+func (rgo *recordingGenerationObserver) GenerationStarted(ctx context.Context, info GenerationInfo) error {
+	rgo.record("started", info)
+	return rgo.startErr
+}
+
+func (rgo *recordingGenerationObserver) GenerationDrained(ctx context.Context, info GenerationDrainInfo) error {
+	rgo.record("drained", info.GenerationInfo)
+	rgo.mu.Lock()
+	defer rgo.mu.Unlock()
+	rgo.drains = append(rgo.drains, info)
+	return nil
+}
+
+func TestReaderNotifiesGenerationObserver(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	gen1 := now.Add(-time.Hour)
+	gen2 := now.Add(-30 * time.Second)
+
+	ds := NewInMemoryDataSource()
+	ds.AddGeneration(gen1, []StreamID{{0x01}, {0x02}})
+	ds.AddGeneration(gen2, []StreamID{{0x03}})
+	newTestInMemoryTable(t, ds, "tbl")
+
+	observer := &recordingGenerationObserver{}
+	cfg := &ReaderConfig{
+		DataSource:            ds,
+		ChangeConsumerFactory: newCollectingConsumer(),
+		TableNames:            []string{"ks.tbl"},
+		GenerationObserver:    observer,
+		Advanced:              testAdvancedConfig,
+	}
+	reader, err := NewReader(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errC := make(chan error, 1)
+	go func() { errC <- reader.Run(context.Background()) }()
+
+	waitFor(t, 5*time.Second, func() bool {
+		observer.mu.Lock()
+		defer observer.mu.Unlock()
+		return len(observer.events) >= 5
+	})
+	stopAt := time.Now()
+	reader.StopAt(stopAt)
+	if err := <-errC; err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		fmt.Sprintf("discovered %d 2/0", gen1.Unix()),
+		fmt.Sprintf("started %d 2/2", gen1.Unix()),
+		fmt.Sprintf("discovered %d 1/0", gen2.Unix()),
+		fmt.Sprintf("drained %d 2/2", gen1.Unix()),
+		fmt.Sprintf("started %d 1/1", gen2.Unix()),
+		fmt.Sprintf("drained %d 1/1", gen2.Unix()),
+	}
+	if fmt.Sprint(observer.events) != fmt.Sprint(expected) {
+		t.Fatalf("expected events %v, got %v", expected, observer.events)
+	}
+
+	first, second := observer.drains[0], observer.drains[1]
+	if !first.NextStartTime.Equal(gen2) || !first.TableCloseTimes["ks.tbl"].Equal(gen2) {
+		t.Errorf("expected the first generation to be closed at %v, got %v and %v", gen2, first.NextStartTime, first.TableCloseTimes)
+	}
+	if !second.NextStartTime.IsZero() || !second.TableCloseTimes["ks.tbl"].Equal(stopAt) {
+		t.Errorf("expected the second generation to be closed at %v, got %v and %v", stopAt, second.NextStartTime, second.TableCloseTimes)
+	}
+}
+
+func TestReaderStopsOnGenerationObserverError(t *testing.T) {
+	ds := NewInMemoryDataSource()
+	ds.AddGeneration(time.Now().Add(-time.Hour), []StreamID{{0x01}})
+	newTestInMemoryTable(t, ds, "tbl")
+
+	observerErr := errors.New("observer failed")
+	cfg := &ReaderConfig{
+		DataSource:            ds,
+		ChangeConsumerFactory: newCollectingConsumer(),
+		TableNames:            []string{"ks.tbl"},
+		GenerationObserver:    &recordingGenerationObserver{startErr: observerErr},
+		Advanced:              testAdvancedConfig,
+	}
+	reader, err := NewReader(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reader.Run(context.Background()); err != observerErr {
+		t.Fatalf("expected the error of the observer, got %v", err)
+	}
+}
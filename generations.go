@@ -0,0 +1,103 @@
+package scyllacdc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+var (
+	ErrUnsupportedStreamIDFormat = errors.New("unsupported stream ID format")
+)
+
+// StreamIDInfo describes the information encoded in a StreamID.
+type StreamIDInfo struct {
+	// Version of the stream ID format.
+	Version int
+
+	// Index of the vnode to which the stream belongs, within the list of
+	// vnodes of the generation sorted by their tokens.
+	VnodeIndex int64
+
+	// Token of the stream. Partitions of the CDC log belonging to
+	// the stream are stored on the replicas of this token, and it lies
+	// within the token range of the stream's vnode.
+	Token int64
+}
+
+// DecodeStreamID decodes the information encoded in given stream ID.
+// Scylla generates stream IDs in the format of version 1: a 16-byte
+// value where the first 8 bytes are the token of the stream, and
+// the lower bits of the last 8 bytes contain the version and the index
+// of the vnode.
+//
+// Returns ErrUnsupportedStreamIDFormat if the ID has a different length or
+// version. If only the version is not recognized, the returned StreamIDInfo
+// still contains the version and the token, and its VnodeIndex is -1.
+func DecodeStreamID(streamID StreamID) (StreamIDInfo, error) {
+	token, ok := getTokenForStream(streamID)
+	if !ok {
+		return StreamIDInfo{VnodeIndex: -1}, ErrUnsupportedStreamIDFormat
+	}
+
+	lowerQword := binary.BigEndian.Uint64(streamID[8:16])
+
+	info := StreamIDInfo{
+		Version:    int(lowerQword & (1<<4 - 1)),
+		VnodeIndex: -1,
+		Token:      token,
+	}
+	if info.Version != 1 {
+		return info, ErrUnsupportedStreamIDFormat
+	}
+
+	info.VnodeIndex = int64((lowerQword >> 4) & (1<<22 - 1))
+	return info, nil
+}
+
+// Returns the token of the stream, which is used by the partitioner
+// of CDC log tables. Returns false if the stream ID has an unknown length.
+func getTokenForStream(streamID StreamID) (int64, bool) {
+	if len(streamID) != 16 {
+		return 0, false
+	}
+	return int64(binary.BigEndian.Uint64(streamID[0:8])), true
+}
+
+// GetGenerationTimes returns start timestamps of all CDC generations known
+// to the cluster, sorted in ascending order. Both the pre-4.4 and the 4.4+
+// formats of the generation tables are supported.
+func GetGenerationTimes(ctx context.Context, session *gocql.Session) ([]time.Time, error) {
+	ds, err := NewGocqlDataSource(session, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	times, err := ds.GetGenerationTimes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch generation timestamps: %w", err)
+	}
+	sort.Sort(timeList(times))
+	return times, nil
+}
+
+// GetGenerationStreams returns IDs of all streams of the generation started
+// at given timestamp. Both the pre-4.4 and the 4.4+ formats of the generation
+// tables are supported.
+func GetGenerationStreams(ctx context.Context, session *gocql.Session, genTime time.Time) ([]StreamID, error) {
+	ds, err := NewGocqlDataSource(session, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	streams, err := ds.GetGenerationStreams(ctx, genTime)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch streams of generation %v: %w", genTime, err)
+	}
+	return streams, nil
+}
@@ -0,0 +1,101 @@
+package scyllacdc
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+
+	"github.com/gocql/gocql"
+	"github.com/scylladb/scylla-cdc-go/internal/testutils"
+)
+
+func TestDecodeStreamID(t *testing.T) {
+	makeStreamID := func(token int64, lowerQword uint64) StreamID {
+		stream := make(StreamID, 16)
+		binary.BigEndian.PutUint64(stream[0:8], uint64(token))
+		binary.BigEndian.PutUint64(stream[8:16], lowerQword)
+		return stream
+	}
+
+	tests := []struct {
+		name     string
+		stream   StreamID
+		expected StreamIDInfo
+		ok       bool
+	}{
+		{
+			name:     "version 1",
+			stream:   makeStreamID(-1234, 0xABCD<<26|42<<4|1),
+			expected: StreamIDInfo{Version: 1, VnodeIndex: 42, Token: -1234},
+			ok:       true,
+		},
+		{
+			name:     "max vnode index",
+			stream:   makeStreamID(5678, (1<<22-1)<<4|1),
+			expected: StreamIDInfo{Version: 1, VnodeIndex: 1<<22 - 1, Token: 5678},
+			ok:       true,
+		},
+		{
+			name:     "unknown version",
+			stream:   makeStreamID(5678, 42<<4|2),
+			expected: StreamIDInfo{Version: 2, VnodeIndex: -1, Token: 5678},
+		},
+		{
+			name:     "unknown length",
+			stream:   StreamID{0x01, 0x02},
+			expected: StreamIDInfo{VnodeIndex: -1},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			info, err := DecodeStreamID(tc.stream)
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !tc.ok && err != ErrUnsupportedStreamIDFormat {
+				t.Fatalf("expected ErrUnsupportedStreamIDFormat, got %v", err)
+			}
+			if info != tc.expected {
+				t.Errorf("expected %+v, got %+v", tc.expected, info)
+			}
+		})
+	}
+}
+
+func TestGetGenerationStreams(t *testing.T) {
+	address := testutils.GetSourceClusterContactPoint()
+	cluster := gocql.NewCluster(address)
+	session, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+
+	ctx := context.Background()
+	times, err := GetGenerationTimes(ctx, session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(times) == 0 {
+		t.Fatal("expected at least one generation")
+	}
+	for i := 1; i < len(times); i++ {
+		if !times[i-1].Before(times[i]) {
+			t.Fatalf("generation timestamps are not sorted: %v", times)
+		}
+	}
+
+	streams, err := GetGenerationStreams(ctx, session, times[len(times)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(streams) == 0 {
+		t.Fatal("expected the generation to have streams")
+	}
+	for _, stream := range streams {
+		if _, err := DecodeStreamID(stream); err != nil {
+			t.Errorf("failed to decode stream %s: %s", stream, err)
+		}
+	}
+}
@@ -0,0 +1,743 @@
+package scyllacdc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gocql/gocql"
+)
+
+// ChangeJSONVersion is the version of the JSON encoding of Change
+// and ChangeRow produced by their MarshalJSON methods. The version is
+// included in the encoded objects, and UnmarshalJSON rejects versions
+// it does not understand.
+//
+// Version 1 of the encoding looks as follows. A Change is encoded as:
+//
+//	{
+//	    "version": 1,
+//	    "stream_id": "<hex-encoded cdc$stream_id>",
+//	    "time": "<cdc$time timeuuid>",
+//	    "preimage": [<row>, ...],
+//	    "delta": [<row>, ...],
+//	    "postimage": [<row>, ...]
+//	}
+//
+// and a ChangeRow is encoded as:
+//
+//	{
+//	    "version": 1,
+//	    "stream_id": "<hex-encoded cdc$stream_id>",
+//	    "time": "<cdc$time timeuuid>",
+//	    "batch_seq_no": <cdc$batch_seq_no>,
+//	    "end_of_batch": <cdc$end_of_batch>,
+//	    "operation": "<name of cdc$operation, e.g. UPDATE>",
+//	    "ttl": <cdc$ttl, or 0 if not set>,
+//	    "columns": [
+//	        {"name": "<column name>", "type": <type>, "value": <value>},
+//	        ...
+//	    ]
+//	}
+//
+// Columns are listed in the same order as returned by ChangeRow.Columns,
+// including cdc$deleted_ and cdc$deleted_elements_ columns. Metadata columns
+// such as cdc$time are listed without the "value" key, as their values are
+// stored in the fields described above. Columns which are not present
+// in the row (e.g. because of column projection) are not listed, while
+// null values are encoded as JSON null.
+//
+// A type is an object with a "type" key holding the CQL type name, e.g.
+// {"type": "int"}. Collections have an "elem" key, and maps additionally
+// a "key" key, with types of elements and keys. Tuples have an "elems" list
+// with types of the elements. UDTs have "keyspace", "name" and a "fields"
+// list of objects with "name" and "type" keys.
+//
+// Values are encoded as follows:
+//   - text, ascii, varchar and inet - as strings,
+//   - integer types, counter and time (in nanoseconds) - as numbers,
+//   - varint - as a number of arbitrary length,
+//   - float and double - as numbers, or "NaN", "Infinity", "-Infinity" strings,
+//   - decimal - as a string,
+//   - boolean - as a bool,
+//   - blob - as a base64 string,
+//   - uuid and timeuuid - as strings,
+//   - timestamp and date - as RFC 3339 strings,
+//   - duration - as {"months": M, "days": D, "nanoseconds": N},
+//   - list and set - as arrays of elements,
+//   - map - as an array of [key, value] pairs, ordered by key, e.g. the
+//     timeuuid keys of the log representation of a list are ordered by time,
+//   - tuple - as an array of elements, each of which can be null,
+//   - UDT - as an object with field names as keys, each of which can be null.
+const ChangeJSONVersion = 1
+
+type changeJSON struct {
+	Version   int          `json:"version"`
+	StreamID  string       `json:"stream_id"`
+	Time      gocql.UUID   `json:"time"`
+	PreImage  []*ChangeRow `json:"preimage"`
+	Delta     []*ChangeRow `json:"delta"`
+	PostImage []*ChangeRow `json:"postimage"`
+}
+
+type changeRowJSON struct {
+	Version    int          `json:"version"`
+	StreamID   string       `json:"stream_id"`
+	Time       gocql.UUID   `json:"time"`
+	BatchSeqNo int32        `json:"batch_seq_no"`
+	EndOfBatch bool         `json:"end_of_batch"`
+	Operation  string       `json:"operation"`
+	TTL        int64        `json:"ttl"`
+	Columns    []columnJSON `json:"columns"`
+}
+
+type columnJSON struct {
+	Name  string          `json:"name"`
+	Type  *cqlTypeJSON    `json:"type"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+type cqlTypeJSON struct {
+	Type     string         `json:"type"`
+	Key      *cqlTypeJSON   `json:"key,omitempty"`
+	Elem     *cqlTypeJSON   `json:"elem,omitempty"`
+	Elems    []*cqlTypeJSON `json:"elems,omitempty"`
+	Keyspace string         `json:"keyspace,omitempty"`
+	Name     string         `json:"name,omitempty"`
+	Fields   []udtFieldJSON `json:"fields,omitempty"`
+}
+
+type udtFieldJSON struct {
+	Name string       `json:"name"`
+	Type *cqlTypeJSON `json:"type"`
+}
+
+type durationJSON struct {
+	Months      int32 `json:"months"`
+	Days        int32 `json:"days"`
+	Nanoseconds int64 `json:"nanoseconds"`
+}
+
+var nativeTypesByName = map[string]gocql.Type{}
+
+func init() {
+	for _, typ := range []gocql.Type{
+		gocql.TypeAscii, gocql.TypeBigInt, gocql.TypeBlob, gocql.TypeBoolean,
+		gocql.TypeCounter, gocql.TypeDecimal, gocql.TypeDouble, gocql.TypeFloat,
+		gocql.TypeInt, gocql.TypeText, gocql.TypeTimestamp, gocql.TypeUUID,
+		gocql.TypeVarchar, gocql.TypeVarint, gocql.TypeTimeUUID, gocql.TypeInet,
+		gocql.TypeDate, gocql.TypeTime, gocql.TypeSmallInt, gocql.TypeTinyInt,
+		gocql.TypeDuration,
+	} {
+		nativeTypesByName[typ.String()] = typ
+	}
+}
+
+// MarshalJSON is needed to implement the json.Marshaler interface.
+// See ChangeJSONVersion for the description of the encoding.
+func (c Change) MarshalJSON() ([]byte, error) {
+	return json.Marshal(changeJSON{
+		Version:   ChangeJSONVersion,
+		StreamID:  hex.EncodeToString(c.StreamID),
+		Time:      c.Time,
+		PreImage:  nonNilRows(c.PreImage),
+		Delta:     nonNilRows(c.Delta),
+		PostImage: nonNilRows(c.PostImage),
+	})
+}
+
+// UnmarshalJSON is needed to implement the json.Unmarshaler interface.
+// It decodes a change encoded by MarshalJSON.
+func (c *Change) UnmarshalJSON(data []byte) error {
+	var cj changeJSON
+	if err := json.Unmarshal(data, &cj); err != nil {
+		return err
+	}
+	if cj.Version != ChangeJSONVersion {
+		return fmt.Errorf("unsupported version of the change encoding: %d", cj.Version)
+	}
+	streamID, err := hex.DecodeString(cj.StreamID)
+	if err != nil {
+		return fmt.Errorf("invalid stream ID %q: %s", cj.StreamID, err)
+	}
+
+	*c = Change{
+		StreamID:  streamID,
+		Time:      cj.Time,
+		PreImage:  cj.PreImage,
+		Delta:     cj.Delta,
+		PostImage: cj.PostImage,
+	}
+	return nil
+}
+
+// MarshalJSON is needed to implement the json.Marshaler interface.
+// See ChangeJSONVersion for the description of the encoding.
+func (c *ChangeRow) MarshalJSON() ([]byte, error) {
+	columns := make([]columnJSON, 0, len(c.colInfos))
+	for idx, col := range c.colInfos {
+		typ, err := encodeCQLType(col.TypeInfo)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %s", col.Name, err)
+		}
+		cj := columnJSON{
+			Name: col.Name,
+			Type: typ,
+		}
+		if !isCDCMetadataColumn(col.Name) {
+			v, err := encodeCQLValue(col.TypeInfo, reflect.ValueOf(c.data[idx]))
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %s", col.Name, err)
+			}
+			if cj.Value, err = json.Marshal(v); err != nil {
+				return nil, fmt.Errorf("column %s: %s", col.Name, err)
+			}
+		}
+		columns = append(columns, cj)
+	}
+
+	return json.Marshal(changeRowJSON{
+		Version:    ChangeJSONVersion,
+		StreamID:   hex.EncodeToString(c.batchCols.streamID),
+		Time:       c.batchCols.time,
+		BatchSeqNo: c.cdcCols.batchSeqNo,
+		EndOfBatch: c.cdcCols.endOfBatch,
+		Operation:  OperationType(c.cdcCols.operation).String(),
+		TTL:        c.cdcCols.ttl,
+		Columns:    columns,
+	})
+}
+
+// UnmarshalJSON is needed to implement the json.Unmarshaler interface.
+// It decodes a row encoded by MarshalJSON. Values of the decoded row have
+// the same representation as the ones read from the CDC log.
+func (c *ChangeRow) UnmarshalJSON(data []byte) error {
+	var crj changeRowJSON
+	if err := json.Unmarshal(data, &crj); err != nil {
+		return err
+	}
+	if crj.Version != ChangeJSONVersion {
+		return fmt.Errorf("unsupported version of the change encoding: %d", crj.Version)
+	}
+
+	streamID, err := hex.DecodeString(crj.StreamID)
+	if err != nil {
+		return fmt.Errorf("invalid stream ID %q: %s", crj.StreamID, err)
+	}
+	operation, ok := parseOperationType(crj.Operation)
+	if !ok {
+		return fmt.Errorf("invalid operation: %s", crj.Operation)
+	}
+
+	row := ChangeRow{
+		fieldNameToIdx: make(map[string]int, len(crj.Columns)),
+		data:           make([]interface{}, len(crj.Columns)),
+		colInfos:       make([]gocql.ColumnInfo, len(crj.Columns)),
+
+		batchCols: cdcChangeBatchCols{
+			streamID: streamID,
+			time:     crj.Time,
+		},
+		cdcCols: cdcChangeRowCols{
+			batchSeqNo: crj.BatchSeqNo,
+			operation:  int8(operation),
+			ttl:        crj.TTL,
+			endOfBatch: crj.EndOfBatch,
+		},
+	}
+
+	for idx, col := range crj.Columns {
+		info, err := decodeCQLType(col.Type)
+		if err != nil {
+			return fmt.Errorf("column %s: %s", col.Name, err)
+		}
+		row.colInfos[idx] = gocql.ColumnInfo{Name: col.Name, TypeInfo: info}
+		row.fieldNameToIdx[col.Name] = idx
+
+		if isCDCMetadataColumn(col.Name) {
+			continue
+		}
+		if col.Value == nil {
+			return fmt.Errorf("column %s: missing value", col.Name)
+		}
+		v, err := decodeCQLValue(info, col.Value, true)
+		if err != nil {
+			return fmt.Errorf("column %s: %s", col.Name, err)
+		}
+		row.data[idx] = v.Interface()
+	}
+
+	*c = row
+	return nil
+}
+
+func nonNilRows(rows []*ChangeRow) []*ChangeRow {
+	if rows == nil {
+		return []*ChangeRow{}
+	}
+	return rows
+}
+
+func isCDCMetadataColumn(name string) bool {
+	return strings.HasPrefix(name, "cdc$") && !strings.HasPrefix(name, "cdc$deleted_")
+}
+
+func parseOperationType(name string) (OperationType, bool) {
+	for op := PreImage; op <= PostImage; op++ {
+		if op.String() == name {
+			return op, true
+		}
+	}
+	return 0, false
+}
+
+func encodeCQLType(info gocql.TypeInfo) (*cqlTypeJSON, error) {
+	switch info.Type() {
+	case gocql.TypeList, gocql.TypeSet, gocql.TypeMap:
+		colInfo := info.(gocql.CollectionType)
+		elem, err := encodeCQLType(colInfo.Elem)
+		if err != nil {
+			return nil, err
+		}
+		typ := &cqlTypeJSON{Type: info.Type().String(), Elem: elem}
+		if info.Type() == gocql.TypeMap {
+			if typ.Key, err = encodeCQLType(colInfo.Key); err != nil {
+				return nil, err
+			}
+		}
+		return typ, nil
+
+	case gocql.TypeTuple:
+		tupInfo := info.(gocql.TupleTypeInfo)
+		typ := &cqlTypeJSON{Type: "tuple", Elems: make([]*cqlTypeJSON, 0, len(tupInfo.Elems))}
+		for _, elemInfo := range tupInfo.Elems {
+			elem, err := encodeCQLType(elemInfo)
+			if err != nil {
+				return nil, err
+			}
+			typ.Elems = append(typ.Elems, elem)
+		}
+		return typ, nil
+
+	case gocql.TypeUDT:
+		udtInfo := info.(gocql.UDTTypeInfo)
+		typ := &cqlTypeJSON{
+			Type:     "udt",
+			Keyspace: udtInfo.KeySpace,
+			Name:     udtInfo.Name,
+			Fields:   make([]udtFieldJSON, 0, len(udtInfo.Elements)),
+		}
+		for _, field := range udtInfo.Elements {
+			fieldTyp, err := encodeCQLType(field.Type)
+			if err != nil {
+				return nil, err
+			}
+			typ.Fields = append(typ.Fields, udtFieldJSON{Name: field.Name, Type: fieldTyp})
+		}
+		return typ, nil
+
+	default:
+		if _, ok := nativeTypesByName[info.Type().String()]; !ok {
+			return nil, fmt.Errorf("unsupported type: %v", info)
+		}
+		return &cqlTypeJSON{Type: info.Type().String()}, nil
+	}
+}
+
+func decodeCQLType(typ *cqlTypeJSON) (gocql.TypeInfo, error) {
+	if typ == nil {
+		return nil, fmt.Errorf("missing type")
+	}
+
+	// The protocol version only affects marshaling, which is not
+	// done on decoded rows
+	const proto = 4
+
+	switch typ.Type {
+	case "list", "set", "map":
+		elem, err := decodeCQLType(typ.Elem)
+		if err != nil {
+			return nil, err
+		}
+		cqlType := gocql.TypeList
+		var key gocql.TypeInfo
+		switch typ.Type {
+		case "set":
+			cqlType = gocql.TypeSet
+		case "map":
+			cqlType = gocql.TypeMap
+			if key, err = decodeCQLType(typ.Key); err != nil {
+				return nil, err
+			}
+		}
+		return gocql.CollectionType{
+			NativeType: gocql.NewNativeType(proto, cqlType, ""),
+			Key:        key,
+			Elem:       elem,
+		}, nil
+
+	case "tuple":
+		elems := make([]gocql.TypeInfo, 0, len(typ.Elems))
+		for _, elemTyp := range typ.Elems {
+			elem, err := decodeCQLType(elemTyp)
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, elem)
+		}
+		return gocql.TupleTypeInfo{
+			NativeType: gocql.NewNativeType(proto, gocql.TypeTuple, ""),
+			Elems:      elems,
+		}, nil
+
+	case "udt":
+		fields := make([]gocql.UDTField, 0, len(typ.Fields))
+		for _, field := range typ.Fields {
+			fieldInfo, err := decodeCQLType(field.Type)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, gocql.UDTField{Name: field.Name, Type: fieldInfo})
+		}
+		return gocql.UDTTypeInfo{
+			NativeType: gocql.NewNativeType(proto, gocql.TypeUDT, ""),
+			KeySpace:   typ.Keyspace,
+			Name:       typ.Name,
+			Elements:   fields,
+		}, nil
+
+	default:
+		nativeType, ok := nativeTypesByName[typ.Type]
+		if !ok {
+			return nil, fmt.Errorf("unsupported type: %s", typ.Type)
+		}
+		return gocql.NewNativeType(proto, nativeType, ""), nil
+	}
+}
+
+// Returns the type which gocql uses to represent values of given type,
+// e.g. int for int or []int for list<int>. Values of this type are used
+// as elements of collections.
+func goTypeOf(info gocql.TypeInfo) reflect.Type {
+	return reflect.TypeOf(info.New()).Elem()
+}
+
+// Converts a value in the ChangeRow representation into a form which
+// can be passed to json.Marshal.
+func encodeCQLValue(info gocql.TypeInfo, v reflect.Value) (interface{}, error) {
+	goType := goTypeOf(info)
+
+	// Top-level values of scalar types are represented as pointers
+	for v.IsValid() && v.Type() != goType {
+		if v.Kind() != reflect.Ptr && v.Kind() != reflect.Interface {
+			return nil, fmt.Errorf("unexpected representation of %v: %s", info, v.Type())
+		}
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil, nil
+	}
+
+	switch info.Type() {
+	case gocql.TypeList, gocql.TypeSet:
+		if v.IsNil() {
+			return nil, nil
+		}
+		elemInfo := info.(gocql.CollectionType).Elem
+		elems := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			elem, err := encodeCQLValue(elemInfo, v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, elem)
+		}
+		return elems, nil
+
+	case gocql.TypeMap:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return encodeCQLMap(info.(gocql.CollectionType), v)
+
+	case gocql.TypeTuple:
+		if v.IsNil() {
+			return nil, nil
+		}
+		tupInfo := info.(gocql.TupleTypeInfo)
+		if v.Len() != len(tupInfo.Elems) {
+			return nil, fmt.Errorf("expected %d tuple elements, got %d", len(tupInfo.Elems), v.Len())
+		}
+		elems := make([]interface{}, 0, v.Len())
+		for i, elemInfo := range tupInfo.Elems {
+			elem, err := encodeCQLValue(elemInfo, v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, elem)
+		}
+		return elems, nil
+
+	case gocql.TypeUDT:
+		if v.IsNil() {
+			return nil, nil
+		}
+		udtInfo := info.(gocql.UDTTypeInfo)
+		fields := make(map[string]interface{}, len(udtInfo.Elements))
+		for _, field := range udtInfo.Elements {
+			fv := v.MapIndex(reflect.ValueOf(field.Name))
+			if !fv.IsValid() {
+				continue
+			}
+			encoded, err := encodeCQLValue(field.Type, fv)
+			if err != nil {
+				return nil, err
+			}
+			fields[field.Name] = encoded
+		}
+		return fields, nil
+
+	case gocql.TypeBlob:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return v.Interface(), nil
+
+	case gocql.TypeFloat, gocql.TypeDouble:
+		f := v.Float()
+		switch {
+		case math.IsNaN(f):
+			return "NaN", nil
+		case math.IsInf(f, 1):
+			return "Infinity", nil
+		case math.IsInf(f, -1):
+			return "-Infinity", nil
+		}
+		return v.Interface(), nil
+
+	case gocql.TypeDuration:
+		d := v.Interface().(gocql.Duration)
+		return durationJSON{Months: d.Months, Days: d.Days, Nanoseconds: d.Nanoseconds}, nil
+
+	case gocql.TypeDecimal, gocql.TypeVarint:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return v.Interface(), nil
+
+	default:
+		return v.Interface(), nil
+	}
+}
+
+func encodeCQLMap(info gocql.CollectionType, v reflect.Value) (interface{}, error) {
+	type entry struct {
+		key        reflect.Value
+		encodedKey json.RawMessage
+		value      interface{}
+	}
+
+	entries := make([]entry, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		key, err := encodeCQLValue(info.Key, iter.Key())
+		if err != nil {
+			return nil, err
+		}
+		encodedKey, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := encodeCQLValue(info.Elem, iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry{iter.Key(), encodedKey, value})
+	}
+
+	// Go maps are not ordered, so order the entries to make the encoding
+	// stable. Timeuuid keys, used by the log representation of lists,
+	// are ordered by time, so that the order of list elements is kept.
+	sort.Slice(entries, func(i, j int) bool {
+		if info.Key.Type() == gocql.TypeTimeUUID {
+			return compareTimeuuid(entries[i].key.Interface().(gocql.UUID), entries[j].key.Interface().(gocql.UUID)) < 0
+		}
+		return bytes.Compare(entries[i].encodedKey, entries[j].encodedKey) < 0
+	})
+
+	pairs := make([][2]interface{}, 0, len(entries))
+	for _, e := range entries {
+		pairs = append(pairs, [2]interface{}{e.encodedKey, e.value})
+	}
+	return pairs, nil
+}
+
+// Decodes a value encoded by encodeCQLValue into the ChangeRow
+// representation. Top-level values of scalar types, i.e. values of columns,
+// tuple elements and UDT fields, are represented by pointers.
+func decodeCQLValue(info gocql.TypeInfo, data json.RawMessage, topLevel bool) (reflect.Value, error) {
+	goType := goTypeOf(info)
+	isNull := len(data) == 0 || string(data) == "null"
+
+	switch info.Type() {
+	case gocql.TypeList, gocql.TypeSet:
+		if isNull {
+			return reflect.Zero(goType), nil
+		}
+		var elems []json.RawMessage
+		if err := json.Unmarshal(data, &elems); err != nil {
+			return reflect.Value{}, err
+		}
+		elemInfo := info.(gocql.CollectionType).Elem
+		result := reflect.MakeSlice(goType, 0, len(elems))
+		for _, elemData := range elems {
+			elem, err := decodeCQLValue(elemInfo, elemData, false)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			result = reflect.Append(result, elem)
+		}
+		return result, nil
+
+	case gocql.TypeMap:
+		if isNull {
+			return reflect.Zero(goType), nil
+		}
+		var pairs [][2]json.RawMessage
+		if err := json.Unmarshal(data, &pairs); err != nil {
+			return reflect.Value{}, err
+		}
+		mapInfo := info.(gocql.CollectionType)
+		result := reflect.MakeMapWithSize(goType, len(pairs))
+		for _, pair := range pairs {
+			key, err := decodeCQLValue(mapInfo.Key, pair[0], false)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			value, err := decodeCQLValue(mapInfo.Elem, pair[1], false)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			result.SetMapIndex(key, value)
+		}
+		return result, nil
+
+	case gocql.TypeTuple:
+		if isNull {
+			return reflect.Zero(goType), nil
+		}
+		var elems []json.RawMessage
+		if err := json.Unmarshal(data, &elems); err != nil {
+			return reflect.Value{}, err
+		}
+		tupInfo := info.(gocql.TupleTypeInfo)
+		if len(elems) != len(tupInfo.Elems) {
+			return reflect.Value{}, fmt.Errorf("expected %d tuple elements, got %d", len(tupInfo.Elems), len(elems))
+		}
+		result := make([]interface{}, len(elems))
+		for i, elemInfo := range tupInfo.Elems {
+			elem, err := decodeCQLValue(elemInfo, elems[i], true)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			result[i] = elem.Interface()
+		}
+		return reflect.ValueOf(result), nil
+
+	case gocql.TypeUDT:
+		if isNull {
+			return reflect.Zero(goType), nil
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return reflect.Value{}, err
+		}
+		udtInfo := info.(gocql.UDTTypeInfo)
+		result := make(map[string]interface{}, len(fields))
+		for _, field := range udtInfo.Elements {
+			fieldData, ok := fields[field.Name]
+			if !ok {
+				continue
+			}
+			delete(fields, field.Name)
+			fv, err := decodeCQLValue(field.Type, fieldData, true)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			result[field.Name] = fv.Interface()
+		}
+		for name := range fields {
+			return reflect.Value{}, fmt.Errorf("no such field in %s.%s: %s", udtInfo.KeySpace, udtInfo.Name, name)
+		}
+		return reflect.ValueOf(result), nil
+
+	case gocql.TypeBlob:
+		if isNull {
+			return reflect.Zero(goType), nil
+		}
+		result := make([]byte, 0)
+		if err := json.Unmarshal(data, &result); err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(result), nil
+	}
+
+	if isNull {
+		if !topLevel {
+			return reflect.Value{}, fmt.Errorf("unexpected null element of type %v", info)
+		}
+		return reflect.Zero(reflect.PtrTo(goType)), nil
+	}
+
+	ptr := reflect.New(goType)
+	switch info.Type() {
+	case gocql.TypeFloat, gocql.TypeDouble:
+		var s string
+		if json.Unmarshal(data, &s) == nil {
+			switch s {
+			case "NaN":
+				ptr.Elem().SetFloat(math.NaN())
+			case "Infinity":
+				ptr.Elem().SetFloat(math.Inf(1))
+			case "-Infinity":
+				ptr.Elem().SetFloat(math.Inf(-1))
+			default:
+				return reflect.Value{}, fmt.Errorf("invalid floating point value: %s", s)
+			}
+		} else if err := json.Unmarshal(data, ptr.Interface()); err != nil {
+			return reflect.Value{}, err
+		}
+
+	case gocql.TypeDuration:
+		var dj durationJSON
+		if err := json.Unmarshal(data, &dj); err != nil {
+			return reflect.Value{}, err
+		}
+		ptr.Elem().Set(reflect.ValueOf(gocql.Duration{Months: dj.Months, Days: dj.Days, Nanoseconds: dj.Nanoseconds}))
+
+	default:
+		if err := json.Unmarshal(data, ptr.Interface()); err != nil {
+			return reflect.Value{}, err
+		}
+	}
+
+	if topLevel {
+		return ptr, nil
+	}
+	return ptr.Elem(), nil
+}
+
+var (
+	_ json.Marshaler   = Change{}
+	_ json.Unmarshaler = (*Change)(nil)
+	_ json.Marshaler   = (*ChangeRow)(nil)
+	_ json.Unmarshaler = (*ChangeRow)(nil)
+)
@@ -0,0 +1,187 @@
+package scyllacdc
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+func TestChangeJSONRoundTrip(t *testing.T) {
+	intType := gocql.NewNativeType(4, gocql.TypeInt, "")
+	textType := gocql.NewNativeType(4, gocql.TypeText, "")
+	boolType := gocql.NewNativeType(4, gocql.TypeBoolean, "")
+	listType := gocql.CollectionType{
+		NativeType: gocql.NewNativeType(4, gocql.TypeMap, ""),
+		Key:        gocql.NewNativeType(4, gocql.TypeTimeUUID, ""),
+		Elem:       intType,
+	}
+	tupleType := gocql.TupleTypeInfo{
+		NativeType: gocql.NewNativeType(4, gocql.TypeTuple, ""),
+		Elems:      []gocql.TypeInfo{intType, textType},
+	}
+	udtType := gocql.UDTTypeInfo{
+		NativeType: gocql.NewNativeType(4, gocql.TypeUDT, ""),
+		KeySpace:   "ks",
+		Name:       "udt",
+		Elements: []gocql.UDTField{
+			{Name: "a", Type: intType},
+			{Name: "b", Type: textType},
+		},
+	}
+
+	ds := NewInMemoryDataSource()
+	err := ds.AddTable("ks", "tbl", []gocql.ColumnInfo{
+		{Name: "pk", TypeInfo: intType},
+		{Name: "v", TypeInfo: textType},
+		{Name: "b", TypeInfo: gocql.NewNativeType(4, gocql.TypeBlob, "")},
+		{Name: "d", TypeInfo: gocql.NewNativeType(4, gocql.TypeDouble, "")},
+		{Name: "vi", TypeInfo: gocql.NewNativeType(4, gocql.TypeVarint, "")},
+		{Name: "ts", TypeInfo: gocql.NewNativeType(4, gocql.TypeTimestamp, "")},
+		{Name: "l", TypeInfo: listType},
+		{Name: "tup", TypeInfo: tupleType},
+		{Name: "u", TypeInfo: udtType},
+		{Name: "cdc$deleted_v", TypeInfo: boolType},
+		{Name: "cdc$deleted_elements_l", TypeInfo: gocql.CollectionType{
+			NativeType: gocql.NewNativeType(4, gocql.TypeSet, ""),
+			Elem:       gocql.NewNativeType(4, gocql.TypeTimeUUID, ""),
+		}},
+	}, TableCDCOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	pk, d, deleted, a := 1, math.Inf(-1), true, 7
+	vi := big.NewInt(0).Lsh(big.NewInt(1), 100)
+	ts := time.Date(2021, 1, 2, 3, 4, 5, 6000000, time.UTC)
+	listKeys := []gocql.UUID{
+		gocql.UUIDFromTime(now.Add(-2 * time.Second)),
+		gocql.UUIDFromTime(now.Add(-1 * time.Second)),
+	}
+
+	streamID := StreamID{0x0A, 0x0B}
+	cdcTime := gocql.UUIDFromTime(now)
+	err = ds.AddChange("ks", "tbl", streamID, cdcTime,
+		InMemoryLogRow{
+			Operation: Update,
+			TTL:       3600,
+			Values: map[string]interface{}{
+				"pk":                     &pk,
+				"b":                      []byte{},
+				"d":                      &d,
+				"vi":                     &vi,
+				"ts":                     &ts,
+				"l":                      map[gocql.UUID]int{listKeys[1]: 2, listKeys[0]: 1},
+				"tup":                    []interface{}{&a, (*string)(nil)},
+				"u":                      map[string]interface{}{"a": &a, "b": (*string)(nil)},
+				"cdc$deleted_v":          &deleted,
+				"cdc$deleted_elements_l": []gocql.UUID{listKeys[0]},
+			},
+		},
+		InMemoryLogRow{
+			Operation: PostImage,
+			Values:    map[string]interface{}{"pk": &pk},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iter, err := ds.QueryRange(context.Background(), QueryRangeInput{
+		KeyspaceName: "ks",
+		TableName:    "tbl",
+		Streams:      []StreamID{streamID},
+		Start:        gocql.MinTimeUUID(now.Add(-time.Second)),
+		End:          gocql.MaxTimeUUID(now),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	change := Change{
+		StreamID:  streamID,
+		Time:      cdcTime,
+		Delta:     []*ChangeRow{iter.Next()},
+		PostImage: []*ChangeRow{iter.Next()},
+	}
+
+	encoded, err := json.Marshal(change)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fragment := range []string{
+		`"version":1`,
+		`"stream_id":"0a0b"`,
+		`"operation":"UPDATE"`,
+		`"ttl":3600`,
+		`{"name":"v","type":{"type":"text"},"value":null}`,
+		`{"name":"b","type":{"type":"blob"},"value":""}`,
+		`{"name":"d","type":{"type":"double"},"value":"-Infinity"}`,
+		`"value":1267650600228229401496703205376`,
+		`"value":[[` + `"` + listKeys[0].String() + `",1],["` + listKeys[1].String() + `",2]]`,
+		`"value":[7,null]`,
+		`"value":{"a":7,"b":null}`,
+		`{"name":"cdc$time","type":{"type":"timeuuid"}}`,
+	} {
+		if !strings.Contains(string(encoded), fragment) {
+			t.Errorf("expected the encoding to contain %s, got %s", fragment, encoded)
+		}
+	}
+
+	var decoded Change
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(decoded.StreamID, change.StreamID) || decoded.Time != change.Time {
+		t.Errorf("expected stream %s and time %s, got %s and %s", change.StreamID, change.Time, decoded.StreamID, decoded.Time)
+	}
+	if len(decoded.PreImage) != 0 || len(decoded.Delta) != 1 || len(decoded.PostImage) != 1 {
+		t.Fatalf("unexpected number of decoded rows: %d, %d, %d", len(decoded.PreImage), len(decoded.Delta), len(decoded.PostImage))
+	}
+
+	original, row := change.Delta[0], decoded.Delta[0]
+	if row.GetOperation() != Update || row.GetTTL() != 3600 || row.cdcCols.endOfBatch {
+		t.Errorf("unexpected metadata of the decoded row: %s, %d, %t", row.GetOperation(), row.GetTTL(), row.cdcCols.endOfBatch)
+	}
+	if !sameColumns(original.Columns(), row.Columns()) {
+		t.Errorf("expected columns %v, got %v", original.Columns(), row.Columns())
+	}
+	for _, col := range []string{"pk", "v", "b", "vi", "ts", "l", "tup", "u", "cdc$deleted_v", "cdc$deleted_elements_l"} {
+		expected, _ := original.GetValue(col)
+		actual, _ := row.GetValue(col)
+		if !reflect.DeepEqual(expected, actual) {
+			t.Errorf("column %s: expected %#v, got %#v", col, expected, actual)
+		}
+	}
+	if dv, _ := row.GetValue("d"); !math.IsInf(*dv.(*float64), -1) {
+		t.Errorf("column d: expected -Inf, got %v", *dv.(*float64))
+	}
+
+	// Encoding of the decoded change should be the same
+	reencoded, err := json.Marshal(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(encoded) != string(reencoded) {
+		t.Errorf("expected the encoding to be stable, got:\n%s\n%s", encoded, reencoded)
+	}
+}
+
+func TestChangeJSONRejectsUnknownVersion(t *testing.T) {
+	var change Change
+	if err := json.Unmarshal([]byte(`{"version":2,"stream_id":"0a"}`), &change); err == nil {
+		t.Error("expected an error when decoding an unknown version")
+	}
+
+	var row ChangeRow
+	if err := json.Unmarshal([]byte(`{"version":1,"operation":"SOMETHING"}`), &row); err == nil {
+		t.Error("expected an error when decoding an unknown operation")
+	}
+}
@@ -0,0 +1,414 @@
+package scyllacdc
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// InMemoryDataSource is a DataSource which keeps generations, CDC log rows
+// and table options in memory. It allows running the Reader against
+// synthetic data without a live cluster, e.g. in unit tests of consumers.
+//
+// All methods are safe to call concurrently, also while a Reader is
+// running with this data source.
+type InMemoryDataSource struct {
+	mu          sync.Mutex
+	generations []inMemoryGeneration
+	tables      map[string]*inMemoryTable
+
+	// Generations of tables which have their own generations,
+	// indexed by fully qualified table name
+	tableGenerations map[string][]inMemoryGeneration
+}
+
+type inMemoryGeneration struct {
+	startTime time.Time
+	streams   []StreamID
+}
+
+type inMemoryTable struct {
+	options        TableCDCOptions
+	colInfos       []gocql.ColumnInfo
+	fieldNameToIdx map[string]int
+	rows           []*ChangeRow
+}
+
+// InMemoryLogRow describes a single row of a CDC log table which is added
+// to the InMemoryDataSource.
+type InMemoryLogRow struct {
+	// Corresponds to cdc$operation.
+	Operation OperationType
+
+	// Corresponds to cdc$ttl.
+	TTL int64
+
+	// Values of the columns of the CDC log table, indexed by column name,
+	// e.g. "pk", "v" or "cdc$deleted_v". The values must have the same
+	// representation as the one described in the ChangeRow documentation.
+	// Columns which are not present in the map are set to null.
+	Values map[string]interface{}
+}
+
+// Columns which are present in every CDC log table.
+var cdcMetadataColumns = []struct {
+	name string
+	typ  gocql.Type
+}{
+	{"cdc$stream_id", gocql.TypeBlob},
+	{"cdc$time", gocql.TypeTimeUUID},
+	{"cdc$batch_seq_no", gocql.TypeInt},
+	{"cdc$end_of_batch", gocql.TypeBoolean},
+	{"cdc$operation", gocql.TypeTinyInt},
+	{"cdc$ttl", gocql.TypeBigInt},
+}
+
+// NewInMemoryDataSource creates a new, empty InMemoryDataSource.
+func NewInMemoryDataSource() *InMemoryDataSource {
+	return &InMemoryDataSource{
+		tables:           make(map[string]*inMemoryTable),
+		tableGenerations: make(map[string][]inMemoryGeneration),
+	}
+}
+
+// AddGeneration adds a generation started at given timestamp which consists
+// of given streams.
+func (ds *InMemoryDataSource) AddGeneration(startTime time.Time, streams []StreamID) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	ds.generations = append(ds.generations, inMemoryGeneration{
+		startTime: startTime,
+		streams:   append([]StreamID{}, streams...),
+	})
+}
+
+// AddTableGeneration adds a generation of given table started at given
+// timestamp which consists of given streams. After a generation is added
+// for a table, the table is considered to have its own generations, like
+// tables of tablet-based keyspaces, and doesn't use the generations added
+// with AddGeneration.
+func (ds *InMemoryDataSource) AddTableGeneration(keyspaceName, tableName string, startTime time.Time, streams []StreamID) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	fullName := keyspaceName + "." + tableName
+	ds.tableGenerations[fullName] = append(ds.tableGenerations[fullName], inMemoryGeneration{
+		startTime: startTime,
+		streams:   append([]StreamID{}, streams...),
+	})
+}
+
+// AddTable adds a table with CDC enabled. The columns argument describes
+// non-metadata columns of the CDC log table - columns of the base table
+// and, optionally, their cdc$deleted_ and cdc$deleted_elements_ companions.
+// Metadata columns such as cdc$stream_id or cdc$time are added automatically.
+func (ds *InMemoryDataSource) AddTable(keyspaceName, tableName string, columns []gocql.ColumnInfo, options TableCDCOptions) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	fullName := keyspaceName + "." + tableName
+	if _, ok := ds.tables[fullName]; ok {
+		return fmt.Errorf("table %s already exists", fullName)
+	}
+
+	colInfos, fieldNameToIdx, err := makeInMemoryLogColumns(keyspaceName, tableName, columns)
+	if err != nil {
+		return err
+	}
+
+	ds.tables[fullName] = &inMemoryTable{
+		options:        options,
+		colInfos:       colInfos,
+		fieldNameToIdx: fieldNameToIdx,
+	}
+	return nil
+}
+
+// AlterTable replaces non-metadata columns of the CDC log table of given
+// table, the same way as described in AddTable. Rows which were already
+// added are migrated to the new schema: values of dropped columns are
+// removed, and values of new columns are set to null.
+func (ds *InMemoryDataSource) AlterTable(keyspaceName, tableName string, columns []gocql.ColumnInfo) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	tbl, ok := ds.tables[keyspaceName+"."+tableName]
+	if !ok {
+		return fmt.Errorf("no such table: %s.%s", keyspaceName, tableName)
+	}
+
+	colInfos, fieldNameToIdx, err := makeInMemoryLogColumns(keyspaceName, tableName, columns)
+	if err != nil {
+		return err
+	}
+
+	// Rows could have already been returned by an iterator, so they
+	// are replaced instead of being modified
+	rows := make([]*ChangeRow, 0, len(tbl.rows))
+	for _, row := range tbl.rows {
+		data := make([]interface{}, len(colInfos))
+		for idx, col := range colInfos {
+			if oldIdx, ok := tbl.fieldNameToIdx[col.Name]; ok && idx >= len(cdcMetadataColumns) &&
+				typeInfoString(tbl.colInfos[oldIdx].TypeInfo) == typeInfoString(col.TypeInfo) {
+				data[idx] = row.data[oldIdx]
+			} else {
+				data[idx] = nullValueForType(col.TypeInfo)
+			}
+		}
+		newRow := *row
+		newRow.fieldNameToIdx = fieldNameToIdx
+		newRow.data = data
+		newRow.colInfos = colInfos
+		rows = append(rows, &newRow)
+	}
+
+	tbl.colInfos = colInfos
+	tbl.fieldNameToIdx = fieldNameToIdx
+	tbl.rows = rows
+	return nil
+}
+
+func makeInMemoryLogColumns(keyspaceName, tableName string, columns []gocql.ColumnInfo) ([]gocql.ColumnInfo, map[string]int, error) {
+	colInfos := make([]gocql.ColumnInfo, 0, len(cdcMetadataColumns)+len(columns))
+	for _, col := range cdcMetadataColumns {
+		colInfos = append(colInfos, gocql.ColumnInfo{
+			Name:     col.name,
+			TypeInfo: gocql.NewNativeType(4, col.typ, ""),
+		})
+	}
+	for _, col := range columns {
+		if strings.HasPrefix(col.Name, "cdc$") && !strings.HasPrefix(col.Name, "cdc$deleted_") {
+			return nil, nil, fmt.Errorf("column %s is a metadata column and cannot be specified", col.Name)
+		}
+		colInfos = append(colInfos, col)
+	}
+
+	fieldNameToIdx := make(map[string]int, len(colInfos))
+	for i := range colInfos {
+		colInfos[i].Keyspace = keyspaceName
+		colInfos[i].Table = tableName + cdcTableSuffix
+		fieldNameToIdx[colInfos[i].Name] = i
+	}
+	return colInfos, fieldNameToIdx, nil
+}
+
+// AddChange adds rows of a single change to the CDC log of given table.
+// All rows will share the same cdc$stream_id and cdc$time; cdc$batch_seq_no
+// and cdc$end_of_batch are assigned according to the order of the rows.
+func (ds *InMemoryDataSource) AddChange(keyspaceName, tableName string, streamID StreamID, cdcTime gocql.UUID, rows ...InMemoryLogRow) error {
+	if len(rows) == 0 {
+		return fmt.Errorf("no rows specified for change %s in stream %s", cdcTime, streamID)
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	tbl, ok := ds.tables[keyspaceName+"."+tableName]
+	if !ok {
+		return fmt.Errorf("no such table: %s.%s", keyspaceName, tableName)
+	}
+
+	changeRows := make([]*ChangeRow, 0, len(rows))
+	for i, row := range rows {
+		data := make([]interface{}, len(tbl.colInfos))
+		for idx, col := range tbl.colInfos[len(cdcMetadataColumns):] {
+			data[len(cdcMetadataColumns)+idx] = nullValueForType(col.TypeInfo)
+		}
+		for name, v := range row.Values {
+			idx, ok := tbl.fieldNameToIdx[name]
+			if !ok || idx < len(cdcMetadataColumns) {
+				return fmt.Errorf("no such column in %s.%s%s: %s", keyspaceName, tableName, cdcTableSuffix, name)
+			}
+			data[idx] = v
+		}
+
+		changeRows = append(changeRows, &ChangeRow{
+			fieldNameToIdx: tbl.fieldNameToIdx,
+
+			data:     data,
+			colInfos: tbl.colInfos,
+
+			batchCols: cdcChangeBatchCols{
+				streamID: append([]byte{}, streamID...),
+				time:     cdcTime,
+			},
+			cdcCols: cdcChangeRowCols{
+				batchSeqNo: int32(i),
+				operation:  int8(row.Operation),
+				ttl:        row.TTL,
+				endOfBatch: i == len(rows)-1,
+			},
+		})
+	}
+
+	tbl.rows = append(tbl.rows, changeRows...)
+	return nil
+}
+
+// GetGenerationTimes is needed to implement the DataSource interface.
+func (ds *InMemoryDataSource) GetGenerationTimes(ctx context.Context) ([]time.Time, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	times := make([]time.Time, 0, len(ds.generations))
+	for _, gen := range ds.generations {
+		times = append(times, gen.startTime)
+	}
+	return times, nil
+}
+
+// GetGenerationStreams is needed to implement the DataSource interface.
+func (ds *InMemoryDataSource) GetGenerationStreams(ctx context.Context, genTime time.Time) ([]StreamID, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	return getInMemoryGenerationStreams(ds.generations, genTime)
+}
+
+// HasTableGenerations is needed to implement the DataSourceWithTableGenerations interface.
+func (ds *InMemoryDataSource) HasTableGenerations(ctx context.Context, keyspaceName, tableName string) (bool, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	_, ok := ds.tableGenerations[keyspaceName+"."+tableName]
+	return ok, nil
+}
+
+// GetTableGenerationTimes is needed to implement the DataSourceWithTableGenerations interface.
+func (ds *InMemoryDataSource) GetTableGenerationTimes(ctx context.Context, keyspaceName, tableName string) ([]time.Time, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	generations := ds.tableGenerations[keyspaceName+"."+tableName]
+	times := make([]time.Time, 0, len(generations))
+	for _, gen := range generations {
+		times = append(times, gen.startTime)
+	}
+	return times, nil
+}
+
+// GetTableGenerationStreams is needed to implement the DataSourceWithTableGenerations interface.
+func (ds *InMemoryDataSource) GetTableGenerationStreams(ctx context.Context, keyspaceName, tableName string, genTime time.Time) ([]StreamID, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	return getInMemoryGenerationStreams(ds.tableGenerations[keyspaceName+"."+tableName], genTime)
+}
+
+func getInMemoryGenerationStreams(generations []inMemoryGeneration, genTime time.Time) ([]StreamID, error) {
+	for _, gen := range generations {
+		if gen.startTime.Equal(genTime) {
+			return append([]StreamID{}, gen.streams...), nil
+		}
+	}
+	return nil, fmt.Errorf("no generation with timestamp %s", genTime)
+}
+
+// QueryRange is needed to implement the DataSource interface.
+func (ds *InMemoryDataSource) QueryRange(ctx context.Context, input QueryRangeInput) (ChangeRowIterator, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	tbl, ok := ds.tables[input.KeyspaceName+"."+input.TableName]
+	if !ok {
+		return nil, fmt.Errorf("no such table: %s.%s", input.KeyspaceName, input.TableName)
+	}
+
+	streams := make(map[string]struct{}, len(input.Streams))
+	for _, stream := range input.Streams {
+		streams[string(stream)] = struct{}{}
+	}
+
+	var rows []*ChangeRow
+	for _, row := range tbl.rows {
+		if _, ok := streams[string(row.batchCols.streamID)]; !ok {
+			continue
+		}
+		if compareTimeuuid(input.Start, row.batchCols.time) < 0 && compareTimeuuid(row.batchCols.time, input.End) <= 0 {
+			rows = append(rows, row)
+		}
+	}
+
+	// Order the rows in the same way as they are ordered in a CDC log partition
+	sort.SliceStable(rows, func(i, j int) bool {
+		if si, sj := string(rows[i].batchCols.streamID), string(rows[j].batchCols.streamID); si != sj {
+			return si < sj
+		}
+		if cmp := compareTimeuuid(rows[i].batchCols.time, rows[j].batchCols.time); cmp != 0 {
+			return cmp < 0
+		}
+		return rows[i].cdcCols.batchSeqNo < rows[j].cdcCols.batchSeqNo
+	})
+
+	if input.Columns != nil {
+		rows = projectInMemoryRows(tbl, rows, makeColumnSet(input.Columns))
+	}
+
+	return &sliceChangeRowIterator{rows: rows}, nil
+}
+
+// GetTableCDCOptions is needed to implement the DataSource interface.
+func (ds *InMemoryDataSource) GetTableCDCOptions(ctx context.Context, keyspaceName, tableName string) (TableCDCOptions, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	tbl, ok := ds.tables[keyspaceName+"."+tableName]
+	if !ok {
+		return TableCDCOptions{}, fmt.Errorf("no such table: %s.%s", keyspaceName, tableName)
+	}
+	return tbl.options, nil
+}
+
+// Returns copies of the rows which contain only projected columns.
+func projectInMemoryRows(tbl *inMemoryTable, rows []*ChangeRow, projectedCols map[string]struct{}) []*ChangeRow {
+	var colInfos []gocql.ColumnInfo
+	var indices []int
+	fieldNameToIdx := make(map[string]int)
+	for idx, col := range tbl.colInfos {
+		if isLogColumnProjected(col.Name, projectedCols) {
+			fieldNameToIdx[col.Name] = len(colInfos)
+			colInfos = append(colInfos, col)
+			indices = append(indices, idx)
+		}
+	}
+
+	projected := make([]*ChangeRow, 0, len(rows))
+	for _, row := range rows {
+		data := make([]interface{}, len(indices))
+		for i, idx := range indices {
+			data[i] = row.data[idx]
+		}
+		newRow := *row
+		newRow.fieldNameToIdx = fieldNameToIdx
+		newRow.data = data
+		newRow.colInfos = colInfos
+		projected = append(projected, &newRow)
+	}
+	return projected
+}
+
+type sliceChangeRowIterator struct {
+	rows []*ChangeRow
+}
+
+func (sri *sliceChangeRowIterator) Next() *ChangeRow {
+	if len(sri.rows) == 0 {
+		return nil
+	}
+	row := sri.rows[0]
+	sri.rows = sri.rows[1:]
+	return row
+}
+
+func (sri *sliceChangeRowIterator) Close() error {
+	return nil
+}
+
+var _ DataSource = (*InMemoryDataSource)(nil)
+var _ DataSourceWithTableGenerations = (*InMemoryDataSource)(nil)
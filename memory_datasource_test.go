@@ -0,0 +1,237 @@
+package scyllacdc
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+type collectingConsumer struct {
+	mu      *sync.Mutex
+	changes map[string][]Change
+	ended   int
+}
+
+func newCollectingConsumer() *collectingConsumer {
+	return &collectingConsumer{
+		mu:      &sync.Mutex{},
+		changes: make(map[string][]Change),
+	}
+}
+
+func (cc *collectingConsumer) CreateChangeConsumer(
+	ctx context.Context,
+	input CreateChangeConsumerInput,
+) (ChangeConsumer, error) {
+	return &collectingStreamConsumer{cc}, nil
+}
+
+func (cc *collectingConsumer) GetChanges(streamID StreamID) []Change {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return append([]Change{}, cc.changes[string(streamID)]...)
+}
+
+func (cc *collectingConsumer) GetEndedCount() int {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.ended
+}
+
+type collectingStreamConsumer struct {
+	cc *collectingConsumer
+}
+
+func (csc *collectingStreamConsumer) Consume(ctx context.Context, change Change) error {
+	csc.cc.mu.Lock()
+	csc.cc.changes[string(change.StreamID)] = append(csc.cc.changes[string(change.StreamID)], change)
+	csc.cc.mu.Unlock()
+	return nil
+}
+
+func (csc *collectingStreamConsumer) End() error {
+	csc.cc.mu.Lock()
+	csc.cc.ended++
+	csc.cc.mu.Unlock()
+	return nil
+}
+
+var testAdvancedConfig = AdvancedReaderConfig{
+	ChangeAgeLimit:         2 * time.Minute,
+	PostNonEmptyQueryDelay: 10 * time.Millisecond,
+	PostEmptyQueryDelay:    10 * time.Millisecond,
+	PostFailedQueryDelay:   10 * time.Millisecond,
+	QueryTimeWindowSize:    time.Minute,
+	ConfidenceWindowSize:   time.Millisecond,
+}
+
+func newTestInMemoryTable(t *testing.T, ds *InMemoryDataSource, tableName string) {
+	err := ds.AddTable("ks", tableName, []gocql.ColumnInfo{
+		{Name: "pk", TypeInfo: gocql.NewNativeType(4, gocql.TypeInt, "")},
+		{Name: "v", TypeInfo: gocql.NewNativeType(4, gocql.TypeInt, "")},
+		{Name: "cdc$deleted_v", TypeInfo: gocql.NewNativeType(4, gocql.TypeBoolean, "")},
+	}, TableCDCOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func addTestUpdate(t *testing.T, ds *InMemoryDataSource, tableName string, streamID StreamID, at time.Time, pk, v int) gocql.UUID {
+	cdcTime := gocql.UUIDFromTime(at)
+	err := ds.AddChange("ks", tableName, streamID, cdcTime, InMemoryLogRow{
+		Operation: Update,
+		Values:    map[string]interface{}{"pk": &pk, "v": &v},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cdcTime
+}
+
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) {
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReaderWithInMemoryDataSource(t *testing.T) {
+	now := time.Now()
+	streamA := StreamID{0x0A}
+	streamB := StreamID{0x0B}
+	streamC := StreamID{0x0C}
+
+	ds := NewInMemoryDataSource()
+	ds.AddGeneration(now.Add(-time.Hour), []StreamID{streamA, streamB})
+	ds.AddGeneration(now.Add(-30*time.Second), []StreamID{streamC})
+	newTestInMemoryTable(t, ds, "tbl")
+
+	// Too old, should be skipped because of ChangeAgeLimit
+	addTestUpdate(t, ds, "tbl", streamA, now.Add(-5*time.Minute), 1, 0)
+
+	expectedA := []gocql.UUID{
+		addTestUpdate(t, ds, "tbl", streamA, now.Add(-90*time.Second), 1, 1),
+		addTestUpdate(t, ds, "tbl", streamA, now.Add(-60*time.Second), 1, 2),
+	}
+	expectedB := []gocql.UUID{
+		addTestUpdate(t, ds, "tbl", streamB, now.Add(-80*time.Second), 2, 1),
+	}
+	expectedC := []gocql.UUID{
+		addTestUpdate(t, ds, "tbl", streamC, now.Add(-20*time.Second), 3, 1),
+	}
+
+	consumer := newCollectingConsumer()
+	cfg := &ReaderConfig{
+		DataSource:            ds,
+		ChangeConsumerFactory: consumer,
+		TableNames:            []string{"ks.tbl"},
+		Advanced:              testAdvancedConfig,
+	}
+
+	reader, err := NewReader(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errC := make(chan error)
+	go func() { errC <- reader.Run(context.Background()) }()
+
+	waitFor(t, 5*time.Second, func() bool {
+		return len(consumer.GetChanges(streamC)) == len(expectedC)
+	})
+
+	reader.StopAt(time.Now())
+	if err := <-errC; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		streamID StreamID
+		expected []gocql.UUID
+	}{
+		{streamA, expectedA},
+		{streamB, expectedB},
+		{streamC, expectedC},
+	} {
+		changes := consumer.GetChanges(tc.streamID)
+		if len(changes) != len(tc.expected) {
+			t.Fatalf("expected %d changes in stream %s, got %d", len(tc.expected), tc.streamID, len(changes))
+		}
+		for i, change := range changes {
+			if change.Time != tc.expected[i] {
+				t.Errorf("expected change %d in stream %s to have time %s, got %s", i, tc.streamID, tc.expected[i], change.Time)
+			}
+			if len(change.Delta) != 1 {
+				t.Fatalf("expected one delta row, got %d", len(change.Delta))
+			}
+			if isDeleted, _ := change.Delta[0].IsDeleted("v"); isDeleted {
+				t.Errorf("column v should not be marked as deleted")
+			}
+		}
+	}
+
+	// Consumers for both generations should have been ended
+	if ended := consumer.GetEndedCount(); ended != 3 {
+		t.Errorf("expected 3 consumers to be ended, got %d", ended)
+	}
+}
+
+func TestInMemoryDataSourceQueryRange(t *testing.T) {
+	now := time.Now()
+	streamA := StreamID{0x0A}
+	streamB := StreamID{0x0B}
+
+	ds := NewInMemoryDataSource()
+	newTestInMemoryTable(t, ds, "tbl")
+
+	t1 := addTestUpdate(t, ds, "tbl", streamB, now.Add(-3*time.Second), 1, 1)
+	t2 := addTestUpdate(t, ds, "tbl", streamA, now.Add(-2*time.Second), 1, 2)
+	t3 := addTestUpdate(t, ds, "tbl", streamA, now.Add(-4*time.Second), 1, 3)
+
+	iter, err := ds.QueryRange(context.Background(), QueryRangeInput{
+		KeyspaceName: "ks",
+		TableName:    "tbl",
+		Streams:      []StreamID{streamA, streamB},
+		Start:        t3,
+		End:          gocql.MaxTimeUUID(now),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The start of the range is exclusive, and rows are ordered
+	// by stream first, then by time
+	var times []gocql.UUID
+	for row := iter.Next(); row != nil; row = iter.Next() {
+		times = append(times, row.batchCols.time)
+
+		// Columns absent from the row should be typed nulls
+		v, ok := row.GetValue("cdc$deleted_v")
+		if !ok || v.(*bool) != nil {
+			t.Errorf("expected cdc$deleted_v to be null, got %v", v)
+		}
+	}
+	if err := iter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []gocql.UUID{t2, t1}
+	if len(times) != len(expected) {
+		t.Fatalf("expected %d rows, got %d", len(expected), len(times))
+	}
+	for i := range expected {
+		if times[i] != expected[i] {
+			t.Errorf("expected row %d to have time %s, got %s", i, expected[i], times[i])
+		}
+	}
+
+	if _, err := ds.QueryRange(context.Background(), QueryRangeInput{KeyspaceName: "ks", TableName: "other"}); err == nil {
+		t.Error("expected an error when querying a non-existing table")
+	}
+}
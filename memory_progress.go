@@ -0,0 +1,241 @@
+package scyllacdc
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// InMemoryProgressManager is a ProgressManager which keeps progress
+// in memory. Progress is lost when the application stops, so it is mostly
+// useful in tests: it can be pre-seeded with progress in order to check
+// how a consumer resumes its work, and it allows to inspect the progress
+// saved by consumers.
+//
+// All methods are safe to call concurrently, also while a Reader is
+// running with this progress manager.
+type InMemoryProgressManager struct {
+	mu                       sync.Mutex
+	currentGeneration        time.Time
+	applicationReadStartTime time.Time
+	tableReadStartTimes      map[string]time.Time
+	tableGenerations         map[string]time.Time
+	generationHistory        []time.Time
+	progress                 map[inMemoryProgressKey]Progress
+}
+
+type inMemoryProgressKey struct {
+	gen      int64
+	table    string
+	streamID string
+}
+
+// NewInMemoryProgressManager creates a new, empty InMemoryProgressManager.
+func NewInMemoryProgressManager() *InMemoryProgressManager {
+	return &InMemoryProgressManager{
+		tableReadStartTimes: make(map[string]time.Time),
+		tableGenerations:    make(map[string]time.Time),
+		progress:            make(map[inMemoryProgressKey]Progress),
+	}
+}
+
+// SetCurrentGeneration sets the generation returned by GetCurrentGeneration.
+// Unlike StartGeneration, it is not recorded in the generation history.
+func (impm *InMemoryProgressManager) SetCurrentGeneration(gen time.Time) {
+	impm.mu.Lock()
+	defer impm.mu.Unlock()
+	impm.currentGeneration = gen
+}
+
+// GetCurrentGeneration is needed to implement the ProgressManager interface.
+func (impm *InMemoryProgressManager) GetCurrentGeneration(ctx context.Context) (time.Time, error) {
+	impm.mu.Lock()
+	defer impm.mu.Unlock()
+	return impm.currentGeneration, nil
+}
+
+// StartGeneration is needed to implement the ProgressManager interface.
+func (impm *InMemoryProgressManager) StartGeneration(ctx context.Context, gen time.Time) error {
+	impm.mu.Lock()
+	defer impm.mu.Unlock()
+	impm.currentGeneration = gen
+	impm.generationHistory = append(impm.generationHistory, gen)
+	return nil
+}
+
+// GetProgress is needed to implement the ProgressManager interface.
+func (impm *InMemoryProgressManager) GetProgress(ctx context.Context, gen time.Time, table string, streamID StreamID) (Progress, error) {
+	impm.mu.Lock()
+	defer impm.mu.Unlock()
+	return impm.progress[makeInMemoryProgressKey(gen, table, streamID)], nil
+}
+
+// SaveProgress is needed to implement the ProgressManager interface.
+// It can also be used to pre-seed progress of a stream.
+func (impm *InMemoryProgressManager) SaveProgress(ctx context.Context, gen time.Time, table string, streamID StreamID, progress Progress) error {
+	impm.mu.Lock()
+	defer impm.mu.Unlock()
+	impm.progress[makeInMemoryProgressKey(gen, table, streamID)] = progress
+	return nil
+}
+
+// SaveApplicationReadStartTime is needed to implement the ProgressManagerWithStartTime interface.
+// It can also be used to pre-seed the start time.
+func (impm *InMemoryProgressManager) SaveApplicationReadStartTime(ctx context.Context, startTime time.Time) error {
+	impm.mu.Lock()
+	defer impm.mu.Unlock()
+	impm.applicationReadStartTime = startTime
+	return nil
+}
+
+// GetApplicationReadStartTime is needed to implement the ProgressManagerWithStartTime interface.
+func (impm *InMemoryProgressManager) GetApplicationReadStartTime(ctx context.Context) (time.Time, error) {
+	impm.mu.Lock()
+	defer impm.mu.Unlock()
+	return impm.applicationReadStartTime, nil
+}
+
+// SaveTableReadStartTime is needed to implement the ProgressManagerWithTableStartTime interface.
+// It can also be used to pre-seed the start time of a table.
+func (impm *InMemoryProgressManager) SaveTableReadStartTime(ctx context.Context, table string, startTime time.Time) error {
+	impm.mu.Lock()
+	defer impm.mu.Unlock()
+	impm.tableReadStartTimes[table] = startTime
+	return nil
+}
+
+// GetTableReadStartTime is needed to implement the ProgressManagerWithTableStartTime interface.
+func (impm *InMemoryProgressManager) GetTableReadStartTime(ctx context.Context, table string) (time.Time, error) {
+	impm.mu.Lock()
+	defer impm.mu.Unlock()
+	return impm.tableReadStartTimes[table], nil
+}
+
+// ListTableReadStartTimes is needed to implement the ProgressManagerWithTableStartTime interface.
+func (impm *InMemoryProgressManager) ListTableReadStartTimes(ctx context.Context) (map[string]time.Time, error) {
+	impm.mu.Lock()
+	defer impm.mu.Unlock()
+	startTimes := make(map[string]time.Time, len(impm.tableReadStartTimes))
+	for table, startTime := range impm.tableReadStartTimes {
+		startTimes[table] = startTime
+	}
+	return startTimes, nil
+}
+
+// StartTableGeneration is needed to implement the ProgressManagerWithTableGeneration interface.
+// It can also be used to pre-seed the generation of a table.
+func (impm *InMemoryProgressManager) StartTableGeneration(ctx context.Context, table string, gen time.Time) error {
+	impm.mu.Lock()
+	defer impm.mu.Unlock()
+	impm.tableGenerations[table] = gen
+	return nil
+}
+
+// GetTableGeneration is needed to implement the ProgressManagerWithTableGeneration interface.
+func (impm *InMemoryProgressManager) GetTableGeneration(ctx context.Context, table string) (time.Time, error) {
+	impm.mu.Lock()
+	defer impm.mu.Unlock()
+	return impm.tableGenerations[table], nil
+}
+
+// ListTableGenerations is needed to implement the ProgressManagerWithTableGeneration interface.
+func (impm *InMemoryProgressManager) ListTableGenerations(ctx context.Context) (map[string]time.Time, error) {
+	impm.mu.Lock()
+	defer impm.mu.Unlock()
+	gens := make(map[string]time.Time, len(impm.tableGenerations))
+	for table, gen := range impm.tableGenerations {
+		gens[table] = gen
+	}
+	return gens, nil
+}
+
+// GetSavedProgress returns progress saved for given stream of a table
+// in a given generation. The second value is false if no progress was saved.
+func (impm *InMemoryProgressManager) GetSavedProgress(gen time.Time, table string, streamID StreamID) (Progress, bool) {
+	impm.mu.Lock()
+	defer impm.mu.Unlock()
+	progress, ok := impm.progress[makeInMemoryProgressKey(gen, table, streamID)]
+	return progress, ok
+}
+
+// GetTableProgress returns progress saved for streams of given table
+// in a given generation, indexed by stream ID converted to string.
+func (impm *InMemoryProgressManager) GetTableProgress(gen time.Time, table string) map[string]Progress {
+	impm.mu.Lock()
+	defer impm.mu.Unlock()
+
+	ret := make(map[string]Progress)
+	for key, progress := range impm.progress {
+		if key.gen == gen.UnixNano() && key.table == table {
+			ret[key.streamID] = progress
+		}
+	}
+	return ret
+}
+
+// GetGenerationHistory returns generations passed to StartGeneration,
+// in the order of calls.
+func (impm *InMemoryProgressManager) GetGenerationHistory() []time.Time {
+	impm.mu.Lock()
+	defer impm.mu.Unlock()
+	return append([]time.Time{}, impm.generationHistory...)
+}
+
+// Snapshot returns all saved progress, ordered by generation, table name
+// and stream ID.
+func (impm *InMemoryProgressManager) Snapshot() []ProgressEntry {
+	impm.mu.Lock()
+	defer impm.mu.Unlock()
+
+	entries := make([]ProgressEntry, 0, len(impm.progress))
+	for key, progress := range impm.progress {
+		entries = append(entries, ProgressEntry{
+			Generation: time.Unix(0, key.gen),
+			TableName:  key.table,
+			StreamID:   StreamID(key.streamID),
+			Progress:   progress,
+		})
+	}
+	sortProgressEntries(entries)
+	return entries
+}
+
+// ListProgress is needed to implement the ProgressManagerWithEnumeration interface.
+func (impm *InMemoryProgressManager) ListProgress(ctx context.Context) ([]ProgressEntry, error) {
+	return impm.Snapshot(), nil
+}
+
+// DeleteProgress is needed to implement the ProgressManagerWithEnumeration interface.
+func (impm *InMemoryProgressManager) DeleteProgress(ctx context.Context, gen time.Time, table string, streamID StreamID) error {
+	impm.mu.Lock()
+	defer impm.mu.Unlock()
+	delete(impm.progress, makeInMemoryProgressKey(gen, table, streamID))
+	return nil
+}
+
+// Clear is needed to implement the ProgressManagerWithEnumeration interface.
+// The generation history is not cleared.
+func (impm *InMemoryProgressManager) Clear(ctx context.Context) error {
+	impm.mu.Lock()
+	defer impm.mu.Unlock()
+	impm.currentGeneration = time.Time{}
+	impm.applicationReadStartTime = time.Time{}
+	impm.tableReadStartTimes = make(map[string]time.Time)
+	impm.tableGenerations = make(map[string]time.Time)
+	impm.progress = make(map[inMemoryProgressKey]Progress)
+	return nil
+}
+
+func makeInMemoryProgressKey(gen time.Time, table string, streamID StreamID) inMemoryProgressKey {
+	return inMemoryProgressKey{
+		gen:      gen.UnixNano(),
+		table:    table,
+		streamID: string(streamID),
+	}
+}
+
+var _ ProgressManager = (*InMemoryProgressManager)(nil)
+var _ ProgressManagerWithStartTime = (*InMemoryProgressManager)(nil)
+var _ ProgressManagerWithTableStartTime = (*InMemoryProgressManager)(nil)
+var _ ProgressManagerWithEnumeration = (*InMemoryProgressManager)(nil)
+var _ ProgressManagerWithTableGeneration = (*InMemoryProgressManager)(nil)
@@ -0,0 +1,169 @@
+package scyllacdc
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Saves progress after each consumed change.
+type progressMarkingConsumer struct {
+	mu       *sync.Mutex
+	consumed []gocql.UUID
+}
+
+func (pmc *progressMarkingConsumer) CreateChangeConsumer(ctx context.Context, input CreateChangeConsumerInput) (ChangeConsumer, error) {
+	return MakeChangeConsumerFactoryFromFunc(func(ctx context.Context, tableName string, change Change) error {
+		pmc.mu.Lock()
+		pmc.consumed = append(pmc.consumed, change.Time)
+		pmc.mu.Unlock()
+		return input.ProgressReporter.MarkProgress(ctx, Progress{change.Time})
+	}).CreateChangeConsumer(ctx, input)
+}
+
+func (pmc *progressMarkingConsumer) getConsumed() []gocql.UUID {
+	pmc.mu.Lock()
+	defer pmc.mu.Unlock()
+	return append([]gocql.UUID{}, pmc.consumed...)
+}
+
+func TestReaderResumesFromInMemoryProgress(t *testing.T) {
+	now := time.Now()
+	gen := now.Add(-time.Hour)
+	streamA := StreamID{0x0A}
+	streamB := StreamID{0x0B}
+
+	ds := NewInMemoryDataSource()
+	ds.AddGeneration(gen, []StreamID{streamA, streamB})
+	newTestInMemoryTable(t, ds, "tbl")
+
+	timesA := []gocql.UUID{
+		addTestUpdate(t, ds, "tbl", streamA, now.Add(-90*time.Second), 1, 1),
+		addTestUpdate(t, ds, "tbl", streamA, now.Add(-80*time.Second), 1, 2),
+	}
+	timeB := addTestUpdate(t, ds, "tbl", streamB, now.Add(-70*time.Second), 2, 1)
+
+	// Pretend that the first change of stream A was already processed
+	progressManager := NewInMemoryProgressManager()
+	progressManager.SetCurrentGeneration(gen)
+	if err := progressManager.SaveProgress(context.Background(), gen, "ks.tbl", streamA, Progress{timesA[0]}); err != nil {
+		t.Fatal(err)
+	}
+
+	consumer := &progressMarkingConsumer{mu: &sync.Mutex{}}
+	cfg := &ReaderConfig{
+		DataSource:            ds,
+		ChangeConsumerFactory: consumer,
+		TableNames:            []string{"ks.tbl"},
+		ProgressManager:       progressManager,
+		Advanced:              testAdvancedConfig,
+	}
+
+	reader, err := NewReader(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errC := make(chan error)
+	go func() { errC <- reader.Run(context.Background()) }()
+
+	waitFor(t, 5*time.Second, func() bool {
+		return len(consumer.getConsumed()) == 2
+	})
+
+	reader.StopAt(time.Now())
+	if err := <-errC; err != nil {
+		t.Fatal(err)
+	}
+
+	consumed := consumer.getConsumed()
+	if len(consumed) != 2 {
+		t.Fatalf("expected 2 changes to be consumed, got %d", len(consumed))
+	}
+	for _, c := range consumed {
+		if c == timesA[0] {
+			t.Error("expected the already processed change not to be consumed again")
+		}
+	}
+
+	tableProgress := progressManager.GetTableProgress(gen, "ks.tbl")
+	if p := tableProgress[string(streamA)]; p.LastProcessedRecordTime != timesA[1] {
+		t.Errorf("expected progress %s for stream A, got %s", timesA[1], p.LastProcessedRecordTime)
+	}
+	if p := tableProgress[string(streamB)]; p.LastProcessedRecordTime != timeB {
+		t.Errorf("expected progress %s for stream B, got %s", timeB, p.LastProcessedRecordTime)
+	}
+	if _, ok := progressManager.GetSavedProgress(gen, "ks.other", streamA); ok {
+		t.Error("expected no progress to be saved for another table")
+	}
+
+	snapshot := progressManager.Snapshot()
+	if len(snapshot) != 2 || string(snapshot[0].StreamID) != string(streamA) || string(snapshot[1].StreamID) != string(streamB) {
+		t.Errorf("unexpected snapshot: %v", snapshot)
+	}
+
+	if history := progressManager.GetGenerationHistory(); len(history) != 1 || !history[0].Equal(gen) {
+		t.Errorf("expected only generation %v to be started, got %v", gen, history)
+	}
+}
+
+func TestInMemoryProgressManagerEnumeration(t *testing.T) {
+	ctx := context.Background()
+	gen := time.Unix(1000, 0)
+	progress := Progress{gocql.UUIDFromTime(gen.Add(time.Second))}
+
+	progressManager := NewInMemoryProgressManager()
+	if err := progressManager.StartGeneration(ctx, gen); err != nil {
+		t.Fatal(err)
+	}
+	if err := progressManager.StartTableGeneration(ctx, "ks.tablets", gen); err != nil {
+		t.Fatal(err)
+	}
+	for _, streamID := range []StreamID{{0x02}, {0x01}} {
+		if err := progressManager.SaveProgress(ctx, gen, "ks.tbl", streamID, progress); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := progressManager.DeleteProgress(ctx, gen, "ks.tbl", StreamID{0x02}); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := progressManager.ListProgress(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].StreamID[0] != 0x01 {
+		t.Fatalf("unexpected progress entries: %v", entries)
+	}
+
+	if err := progressManager.Clear(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := progressManager.ListProgress(ctx); len(entries) != 0 {
+		t.Fatalf("expected no entries after clearing, got %v", entries)
+	}
+	if gen, _ := progressManager.GetCurrentGeneration(ctx); !gen.IsZero() {
+		t.Errorf("expected no current generation after clearing, got %v", gen)
+	}
+	if gen, _ := progressManager.GetTableGeneration(ctx, "ks.tablets"); !gen.IsZero() {
+		t.Errorf("expected no generation of the table after clearing, got %v", gen)
+	}
+}
+
+func TestProgressReporterWithoutStatementSupport(t *testing.T) {
+	reporter := &ProgressReporter{
+		progressManager: NewInMemoryProgressManager(),
+		gen:             time.Unix(1000, 0),
+		tableName:       "ks.tbl",
+		streamID:        StreamID{0x0A},
+	}
+	if reporter.SupportsProgressStatement() {
+		t.Error("expected progress statements not to be supported")
+	}
+	if _, err := reporter.ProgressStatement(context.Background(), Progress{}); err != ErrProgressStatementNotSupported {
+		t.Errorf("expected ErrProgressStatementNotSupported, got %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package scyllacdc
+
+import (
+	"time"
+)
+
+// ReaderMetrics receives measurements of the Reader's activity. It can be
+// used to export metrics to a monitoring system - see the metrics/prometheus
+// package for an adapter which exposes them in the Prometheus format.
+//
+// The methods are called concurrently by all stream batch readers,
+// therefore they need to be thread-safe. They are called on the hot path
+// of the reader, so they should return quickly.
+type ReaderMetrics interface {
+	// ObservePoll is called after each query to the CDC log
+	// of a stream batch, after all returned changes were consumed.
+	ObservePoll(batch StreamBatchInfo, result PollResult)
+
+	// StreamBatchFinished is called when the Reader stops reading
+	// from a stream batch, either because the generation has ended
+	// or the Reader is stopping.
+	StreamBatchFinished(batch StreamBatchInfo)
+}
+
+// StreamBatchInfo identifies a group of streams of a single table which
+// is polled by the Reader using a single query.
+type StreamBatchInfo struct {
+	// Fully qualified name of the base table.
+	TableName string
+
+	// Timestamp of the generation to which the streams belong.
+	GenerationTime time.Time
+
+	// Streams belonging to the batch.
+	Streams []StreamID
+}
+
+// PollResult describes the outcome of a single query to the CDC log.
+type PollResult struct {
+	// Time spent on querying and fetching rows from the CDC log,
+	// not including the time spent in consumers.
+	Latency time.Duration
+
+	// Time spent in Consume calls of the consumers.
+	ConsumerTime time.Duration
+
+	// Number of rows read from the CDC log.
+	Rows int
+
+	// Number of changes delivered to the consumers.
+	Changes int
+
+	// Difference between the moment the query was issued and the lower
+	// bound of the queried time window.
+	Lag time.Duration
+
+	// An error which occurred while querying the CDC log, or nil if
+	// the query succeeded. Errors returned by consumers are not reported
+	// here, as they stop the Reader.
+	Err error
+}
+
+type noReaderMetrics struct{}
+
+func (noReaderMetrics) ObservePoll(batch StreamBatchInfo, result PollResult) {}
+
+func (noReaderMetrics) StreamBatchFinished(batch StreamBatchInfo) {}
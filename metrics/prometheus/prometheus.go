@@ -0,0 +1,236 @@
+// Package prometheus provides an implementation of scyllacdc.ReaderMetrics
+// which exposes metrics of the CDC Reader in the Prometheus text format.
+package prometheus
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	scyllacdc "github.com/scylladb/scylla-cdc-go"
+)
+
+const defaultNamespace = "scylla_cdc"
+
+// Metrics aggregates measurements reported by the Reader per table, and
+// lag per table and stream batch. It implements http.Handler, so it can be
+// registered directly as a scrape endpoint:
+//
+//	metrics := prometheus.NewMetrics("")
+//	cfg.Metrics = metrics
+//	http.Handle("/metrics", metrics)
+type Metrics struct {
+	namespace string
+
+	mu     sync.Mutex
+	tables map[string]*tableMetrics
+	lags   map[lagKey]float64
+}
+
+type tableMetrics struct {
+	emptyPolls    uint64
+	nonEmptyPolls uint64
+	failedPolls   uint64
+
+	rows    uint64
+	changes uint64
+
+	pollSeconds     float64
+	consumerSeconds float64
+}
+
+func (tm *tableMetrics) polls() uint64 {
+	return tm.emptyPolls + tm.nonEmptyPolls + tm.failedPolls
+}
+
+type lagKey struct {
+	table       string
+	streamBatch string
+}
+
+// NewMetrics creates a new Metrics object. All metric names will be
+// prefixed with given namespace; if it is empty, "scylla_cdc" is used.
+func NewMetrics(namespace string) *Metrics {
+	if namespace == "" {
+		namespace = defaultNamespace
+	}
+	return &Metrics{
+		namespace: namespace,
+		tables:    make(map[string]*tableMetrics),
+		lags:      make(map[lagKey]float64),
+	}
+}
+
+// ObservePoll is needed to implement the scyllacdc.ReaderMetrics interface.
+func (m *Metrics) ObservePoll(batch scyllacdc.StreamBatchInfo, result scyllacdc.PollResult) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tm, ok := m.tables[batch.TableName]
+	if !ok {
+		tm = &tableMetrics{}
+		m.tables[batch.TableName] = tm
+	}
+
+	switch {
+	case result.Err != nil:
+		tm.failedPolls++
+	case result.Rows == 0:
+		tm.emptyPolls++
+	default:
+		tm.nonEmptyPolls++
+	}
+
+	tm.rows += uint64(result.Rows)
+	tm.changes += uint64(result.Changes)
+	tm.pollSeconds += result.Latency.Seconds()
+	tm.consumerSeconds += result.ConsumerTime.Seconds()
+
+	m.lags[makeLagKey(batch)] = result.Lag.Seconds()
+}
+
+// StreamBatchFinished is needed to implement the scyllacdc.ReaderMetrics interface.
+func (m *Metrics) StreamBatchFinished(batch scyllacdc.StreamBatchInfo) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.lags, makeLagKey(batch))
+}
+
+// A stream batch is identified by its first stream, which is stable
+// for the whole lifetime of the batch.
+func makeLagKey(batch scyllacdc.StreamBatchInfo) lagKey {
+	key := lagKey{table: batch.TableName}
+	if len(batch.Streams) > 0 {
+		key.streamBatch = batch.Streams[0].String()
+	}
+	return key
+}
+
+// ServeHTTP writes the current values of metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Metrics are rendered first, so that an error can still be reported
+	// before anything is sent
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(buf.Bytes())
+}
+
+// WriteTo writes the current values of metrics in the Prometheus text format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+
+	tableNames := make([]string, 0, len(m.tables))
+	for name := range m.tables {
+		tableNames = append(tableNames, name)
+	}
+	sort.Strings(tableNames)
+
+	writeTableMetric := func(name, typ, help string, get func(tm *tableMetrics) []sample) {
+		cw.header(m.namespace+"_"+name, typ, help)
+		for _, tableName := range tableNames {
+			for _, s := range get(m.tables[tableName]) {
+				labels := append([]string{"table", tableName}, s.labels...)
+				cw.sample(m.namespace+"_"+name+s.suffix, labels, s.value)
+			}
+		}
+	}
+
+	writeTableMetric("reader_polls_total", "counter", "Number of queries to the CDC log.", func(tm *tableMetrics) []sample {
+		return []sample{
+			{labels: []string{"result", "empty"}, value: float64(tm.emptyPolls)},
+			{labels: []string{"result", "non_empty"}, value: float64(tm.nonEmptyPolls)},
+			{labels: []string{"result", "failed"}, value: float64(tm.failedPolls)},
+		}
+	})
+	writeTableMetric("reader_rows_read_total", "counter", "Number of rows read from the CDC log.", func(tm *tableMetrics) []sample {
+		return []sample{{value: float64(tm.rows)}}
+	})
+	writeTableMetric("reader_changes_read_total", "counter", "Number of changes delivered to consumers.", func(tm *tableMetrics) []sample {
+		return []sample{{value: float64(tm.changes)}}
+	})
+	writeTableMetric("reader_poll_duration_seconds", "summary", "Time spent on querying the CDC log.", func(tm *tableMetrics) []sample {
+		return []sample{
+			{suffix: "_sum", value: tm.pollSeconds},
+			{suffix: "_count", value: float64(tm.polls())},
+		}
+	})
+	writeTableMetric("reader_consumer_duration_seconds", "summary", "Time spent in consumers per query to the CDC log.", func(tm *tableMetrics) []sample {
+		return []sample{
+			{suffix: "_sum", value: tm.consumerSeconds},
+			{suffix: "_count", value: float64(tm.polls())},
+		}
+	})
+
+	lagKeys := make([]lagKey, 0, len(m.lags))
+	for key := range m.lags {
+		lagKeys = append(lagKeys, key)
+	}
+	sort.Slice(lagKeys, func(i, j int) bool {
+		if lagKeys[i].table != lagKeys[j].table {
+			return lagKeys[i].table < lagKeys[j].table
+		}
+		return lagKeys[i].streamBatch < lagKeys[j].streamBatch
+	})
+
+	cw.header(m.namespace+"_reader_lag_seconds", "gauge", "Difference between now and the beginning of the last queried time window.")
+	for _, key := range lagKeys {
+		cw.sample(m.namespace+"_reader_lag_seconds", []string{"table", key.table, "stream_batch", key.streamBatch}, m.lags[key])
+	}
+
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+type sample struct {
+	suffix string
+	labels []string
+	value  float64
+}
+
+// Writes to the underlying writer and keeps the first encountered error.
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) printf(format string, args ...interface{}) {
+	if cw.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(cw.w, format, args...)
+	cw.n += int64(n)
+	cw.err = err
+}
+
+func (cw *countingWriter) header(name, typ, help string) {
+	cw.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// Labels are given as a flat list of alternating names and values.
+func (cw *countingWriter) sample(name string, labels []string, value float64) {
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", labels[i], labelValueEscaper.Replace(labels[i+1])))
+	}
+	cw.printf("%s{%s} %v\n", name, strings.Join(pairs, ","), value)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+var _ scyllacdc.ReaderMetrics = (*Metrics)(nil)
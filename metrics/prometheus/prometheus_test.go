@@ -0,0 +1,68 @@
+package prometheus
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	scyllacdc "github.com/scylladb/scylla-cdc-go"
+)
+
+func TestMetricsExposition(t *testing.T) {
+	m := NewMetrics("")
+
+	batch := scyllacdc.StreamBatchInfo{
+		TableName: "ks.tbl",
+		Streams:   []scyllacdc.StreamID{{0x12, 0x34}},
+	}
+
+	m.ObservePoll(batch, scyllacdc.PollResult{
+		Latency:      500 * time.Millisecond,
+		ConsumerTime: 250 * time.Millisecond,
+		Rows:         3,
+		Changes:      2,
+		Lag:          40 * time.Second,
+	})
+	m.ObservePoll(batch, scyllacdc.PollResult{
+		Latency: 500 * time.Millisecond,
+		Lag:     30 * time.Second,
+	})
+	m.ObservePoll(batch, scyllacdc.PollResult{
+		Err: errors.New("timeout"),
+		Lag: 35 * time.Second,
+	})
+
+	var b strings.Builder
+	if _, err := m.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+
+	for _, expected := range []string{
+		`scylla_cdc_reader_polls_total{table="ks.tbl",result="empty"} 1`,
+		`scylla_cdc_reader_polls_total{table="ks.tbl",result="non_empty"} 1`,
+		`scylla_cdc_reader_polls_total{table="ks.tbl",result="failed"} 1`,
+		`scylla_cdc_reader_rows_read_total{table="ks.tbl"} 3`,
+		`scylla_cdc_reader_changes_read_total{table="ks.tbl"} 2`,
+		`scylla_cdc_reader_poll_duration_seconds_sum{table="ks.tbl"} 1`,
+		`scylla_cdc_reader_poll_duration_seconds_count{table="ks.tbl"} 3`,
+		`scylla_cdc_reader_consumer_duration_seconds_sum{table="ks.tbl"} 0.25`,
+		`scylla_cdc_reader_lag_seconds{table="ks.tbl",stream_batch="1234"} 35`,
+		`# TYPE scylla_cdc_reader_lag_seconds gauge`,
+	} {
+		if !strings.Contains(out, expected+"\n") {
+			t.Errorf("expected output to contain %q, got:\n%s", expected, out)
+		}
+	}
+
+	// Lag of a finished batch should not be reported anymore
+	m.StreamBatchFinished(batch)
+	b.Reset()
+	if _, err := m.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(b.String(), "scylla_cdc_reader_lag_seconds{") {
+		t.Errorf("expected no lag samples after the stream batch finished, got:\n%s", b.String())
+	}
+}
@@ -0,0 +1,89 @@
+package scyllacdc
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingMetrics struct {
+	mu       sync.Mutex
+	results  []PollResult
+	finished int
+}
+
+func (rm *recordingMetrics) ObservePoll(batch StreamBatchInfo, result PollResult) {
+	rm.mu.Lock()
+	rm.results = append(rm.results, result)
+	rm.mu.Unlock()
+}
+
+func (rm *recordingMetrics) StreamBatchFinished(batch StreamBatchInfo) {
+	rm.mu.Lock()
+	rm.finished++
+	rm.mu.Unlock()
+}
+
+func (rm *recordingMetrics) GetTotals() (rows, changes int, finished int) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	for _, r := range rm.results {
+		rows += r.Rows
+		changes += r.Changes
+	}
+	return rows, changes, rm.finished
+}
+
+func TestReaderReportsMetrics(t *testing.T) {
+	now := time.Now()
+	streamID := StreamID{0x0A}
+
+	ds := NewInMemoryDataSource()
+	ds.AddGeneration(now.Add(-time.Hour), []StreamID{streamID})
+	newTestInMemoryTable(t, ds, "tbl")
+
+	addTestUpdate(t, ds, "tbl", streamID, now.Add(-90*time.Second), 1, 1)
+	addTestUpdate(t, ds, "tbl", streamID, now.Add(-60*time.Second), 1, 2)
+
+	metrics := &recordingMetrics{}
+	cfg := &ReaderConfig{
+		DataSource:            ds,
+		ChangeConsumerFactory: newCollectingConsumer(),
+		TableNames:            []string{"ks.tbl"},
+		Metrics:               metrics,
+		Advanced:              testAdvancedConfig,
+	}
+
+	reader, err := NewReader(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errC := make(chan error)
+	go func() { errC <- reader.Run(context.Background()) }()
+
+	waitFor(t, 5*time.Second, func() bool {
+		_, changes, _ := metrics.GetTotals()
+		return changes == 2
+	})
+
+	reader.StopAt(time.Now())
+	if err := <-errC; err != nil {
+		t.Fatal(err)
+	}
+
+	rows, changes, finished := metrics.GetTotals()
+	if rows != 2 || changes != 2 {
+		t.Errorf("expected 2 rows and 2 changes to be reported, got %d and %d", rows, changes)
+	}
+	if finished != 1 {
+		t.Errorf("expected one stream batch to be finished, got %d", finished)
+	}
+
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	if lag := metrics.results[0].Lag; lag < 2*time.Minute-time.Second {
+		t.Errorf("expected the first poll to lag by about ChangeAgeLimit, got %s", lag)
+	}
+}
@@ -0,0 +1,108 @@
+package scyllacdc
+
+import (
+	"time"
+)
+
+const (
+	// Initial values of the parameters which are adjusted automatically
+	initialAdaptiveQueryDelay      time.Duration = 10 * time.Second
+	initialAdaptiveQueryWindowSize time.Duration = 30 * time.Second
+
+	minAdaptiveQueryDelay      time.Duration = 100 * time.Millisecond
+	maxAdaptiveQueryDelay      time.Duration = 30 * time.Second
+	maxAdaptiveQueryWindowSize time.Duration = 10 * time.Minute
+
+	// If a query returns at least that many rows, the stream batch
+	// is considered busy
+	busyStreamBatchRowCount = 1000
+)
+
+// pollController decides on the delays between consecutive queries
+// of a stream batch reader and on the size of the queried time window.
+//
+// Parameters which were set in the AdvancedReaderConfig are used as they
+// are. Parameters which were left as 0 are adjusted after each query:
+// when the stream batch returns many rows or is lagging behind the
+// confidence window, the delay is shortened and the window is widened;
+// when the stream batch is idle, the delay is gradually increased.
+type pollController struct {
+	config *AdvancedReaderConfig
+
+	delay      time.Duration
+	windowSize time.Duration
+}
+
+type pollOutcome struct {
+	failed bool
+	rows   int
+
+	// True if the queried window ended before the confidence window,
+	// which means that more changes could have been read right away
+	behind bool
+}
+
+func newPollController(config *AdvancedReaderConfig) *pollController {
+	return &pollController{
+		config: config,
+
+		delay:      initialAdaptiveQueryDelay,
+		windowSize: initialAdaptiveQueryWindowSize,
+	}
+}
+
+func (pc *pollController) queryWindowSize() time.Duration {
+	if pc.config.QueryTimeWindowSize != 0 {
+		return pc.config.QueryTimeWindowSize
+	}
+	return pc.windowSize
+}
+
+// Adjusts parameters according to the outcome of the last query
+// and returns the delay to wait before the next one.
+func (pc *pollController) nextDelay(outcome pollOutcome) time.Duration {
+	if outcome.failed {
+		return pc.config.PostFailedQueryDelay
+	}
+
+	busy := outcome.behind || outcome.rows >= busyStreamBatchRowCount
+	switch {
+	case busy:
+		pc.delay = maxDuration(pc.delay/2, minAdaptiveQueryDelay)
+		pc.windowSize = minDuration(pc.windowSize*2, maxAdaptiveQueryWindowSize)
+	case outcome.rows > 0:
+		// Quickly return to the regular pace after a period of idleness,
+		// and slowly after a period of high load
+		if pc.delay > initialAdaptiveQueryDelay {
+			pc.delay = initialAdaptiveQueryDelay
+		} else {
+			pc.delay = minDuration(pc.delay*2, initialAdaptiveQueryDelay)
+		}
+		pc.windowSize = maxDuration(pc.windowSize/2, initialAdaptiveQueryWindowSize)
+	default:
+		pc.delay = minDuration(pc.delay*2, maxAdaptiveQueryDelay)
+		pc.windowSize = maxDuration(pc.windowSize/2, initialAdaptiveQueryWindowSize)
+	}
+
+	if outcome.rows > 0 && pc.config.PostNonEmptyQueryDelay != 0 {
+		return pc.config.PostNonEmptyQueryDelay
+	}
+	if outcome.rows == 0 && pc.config.PostEmptyQueryDelay != 0 {
+		return pc.config.PostEmptyQueryDelay
+	}
+	return pc.delay
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
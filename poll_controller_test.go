@@ -0,0 +1,134 @@
+package scyllacdc
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPollControllerAdjustsToLoad(t *testing.T) {
+	cfg := AdvancedReaderConfig{}
+	cfg.setDefaults()
+	pc := newPollController(&cfg)
+
+	if d := pc.nextDelay(pollOutcome{rows: 10}); d != initialAdaptiveQueryDelay {
+		t.Errorf("expected delay %s after a regular poll, got %s", initialAdaptiveQueryDelay, d)
+	}
+
+	// A lagging stream batch should be polled more often, with a wider window
+	var d time.Duration
+	for i := 0; i < 20; i++ {
+		d = pc.nextDelay(pollOutcome{rows: 10, behind: true})
+	}
+	if d != minAdaptiveQueryDelay {
+		t.Errorf("expected delay to drop to %s, got %s", minAdaptiveQueryDelay, d)
+	}
+	if w := pc.queryWindowSize(); w != maxAdaptiveQueryWindowSize {
+		t.Errorf("expected window to grow to %s, got %s", maxAdaptiveQueryWindowSize, w)
+	}
+
+	// Idle stream batch should back off
+	for i := 0; i < 20; i++ {
+		d = pc.nextDelay(pollOutcome{})
+	}
+	if d != maxAdaptiveQueryDelay {
+		t.Errorf("expected delay to grow to %s, got %s", maxAdaptiveQueryDelay, d)
+	}
+	if w := pc.queryWindowSize(); w != initialAdaptiveQueryWindowSize {
+		t.Errorf("expected window to shrink to %s, got %s", initialAdaptiveQueryWindowSize, w)
+	}
+
+	// ...and return to the regular pace as soon as changes appear
+	if d := pc.nextDelay(pollOutcome{rows: 1}); d != initialAdaptiveQueryDelay {
+		t.Errorf("expected delay %s after an idle period, got %s", initialAdaptiveQueryDelay, d)
+	}
+
+	if d := pc.nextDelay(pollOutcome{failed: true}); d != cfg.PostFailedQueryDelay {
+		t.Errorf("expected delay %s after a failed poll, got %s", cfg.PostFailedQueryDelay, d)
+	}
+}
+
+func TestPollControllerRespectsFixedParameters(t *testing.T) {
+	cfg := AdvancedReaderConfig{
+		PostNonEmptyQueryDelay: 2 * time.Second,
+		PostEmptyQueryDelay:    3 * time.Second,
+		QueryTimeWindowSize:    4 * time.Second,
+	}
+	cfg.setDefaults()
+	pc := newPollController(&cfg)
+
+	for i := 0; i < 5; i++ {
+		if d := pc.nextDelay(pollOutcome{rows: busyStreamBatchRowCount, behind: true}); d != cfg.PostNonEmptyQueryDelay {
+			t.Errorf("expected delay %s after a non-empty poll, got %s", cfg.PostNonEmptyQueryDelay, d)
+		}
+		if d := pc.nextDelay(pollOutcome{}); d != cfg.PostEmptyQueryDelay {
+			t.Errorf("expected delay %s after an empty poll, got %s", cfg.PostEmptyQueryDelay, d)
+		}
+		if w := pc.queryWindowSize(); w != cfg.QueryTimeWindowSize {
+			t.Errorf("expected window %s, got %s", cfg.QueryTimeWindowSize, w)
+		}
+	}
+}
+
+// A DataSource which records inputs of QueryRange.
+type recordingDataSource struct {
+	*InMemoryDataSource
+
+	mu     sync.Mutex
+	inputs []QueryRangeInput
+}
+
+func (rds *recordingDataSource) QueryRange(ctx context.Context, input QueryRangeInput) (ChangeRowIterator, error) {
+	rds.mu.Lock()
+	rds.inputs = append(rds.inputs, input)
+	rds.mu.Unlock()
+	return rds.InMemoryDataSource.QueryRange(ctx, input)
+}
+
+func TestReaderWidensQueryWindowOfLaggingStreams(t *testing.T) {
+	ds := &recordingDataSource{InMemoryDataSource: NewInMemoryDataSource()}
+	ds.AddGeneration(time.Now().Add(-time.Hour), []StreamID{{0x01}})
+	newTestInMemoryTable(t, ds.InMemoryDataSource, "tbl")
+
+	cfg := &ReaderConfig{
+		DataSource:            ds,
+		ChangeConsumerFactory: newCollectingConsumer(),
+		TableNames:            []string{"ks.tbl"},
+		Advanced: AdvancedReaderConfig{
+			ChangeAgeLimit:         30 * time.Minute,
+			PostNonEmptyQueryDelay: 10 * time.Millisecond,
+			PostEmptyQueryDelay:    10 * time.Millisecond,
+			PostFailedQueryDelay:   10 * time.Millisecond,
+			ConfidenceWindowSize:   time.Millisecond,
+		},
+	}
+	reader, err := NewReader(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errC := make(chan error, 1)
+	go func() { errC <- reader.Run(context.Background()) }()
+
+	waitFor(t, 5*time.Second, func() bool {
+		ds.mu.Lock()
+		defer ds.mu.Unlock()
+		return len(ds.inputs) >= 3
+	})
+	reader.Stop()
+	if err := <-errC; err != nil {
+		t.Fatal(err)
+	}
+
+	// The window is widened right after a query which is behind
+	// the confidence window
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	for i, input := range ds.inputs[:3] {
+		size := input.End.Time().Sub(input.Start.Time())
+		expected := initialAdaptiveQueryWindowSize << uint(i)
+		if size != expected {
+			t.Errorf("expected query %d to have a window of %s, got %s", i, expected, size)
+		}
+	}
+}
@@ -1,11 +1,15 @@
 package scyllacdc
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/gocql/gocql"
+	"golang.org/x/sync/errgroup"
 	"golang.org/x/sync/semaphore"
 )
 
@@ -87,6 +91,162 @@ type ProgressManagerWithStartTime interface {
 	SaveApplicationReadStartTime(ctx context.Context, startTime time.Time) error
 }
 
+// ProgressManagerWithTableStartTime is an extension to the ProgressManager
+// interface. It keeps the point from which reading of each table started,
+// so that tables added to an application which has already been reading
+// other tables are not read from the start time of the application.
+// The point from which a new table is read is determined by
+// AdvancedReaderConfig.NewTableStartPolicy.
+type ProgressManagerWithTableStartTime interface {
+	ProgressManager
+
+	// GetTableReadStartTime returns the timestamp from which the application
+	// started reading given table. Streams of the table without saved
+	// progress are read from this timestamp (or higher if the generation
+	// timestamp is higher).
+	//
+	// If this function returns a zero time, the library will consider
+	// the table new, and choose the timestamp according to
+	// AdvancedReaderConfig.NewTableStartPolicy.
+	// If this function returns an error, the library will stop with an error.
+	GetTableReadStartTime(ctx context.Context, table string) (time.Time, error)
+
+	// SaveTableReadStartTime stores the timestamp from which the application
+	// started reading given table. It is called by the library if there was
+	// no start timestamp saved for the table.
+	//
+	// If this function returns an error, the library will stop with an error.
+	SaveTableReadStartTime(ctx context.Context, table string, startTime time.Time) error
+
+	// ListTableReadStartTimes returns the start timestamps of all tables
+	// saved with SaveTableReadStartTime, indexed by table name. It is used
+	// by ExportProgress.
+	ListTableReadStartTimes(ctx context.Context) (map[string]time.Time, error)
+}
+
+// ProgressManagerWithTableGeneration is an extension to the ProgressManager
+// interface. It keeps the current generation of each table which has its
+// own generations (see DataSourceWithTableGenerations), separately from
+// the cluster-wide generation passed to StartGeneration. Without it, after
+// a restart such tables are read from the generation which was open when
+// the application started reading, and streams of the generations which
+// were already read are skipped based on their saved progress.
+//
+// Implementations which remove progress of finished generations should
+// remove progress of such a table only in generations older than
+// its current generation.
+type ProgressManagerWithTableGeneration interface {
+	ProgressManager
+
+	// GetTableGeneration returns the time of the generation of given table
+	// that was last saved by StartTableGeneration, or a zero time value
+	// if none was saved.
+	//
+	// If this function returns an error, the library will stop with an error.
+	GetTableGeneration(ctx context.Context, table string) (time.Time, error)
+
+	// StartTableGeneration is called after all changes of given table have
+	// been read from its previous generation and the library is about to
+	// start processing the next one.
+	//
+	// If this function returns an error, the library will stop with an error.
+	StartTableGeneration(ctx context.Context, table string, gen time.Time) error
+
+	// ListTableGenerations returns the generations of all tables saved
+	// with StartTableGeneration, indexed by table name. It is used
+	// by ExportProgress.
+	ListTableGenerations(ctx context.Context) (map[string]time.Time, error)
+}
+
+// ProgressManagerWithFlush is an extension to the ProgressManager interface.
+// It should be implemented by ProgressManagers which do not write progress
+// right away in SaveProgress, but buffer it.
+type ProgressManagerWithFlush interface {
+	ProgressManager
+
+	// Flush writes all progress saved so far with SaveProgress. The library
+	// calls it after consumers of a stream batch were ended, so that their
+	// final progress is not lost when the reader stops or switches
+	// to the next generation.
+	//
+	// If this function returns an error, the library will stop with an error.
+	Flush(ctx context.Context) error
+}
+
+// ProgressManagerWithEnumeration is an extension to the ProgressManager
+// interface. It allows to list and remove saved progress, and is meant
+// to be used by tools which administer progress of applications.
+// The Reader does not use it.
+type ProgressManagerWithEnumeration interface {
+	ProgressManager
+
+	// ListProgress returns progress saved for all streams of all tables,
+	// in all generations, ordered by generation, table name and stream ID.
+	ListProgress(ctx context.Context) ([]ProgressEntry, error)
+
+	// DeleteProgress removes progress saved for given stream of a table
+	// in a given generation.
+	DeleteProgress(ctx context.Context, gen time.Time, table string, streamID StreamID) error
+
+	// Clear removes all saved information: progress of all streams,
+	// the current generation, and the start times and generations
+	// of the application and tables, if supported.
+	Clear(ctx context.Context) error
+}
+
+// ProgressManagerWithStatement is an extension to the ProgressManager
+// interface. It should be implemented by ProgressManagers which save progress
+// in Scylla, and allows consumers to save progress in the same logged batch
+// as their own writes. If the consumer writes to a Scylla table which is
+// in the same cluster as the progress table, the write and the progress update
+// are applied together, so that changes are not applied twice after
+// the reader is restarted.
+type ProgressManagerWithStatement interface {
+	ProgressManager
+
+	// GetProgressStatement returns a statement which has the same effect
+	// as a call to SaveProgress with the same arguments. The statement is
+	// not executed, it is up to the caller to execute it, usually as a part
+	// of a logged batch.
+	//
+	// Progress of a stream saved with the statement must not be saved
+	// concurrently with SaveProgress.
+	GetProgressStatement(ctx context.Context, gen time.Time, table string, streamID StreamID, progress Progress) (ProgressStatement, error)
+}
+
+// ProgressStatement is a CQL statement which saves progress, along
+// with the values which need to be bound to it.
+type ProgressStatement struct {
+	Query  string
+	Values []interface{}
+}
+
+// ErrProgressStatementNotSupported is returned by
+// (*ProgressReporter).ProgressStatement if the ProgressManager
+// does not implement the ProgressManagerWithStatement interface.
+var ErrProgressStatementNotSupported = errors.New("the progress manager does not support progress statements")
+
+// ProgressEntry describes progress saved for a single stream of a table
+// in a given generation.
+type ProgressEntry struct {
+	Generation time.Time
+	TableName  string
+	StreamID   StreamID
+	Progress   Progress
+}
+
+func sortProgressEntries(entries []ProgressEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].Generation.Equal(entries[j].Generation) {
+			return entries[i].Generation.Before(entries[j].Generation)
+		}
+		if entries[i].TableName != entries[j].TableName {
+			return entries[i].TableName < entries[j].TableName
+		}
+		return bytes.Compare(entries[i].StreamID, entries[j].StreamID) < 0
+	})
+}
+
 // ProgressReporter is a helper object for the ChangeConsumer. It allows
 // the consumer to save its progress.
 type ProgressReporter struct {
@@ -105,6 +265,33 @@ func (pr *ProgressReporter) MarkProgress(ctx context.Context, progress Progress)
 	return pr.progressManager.SaveProgress(ctx, pr.gen, pr.tableName, pr.streamID, progress)
 }
 
+// SupportsProgressStatement reports whether the ProgressReporter is able
+// to create progress statements with ProgressStatement.
+func (pr *ProgressReporter) SupportsProgressStatement() bool {
+	_, ok := pr.progressManager.(ProgressManagerWithStatement)
+	return ok
+}
+
+// ProgressStatement returns a statement which saves progress for
+// the consumer associated with the ProgressReporter. It can be added
+// to a logged batch along with the consumer's own writes:
+//
+//	stmt, err := reporter.ProgressStatement(ctx, scyllacdc.Progress{change.Time})
+//	if err != nil {
+//		return err
+//	}
+//	batch.Query(stmt.Query, stmt.Values...)
+//
+// If the ProgressManager does not support this, it returns
+// ErrProgressStatementNotSupported.
+func (pr *ProgressReporter) ProgressStatement(ctx context.Context, progress Progress) (ProgressStatement, error) {
+	withStatement, ok := pr.progressManager.(ProgressManagerWithStatement)
+	if !ok {
+		return ProgressStatement{}, ErrProgressStatementNotSupported
+	}
+	return withStatement.GetProgressStatement(ctx, pr.gen, pr.tableName, pr.streamID, progress)
+}
+
 // Progress represents the point up to which the library has processed changes
 // in a given stream.
 type Progress struct {
@@ -156,18 +343,39 @@ func (noProgressManager) SaveProgress(ctx context.Context, gen time.Time, table
 // application_name, table_name and stream_id.
 //
 // For storing information about current generation, special rows with stream
-// set to empty bytes is used.
+// set to empty bytes is used. Start times of tables and current generations
+// of tables with their own generations are stored in similar rows, with
+// the table name set.
+//
+// By default, SaveProgress writes progress to the table right away.
+// With SetWriteBehind, progress can be buffered instead, so that only
+// the most recent progress of each stream is written periodically.
+//
+// Progress of streams is always written with an explicit write timestamp
+// (USING TIMESTAMP), taken from the clock of the client when the progress
+// is saved, and not with the default timestamp of the session. The clocks
+// of the clients which save progress of the same application should be
+// synchronized.
 type TableBackedProgressManager struct {
 	session           *gocql.Session
 	progressTableName string
 	applicationName   string
 
 	// TTL to use when writing progress for a stream (a week by default).
-	// TODO: maybe not? maybe we should clean up this data manually?
-	// Progress data may be large if generations are very large
+	// Zero means that progress does not expire.
 	ttl int32
 
+	// If set, progress of finished generations is deleted
+	// after a new generation is started
+	cleanupGenerations bool
+
+	// Receives errors of the cleanup of finished generations, if set
+	cleanupErrorHandler func(err error)
+
 	concurrentQueryLimiter *semaphore.Weighted
+
+	// If not nil, progress is buffered and written periodically
+	writeBehind *progressWriteBehind
 }
 
 // NewTableBackedProgressManager creates a new TableBackedProgressManager.
@@ -189,6 +397,11 @@ func NewTableBackedProgressManager(session *gocql.Session, progressTableName str
 }
 
 // SetTTL sets the TTL used to expire progress. By default, it's 7 days.
+//
+// Setting the TTL to 0 disables expiration, so that progress of streams
+// which did not receive changes for a long time is not lost. In that case,
+// it's recommended to enable SetGenerationCleanup, otherwise progress
+// of finished generations is never removed.
 func (tbpm *TableBackedProgressManager) SetTTL(ttl int32) {
 	tbpm.ttl = ttl
 }
@@ -200,6 +413,89 @@ func (tbpm *TableBackedProgressManager) SetMaxConcurrency(maxConcurrentOps int64
 	tbpm.concurrentQueryLimiter = semaphore.NewWeighted(maxConcurrentOps)
 }
 
+// SetGenerationCleanup enables or disables removal of progress of finished
+// generations. If enabled, after a new generation is started, progress
+// of this application saved in generations older than the previous one
+// is deleted with DeleteGenerationsBefore. Progress of the previous
+// generation is kept.
+//
+// The cleanup scans the whole progress table with ALLOW FILTERING and
+// deletes the rows one by one, which can take long if the table is large
+// or shared by many applications. It is best-effort: if it fails,
+// the generation is started anyway, and the error is passed to the handler
+// set with SetCleanupErrorHandler. Rows which were not deleted are removed
+// by the cleanup after one of the next generations is started.
+//
+// By default, the cleanup is disabled.
+// This function must not be called after Reader for this manager is started.
+func (tbpm *TableBackedProgressManager) SetGenerationCleanup(enabled bool) {
+	tbpm.cleanupGenerations = enabled
+}
+
+// SetCleanupErrorHandler sets a function which receives errors that occur
+// during the cleanup of finished generations (see SetGenerationCleanup).
+// By default, such errors are ignored.
+// This function must not be called after Reader for this manager is started.
+func (tbpm *TableBackedProgressManager) SetCleanupErrorHandler(handler func(err error)) {
+	tbpm.cleanupErrorHandler = handler
+}
+
+// SetWriteBehind enables the write-behind mode. In this mode, SaveProgress
+// only records the progress in memory, and the most recent progress
+// of each stream is written to the table in the background, according
+// to the config. Buffered progress is also written by Flush, which the Reader
+// calls after consumers are ended, and before a new generation is started.
+//
+// Progress which was saved, but not written yet, is lost if the application
+// crashes. The reader will then resume from an earlier point, so some changes
+// may be delivered again, but none will be skipped.
+//
+// Close should be called after the Reader stops in order to write remaining
+// progress and stop the background goroutine. After Close, SaveProgress
+// writes progress right away.
+//
+// If the write-behind mode was already enabled, progress buffered so far
+// is written before the new config takes effect. Progress which fails
+// to be written is kept, and the error is reported to OnFlushError.
+//
+// The mode is not protected against concurrent use, so this function must
+// not be called concurrently with other methods of the manager, e.g. after
+// a Reader using this manager is started.
+func (tbpm *TableBackedProgressManager) SetWriteBehind(config ProgressWriteBehindConfig) {
+	prev := tbpm.writeBehind
+	tbpm.writeBehind = newProgressWriteBehind(config, func(ctx context.Context, pp pendingProgress) error {
+		return tbpm.writeProgress(ctx, pp.gen, pp.table, pp.streamID, pp.progress, pp.timestamp)
+	})
+	if prev != nil {
+		err := prev.stopAndHandOver(context.Background(), tbpm.writeBehind)
+		if err != nil && tbpm.writeBehind.config.OnFlushError != nil {
+			tbpm.writeBehind.config.OnFlushError(err)
+		}
+	}
+	tbpm.writeBehind.start()
+}
+
+// Flush is needed to implement the ProgressManagerWithFlush interface.
+// It writes all buffered progress to the table. It does nothing
+// if the write-behind mode is not enabled.
+func (tbpm *TableBackedProgressManager) Flush(ctx context.Context) error {
+	if tbpm.writeBehind == nil {
+		return nil
+	}
+	return tbpm.writeBehind.flush(ctx)
+}
+
+// Close writes all buffered progress and stops the background goroutine
+// of the write-behind mode. It does nothing if the write-behind mode
+// is not enabled. It is safe to call Close multiple times.
+func (tbpm *TableBackedProgressManager) Close(ctx context.Context) error {
+	if tbpm.writeBehind == nil {
+		return nil
+	}
+	tbpm.writeBehind.stop()
+	return tbpm.writeBehind.flush(ctx)
+}
+
 func (tbpm *TableBackedProgressManager) ensureTableExists() error {
 	return tbpm.session.Query(
 		fmt.Sprintf(
@@ -227,8 +523,23 @@ func (tbpm *TableBackedProgressManager) GetCurrentGeneration(ctx context.Context
 
 // StartGeneration is needed to implement the ProgressManager interface.
 func (tbpm *TableBackedProgressManager) StartGeneration(ctx context.Context, gen time.Time) error {
+	// Progress of the previous generation must be written first
+	if err := tbpm.Flush(ctx); err != nil {
+		return err
+	}
+
+	var prevGen time.Time
+	if tbpm.cleanupGenerations {
+		var err error
+		prevGen, err = tbpm.GetCurrentGeneration(ctx)
+		if err != nil {
+			// Skip the cleanup, it will be done after the next generation
+			tbpm.reportCleanupError(fmt.Errorf("failed to fetch the previous generation: %w", err))
+		}
+	}
+
 	// Update the progress in the special partition
-	return tbpm.session.Query(
+	err := tbpm.session.Query(
 		fmt.Sprintf(
 			"INSERT INTO %s (generation, application_name, table_name, stream_id, current_generation) "+
 				"VALUES (?, ?, ?, ?, ?)",
@@ -236,10 +547,198 @@ func (tbpm *TableBackedProgressManager) StartGeneration(ctx context.Context, gen
 		),
 		time.Time{}, tbpm.applicationName, "", []byte{}, gen,
 	).Exec()
+	if err != nil {
+		return err
+	}
+
+	if tbpm.cleanupGenerations && !prevGen.IsZero() && prevGen.Before(gen) {
+		if err := tbpm.DeleteGenerationsBefore(ctx, prevGen); err != nil {
+			tbpm.reportCleanupError(fmt.Errorf("failed to delete progress of generations before %v: %w", prevGen, err))
+		}
+	}
+	return nil
+}
+
+func (tbpm *TableBackedProgressManager) reportCleanupError(err error) {
+	if tbpm.cleanupErrorHandler != nil {
+		tbpm.cleanupErrorHandler(err)
+	}
+}
+
+// DeleteGenerationsBefore deletes progress of this application saved
+// in generations older than given one. The current generation and
+// the application start time are not affected. Progress of tables with
+// their own generations is deleted only in generations older than
+// the current generation of the table.
+//
+// Progress rows are not indexed by application name only, so this
+// function scans the whole progress table.
+func (tbpm *TableBackedProgressManager) DeleteGenerationsBefore(ctx context.Context, before time.Time) error {
+	rows, err := tbpm.scanApplicationRows(ctx)
+	if err != nil {
+		return err
+	}
+
+	tableGenerations := make(map[string]time.Time)
+	for _, row := range rows {
+		if row.gen.IsZero() && row.tableName != "" && !row.currentGen.IsZero() {
+			tableGenerations[row.tableName] = row.currentGen
+		}
+	}
+
+	var toDelete []tableProgressRow
+	for _, row := range rows {
+		// Rows with the zero generation hold the current generation
+		// and the start times of the application and tables
+		if row.gen.IsZero() {
+			continue
+		}
+		bound := before
+		if tableGen, ok := tableGenerations[row.tableName]; ok {
+			bound = tableGen
+		}
+		if row.gen.Before(bound) {
+			toDelete = append(toDelete, row)
+		}
+	}
+	return tbpm.deleteRows(ctx, toDelete)
+}
+
+// ListProgress is needed to implement the ProgressManagerWithEnumeration interface.
+// Buffered progress is written before listing.
+func (tbpm *TableBackedProgressManager) ListProgress(ctx context.Context) ([]ProgressEntry, error) {
+	if err := tbpm.Flush(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := tbpm.scanApplicationRows(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]ProgressEntry, 0, len(rows))
+	for _, row := range rows {
+		if row.gen.IsZero() {
+			continue
+		}
+		entries = append(entries, ProgressEntry{
+			Generation: row.gen,
+			TableName:  row.tableName,
+			StreamID:   row.streamID,
+			Progress:   Progress{row.lastTimestamp},
+		})
+	}
+	sortProgressEntries(entries)
+	return entries, nil
+}
+
+// DeleteProgress is needed to implement the ProgressManagerWithEnumeration interface.
+func (tbpm *TableBackedProgressManager) DeleteProgress(ctx context.Context, gen time.Time, tableName string, streamID StreamID) error {
+	if tbpm.writeBehind != nil {
+		tbpm.writeBehind.discard(gen, tableName, streamID)
+	}
+	return tbpm.deleteRows(ctx, []tableProgressRow{{gen: gen, tableName: tableName, streamID: streamID}})
+}
+
+// Clear is needed to implement the ProgressManagerWithEnumeration interface.
+func (tbpm *TableBackedProgressManager) Clear(ctx context.Context) error {
+	if tbpm.writeBehind != nil {
+		tbpm.writeBehind.discardAll()
+	}
+	rows, err := tbpm.scanApplicationRows(ctx)
+	if err != nil {
+		return err
+	}
+	return tbpm.deleteRows(ctx, rows)
+}
+
+type tableProgressRow struct {
+	gen           time.Time
+	tableName     string
+	streamID      StreamID
+	lastTimestamp gocql.UUID
+	currentGen    time.Time
+}
+
+// Returns all rows of this application. Progress rows are not indexed
+// by application name only, so the whole progress table is scanned.
+func (tbpm *TableBackedProgressManager) scanApplicationRows(ctx context.Context) ([]tableProgressRow, error) {
+	iter := tbpm.session.Query(
+		fmt.Sprintf("SELECT generation, table_name, stream_id, last_timestamp, current_generation FROM %s WHERE application_name = ? ALLOW FILTERING", tbpm.progressTableName),
+		tbpm.applicationName,
+	).WithContext(ctx).Iter()
+
+	var (
+		rows []tableProgressRow
+		row  tableProgressRow
+	)
+	for iter.Scan(&row.gen, &row.tableName, &row.streamID, &row.lastTimestamp, &row.currentGen) {
+		rows = append(rows, row)
+		row = tableProgressRow{}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func (tbpm *TableBackedProgressManager) deleteRows(ctx context.Context, rows []tableProgressRow) error {
+	errG, errCtx := errgroup.WithContext(ctx)
+	for _, row := range rows {
+		row := row
+		if err := tbpm.concurrentQueryLimiter.Acquire(errCtx, 1); err != nil {
+			if waitErr := errG.Wait(); waitErr != nil {
+				return waitErr
+			}
+			return err
+		}
+		errG.Go(func() error {
+			defer tbpm.concurrentQueryLimiter.Release(1)
+			return tbpm.session.Query(
+				fmt.Sprintf("DELETE FROM %s WHERE generation = ? AND application_name = ? AND table_name = ? AND stream_id = ?", tbpm.progressTableName),
+				row.gen, tbpm.applicationName, row.tableName, []byte(row.streamID),
+			).WithContext(errCtx).Exec()
+		})
+	}
+	return errG.Wait()
+}
+
+// ListTableBackedProgressApplications returns names of applications which
+// saved any information in given progress table, in no particular order.
+// The whole progress table is scanned.
+func ListTableBackedProgressApplications(ctx context.Context, session *gocql.Session, progressTableName string) ([]string, error) {
+	iter := session.Query(
+		fmt.Sprintf("SELECT DISTINCT generation, application_name, table_name, stream_id FROM %s", progressTableName),
+	).WithContext(ctx).Iter()
+
+	var (
+		names       []string
+		seen        = make(map[string]struct{})
+		gen         time.Time
+		application string
+		tableName   string
+		streamID    []byte
+	)
+	for iter.Scan(&gen, &application, &tableName, &streamID) {
+		if _, ok := seen[application]; !ok {
+			seen[application] = struct{}{}
+			names = append(names, application)
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return names, nil
 }
 
 // GetProgress is needed to implement the ProgressManager interface.
 func (tbpm *TableBackedProgressManager) GetProgress(ctx context.Context, gen time.Time, tableName string, streamID StreamID) (Progress, error) {
+	if tbpm.writeBehind != nil {
+		if progress, ok := tbpm.writeBehind.get(gen, tableName, streamID); ok {
+			return progress, nil
+		}
+	}
+
 	tbpm.concurrentQueryLimiter.Acquire(ctx, 1)
 	defer tbpm.concurrentQueryLimiter.Release(1)
 
@@ -257,15 +756,50 @@ func (tbpm *TableBackedProgressManager) GetProgress(ctx context.Context, gen tim
 
 // SaveProgress is needed to implement the ProgressManager interface.
 func (tbpm *TableBackedProgressManager) SaveProgress(ctx context.Context, gen time.Time, tableName string, streamID StreamID, progress Progress) error {
+	if tbpm.writeBehind != nil {
+		return tbpm.writeBehind.save(ctx, gen, tableName, streamID, progress)
+	}
+	return tbpm.writeProgress(ctx, gen, tableName, streamID, progress, nextProgressWriteTimestamp())
+}
+
+func (tbpm *TableBackedProgressManager) writeProgress(ctx context.Context, gen time.Time, tableName string, streamID StreamID, progress Progress, timestamp int64) error {
 	tbpm.concurrentQueryLimiter.Acquire(ctx, 1)
 	defer tbpm.concurrentQueryLimiter.Release(1)
 
 	return tbpm.session.Query(
-		fmt.Sprintf("INSERT INTO %s (generation, application_name, table_name, stream_id, last_timestamp) VALUES (?, ?, ?, ?, ?) USING TTL ?", tbpm.progressTableName),
-		gen, tbpm.applicationName, tableName, streamID, progress.LastProcessedRecordTime, tbpm.ttl,
+		fmt.Sprintf("INSERT INTO %s (generation, application_name, table_name, stream_id, last_timestamp) VALUES (?, ?, ?, ?, ?) USING TTL ? AND TIMESTAMP ?", tbpm.progressTableName),
+		gen, tbpm.applicationName, tableName, streamID, progress.LastProcessedRecordTime, tbpm.ttl, timestamp,
 	).Exec()
 }
 
+// GetProgressStatement is needed to implement the ProgressManagerWithStatement interface.
+//
+// The statement has an explicit write timestamp, so that it takes effect
+// even if it is executed in a batch with an earlier default timestamp set
+// with (*gocql.Batch).WithTimestamp, e.g. the timestamp of the replicated
+// change. The batch must not set a timestamp with USING TIMESTAMP
+// in its CQL text, as Scylla rejects it together with timestamps
+// of the statements. Progress of the stream which
+// was saved with SaveProgress, but not written yet, is discarded. If it is
+// being written at the moment, it was saved with an earlier write timestamp,
+// so it doesn't overwrite progress saved by the statement.
+func (tbpm *TableBackedProgressManager) GetProgressStatement(ctx context.Context, gen time.Time, tableName string, streamID StreamID, progress Progress) (ProgressStatement, error) {
+	if tbpm.writeBehind != nil {
+		tbpm.writeBehind.discard(gen, tableName, streamID)
+	}
+
+	return ProgressStatement{
+		Query: fmt.Sprintf(
+			"INSERT INTO %s (generation, application_name, table_name, stream_id, last_timestamp) VALUES (?, ?, ?, ?, ?) USING TTL ? AND TIMESTAMP ?",
+			tbpm.progressTableName,
+		),
+		Values: []interface{}{
+			gen, tbpm.applicationName, tableName, streamID, progress.LastProcessedRecordTime, tbpm.ttl,
+			nextProgressWriteTimestamp(),
+		},
+	}, nil
+}
+
 // SaveApplicationReadStartTime is needed to implement the ProgressManagerWithStartTime interface.
 func (tbpm *TableBackedProgressManager) SaveApplicationReadStartTime(ctx context.Context, startTime time.Time) error {
 	// Store information about the timestamp in the `last_timestamp` column,
@@ -280,6 +814,143 @@ func (tbpm *TableBackedProgressManager) SaveApplicationReadStartTime(ctx context
 	).Exec()
 }
 
+// SaveTableReadStartTime is needed to implement the ProgressManagerWithTableStartTime interface.
+func (tbpm *TableBackedProgressManager) SaveTableReadStartTime(ctx context.Context, tableName string, startTime time.Time) error {
+	// Similarly to the application start time, store the timestamp
+	// in the partition with "zero generation" and the name of the table
+	return tbpm.session.Query(
+		fmt.Sprintf(
+			"INSERT INTO %s (generation, application_name, table_name, stream_id, last_timestamp) "+
+				"VALUES (?, ?, ?, ?, ?)",
+			tbpm.progressTableName,
+		),
+		time.Time{}, tbpm.applicationName, tableName, []byte{}, gocql.MinTimeUUID(startTime),
+	).WithContext(ctx).Exec()
+}
+
+// GetTableReadStartTime is needed to implement the ProgressManagerWithTableStartTime interface.
+func (tbpm *TableBackedProgressManager) GetTableReadStartTime(ctx context.Context, tableName string) (time.Time, error) {
+	var timestamp gocql.UUID
+	err := tbpm.session.Query(
+		fmt.Sprintf(
+			"SELECT last_timestamp FROM %s WHERE generation = ? AND application_name = ? AND table_name = ? AND stream_id = ?",
+			tbpm.progressTableName,
+		),
+		time.Time{}, tbpm.applicationName, tableName, []byte{},
+	).WithContext(ctx).Scan(&timestamp)
+	if err != nil && err != gocql.ErrNotFound {
+		return time.Time{}, err
+	}
+	if timestamp == (gocql.UUID{}) {
+		return time.Time{}, nil
+	}
+	return timestamp.Time(), nil
+}
+
+// ListTableReadStartTimes is needed to implement the ProgressManagerWithTableStartTime interface.
+//
+// Progress rows are not indexed by application name only, so this
+// function scans the whole progress table.
+func (tbpm *TableBackedProgressManager) ListTableReadStartTimes(ctx context.Context) (map[string]time.Time, error) {
+	rows, err := tbpm.scanApplicationRows(ctx)
+	if err != nil {
+		return nil, err
+	}
+	startTimes := make(map[string]time.Time)
+	for _, row := range rows {
+		if row.gen.IsZero() && row.tableName != "" && row.lastTimestamp != (gocql.UUID{}) {
+			startTimes[row.tableName] = row.lastTimestamp.Time()
+		}
+	}
+	return startTimes, nil
+}
+
+// GetTableGeneration is needed to implement the ProgressManagerWithTableGeneration interface.
+func (tbpm *TableBackedProgressManager) GetTableGeneration(ctx context.Context, tableName string) (time.Time, error) {
+	var gen time.Time
+	err := tbpm.session.Query(
+		fmt.Sprintf(
+			"SELECT current_generation FROM %s WHERE generation = ? AND application_name = ? AND table_name = ? AND stream_id = ?",
+			tbpm.progressTableName,
+		),
+		time.Time{}, tbpm.applicationName, tableName, []byte{},
+	).WithContext(ctx).Scan(&gen)
+	if err != nil && err != gocql.ErrNotFound {
+		return time.Time{}, err
+	}
+	return gen, nil
+}
+
+// ListTableGenerations is needed to implement the ProgressManagerWithTableGeneration interface.
+//
+// Progress rows are not indexed by application name only, so this
+// function scans the whole progress table.
+func (tbpm *TableBackedProgressManager) ListTableGenerations(ctx context.Context) (map[string]time.Time, error) {
+	rows, err := tbpm.scanApplicationRows(ctx)
+	if err != nil {
+		return nil, err
+	}
+	gens := make(map[string]time.Time)
+	for _, row := range rows {
+		if row.gen.IsZero() && row.tableName != "" && !row.currentGen.IsZero() {
+			gens[row.tableName] = row.currentGen
+		}
+	}
+	return gens, nil
+}
+
+// StartTableGeneration is needed to implement the ProgressManagerWithTableGeneration interface.
+func (tbpm *TableBackedProgressManager) StartTableGeneration(ctx context.Context, tableName string, gen time.Time) error {
+	// Progress of the previous generation must be written first
+	if err := tbpm.Flush(ctx); err != nil {
+		return err
+	}
+
+	var prevGen time.Time
+	if tbpm.cleanupGenerations {
+		var err error
+		prevGen, err = tbpm.GetTableGeneration(ctx, tableName)
+		if err != nil {
+			tbpm.reportCleanupError(fmt.Errorf("failed to fetch the previous generation of table %s: %w", tableName, err))
+		}
+	}
+
+	// The row is shared with the start time of the table
+	err := tbpm.session.Query(
+		fmt.Sprintf(
+			"INSERT INTO %s (generation, application_name, table_name, stream_id, current_generation) "+
+				"VALUES (?, ?, ?, ?, ?)",
+			tbpm.progressTableName,
+		),
+		time.Time{}, tbpm.applicationName, tableName, []byte{}, gen,
+	).WithContext(ctx).Exec()
+	if err != nil {
+		return err
+	}
+
+	if tbpm.cleanupGenerations && !prevGen.IsZero() && prevGen.Before(gen) {
+		if err := tbpm.deleteTableGenerationsBefore(ctx, tableName, prevGen); err != nil {
+			tbpm.reportCleanupError(fmt.Errorf("failed to delete progress of table %s in generations before %v: %w", tableName, prevGen, err))
+		}
+	}
+	return nil
+}
+
+// Deletes progress of given table saved in generations older than given one.
+func (tbpm *TableBackedProgressManager) deleteTableGenerationsBefore(ctx context.Context, tableName string, before time.Time) error {
+	rows, err := tbpm.scanApplicationRows(ctx)
+	if err != nil {
+		return err
+	}
+	var toDelete []tableProgressRow
+	for _, row := range rows {
+		if row.tableName == tableName && !row.gen.IsZero() && row.gen.Before(before) {
+			toDelete = append(toDelete, row)
+		}
+	}
+	return tbpm.deleteRows(ctx, toDelete)
+}
+
 // GetApplicationReadStartTime is needed to implement the ProgressManagerWithStartTime interface.
 func (tbpm *TableBackedProgressManager) GetApplicationReadStartTime(ctx context.Context) (time.Time, error) {
 	// Retrieve the information from the special column
@@ -296,3 +967,8 @@ func (tbpm *TableBackedProgressManager) GetApplicationReadStartTime(ctx context.
 
 var _ ProgressManager = (*TableBackedProgressManager)(nil)
 var _ ProgressManagerWithStartTime = (*TableBackedProgressManager)(nil)
+var _ ProgressManagerWithTableStartTime = (*TableBackedProgressManager)(nil)
+var _ ProgressManagerWithTableGeneration = (*TableBackedProgressManager)(nil)
+var _ ProgressManagerWithFlush = (*TableBackedProgressManager)(nil)
+var _ ProgressManagerWithEnumeration = (*TableBackedProgressManager)(nil)
+var _ ProgressManagerWithStatement = (*TableBackedProgressManager)(nil)
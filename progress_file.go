@@ -0,0 +1,526 @@
+package scyllacdc
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+const (
+	fileProgressFormatVersion = 1
+
+	fileProgressStateName        = "state.json"
+	fileProgressGenerationPrefix = "generation-"
+	fileProgressGenerationSuffix = ".json"
+	fileProgressTempMarker       = ".tmp-"
+)
+
+// FileBackedProgressManager is a ProgressManager which saves progress in files
+// in a local directory. It is meant for deployments in which the application
+// runs on a single node and cannot, or should not, save its progress
+// in the cluster.
+//
+// The directory contains the following files:
+//
+//	state.json                       - current generations and start times
+//	generation-<unix nanos>.json     - progress of streams of a single generation
+//
+// Files are replaced atomically: a new version is written to a temporary
+// file, synced to disk and renamed over the old one, so that a crash never
+// leaves a partially written file. Concurrent SaveProgress calls for the same
+// generation are coalesced into a single write.
+//
+// When a new generation is started, files of older generations are removed.
+// If some tables have their own generations, only the files older than
+// the current generations of all tables are removed.
+//
+// The directory must not be used by more than one FileBackedProgressManager
+// at the same time.
+type FileBackedProgressManager struct {
+	dir string
+
+	mu          sync.Mutex
+	state       fileProgressState
+	generations map[int64]*fileProgressGeneration
+
+	// Serializes writes of the state file
+	stateWriteMu sync.Mutex
+}
+
+type fileProgressState struct {
+	Version                  int                  `json:"version"`
+	CurrentGeneration        *time.Time           `json:"current_generation,omitempty"`
+	ApplicationReadStartTime *time.Time           `json:"application_read_start_time,omitempty"`
+	TableReadStartTimes      map[string]time.Time `json:"table_read_start_times,omitempty"`
+	TableGenerations         map[string]time.Time `json:"table_generations,omitempty"`
+}
+
+type fileProgressGenerationJSON struct {
+	Version    int                              `json:"version"`
+	Generation time.Time                        `json:"generation"`
+	Tables     map[string]map[string]gocql.UUID `json:"tables"`
+}
+
+type fileProgressGeneration struct {
+	gen time.Time
+
+	// Table name -> hex-encoded stream ID -> progress
+	tables map[string]map[string]gocql.UUID
+
+	// Incremented on each modification, and compared with the version
+	// which was last written in order to coalesce writes
+	version        uint64
+	writtenVersion uint64
+
+	// Serializes writes of the generation file
+	writeMu sync.Mutex
+}
+
+// NewFileBackedProgressManager creates a new FileBackedProgressManager which
+// keeps its files in given directory. The directory is created if it does
+// not exist.
+func NewFileBackedProgressManager(dir string) (*FileBackedProgressManager, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	fbpm := &FileBackedProgressManager{
+		dir:         dir,
+		state:       fileProgressState{Version: fileProgressFormatVersion},
+		generations: make(map[int64]*fileProgressGeneration),
+	}
+
+	if err := fbpm.removeTemporaryFiles(); err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, fileProgressStateName))
+	if err == nil {
+		if err := json.Unmarshal(data, &fbpm.state); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %s", fileProgressStateName, err)
+		}
+		if fbpm.state.Version != fileProgressFormatVersion {
+			return nil, fmt.Errorf("unsupported version of %s: %d", fileProgressStateName, fbpm.state.Version)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return fbpm, nil
+}
+
+// GetCurrentGeneration is needed to implement the ProgressManager interface.
+func (fbpm *FileBackedProgressManager) GetCurrentGeneration(ctx context.Context) (time.Time, error) {
+	fbpm.mu.Lock()
+	defer fbpm.mu.Unlock()
+
+	if fbpm.state.CurrentGeneration == nil {
+		return time.Time{}, nil
+	}
+	return *fbpm.state.CurrentGeneration, nil
+}
+
+// StartGeneration is needed to implement the ProgressManager interface.
+func (fbpm *FileBackedProgressManager) StartGeneration(ctx context.Context, gen time.Time) error {
+	err := fbpm.updateState(func(state *fileProgressState) {
+		state.CurrentGeneration = &gen
+	})
+	if err != nil {
+		return err
+	}
+	return fbpm.compact()
+}
+
+// GetTableGeneration is needed to implement the ProgressManagerWithTableGeneration interface.
+func (fbpm *FileBackedProgressManager) GetTableGeneration(ctx context.Context, table string) (time.Time, error) {
+	fbpm.mu.Lock()
+	defer fbpm.mu.Unlock()
+	return fbpm.state.TableGenerations[table], nil
+}
+
+// StartTableGeneration is needed to implement the ProgressManagerWithTableGeneration interface.
+func (fbpm *FileBackedProgressManager) StartTableGeneration(ctx context.Context, table string, gen time.Time) error {
+	err := fbpm.updateState(func(state *fileProgressState) {
+		if state.TableGenerations == nil {
+			state.TableGenerations = make(map[string]time.Time)
+		}
+		state.TableGenerations[table] = gen
+	})
+	if err != nil {
+		return err
+	}
+	return fbpm.compact()
+}
+
+// ListTableGenerations is needed to implement the ProgressManagerWithTableGeneration interface.
+func (fbpm *FileBackedProgressManager) ListTableGenerations(ctx context.Context) (map[string]time.Time, error) {
+	fbpm.mu.Lock()
+	defer fbpm.mu.Unlock()
+	gens := make(map[string]time.Time, len(fbpm.state.TableGenerations))
+	for table, gen := range fbpm.state.TableGenerations {
+		gens[table] = gen
+	}
+	return gens, nil
+}
+
+// GetProgress is needed to implement the ProgressManager interface.
+func (fbpm *FileBackedProgressManager) GetProgress(ctx context.Context, gen time.Time, table string, streamID StreamID) (Progress, error) {
+	fbpm.mu.Lock()
+	defer fbpm.mu.Unlock()
+
+	fpg, err := fbpm.getGeneration(gen)
+	if err != nil {
+		return Progress{}, err
+	}
+	return Progress{fpg.tables[table][hex.EncodeToString(streamID)]}, nil
+}
+
+// SaveProgress is needed to implement the ProgressManager interface.
+func (fbpm *FileBackedProgressManager) SaveProgress(ctx context.Context, gen time.Time, table string, streamID StreamID, progress Progress) error {
+	fbpm.mu.Lock()
+	fpg, err := fbpm.getGeneration(gen)
+	if err != nil {
+		fbpm.mu.Unlock()
+		return err
+	}
+	streams, ok := fpg.tables[table]
+	if !ok {
+		streams = make(map[string]gocql.UUID)
+		fpg.tables[table] = streams
+	}
+	streams[hex.EncodeToString(streamID)] = progress.LastProcessedRecordTime
+	fpg.version++
+	savedVersion := fpg.version
+	fbpm.mu.Unlock()
+
+	return fbpm.writeGeneration(fpg, savedVersion)
+}
+
+// SaveApplicationReadStartTime is needed to implement the ProgressManagerWithStartTime interface.
+func (fbpm *FileBackedProgressManager) SaveApplicationReadStartTime(ctx context.Context, startTime time.Time) error {
+	return fbpm.updateState(func(state *fileProgressState) {
+		state.ApplicationReadStartTime = &startTime
+	})
+}
+
+// GetApplicationReadStartTime is needed to implement the ProgressManagerWithStartTime interface.
+func (fbpm *FileBackedProgressManager) GetApplicationReadStartTime(ctx context.Context) (time.Time, error) {
+	fbpm.mu.Lock()
+	defer fbpm.mu.Unlock()
+
+	if fbpm.state.ApplicationReadStartTime == nil {
+		return time.Time{}, nil
+	}
+	return *fbpm.state.ApplicationReadStartTime, nil
+}
+
+// SaveTableReadStartTime is needed to implement the ProgressManagerWithTableStartTime interface.
+func (fbpm *FileBackedProgressManager) SaveTableReadStartTime(ctx context.Context, table string, startTime time.Time) error {
+	return fbpm.updateState(func(state *fileProgressState) {
+		if state.TableReadStartTimes == nil {
+			state.TableReadStartTimes = make(map[string]time.Time)
+		}
+		state.TableReadStartTimes[table] = startTime
+	})
+}
+
+// GetTableReadStartTime is needed to implement the ProgressManagerWithTableStartTime interface.
+func (fbpm *FileBackedProgressManager) GetTableReadStartTime(ctx context.Context, table string) (time.Time, error) {
+	fbpm.mu.Lock()
+	defer fbpm.mu.Unlock()
+	return fbpm.state.TableReadStartTimes[table], nil
+}
+
+// ListTableReadStartTimes is needed to implement the ProgressManagerWithTableStartTime interface.
+func (fbpm *FileBackedProgressManager) ListTableReadStartTimes(ctx context.Context) (map[string]time.Time, error) {
+	fbpm.mu.Lock()
+	defer fbpm.mu.Unlock()
+	startTimes := make(map[string]time.Time, len(fbpm.state.TableReadStartTimes))
+	for table, startTime := range fbpm.state.TableReadStartTimes {
+		startTimes[table] = startTime
+	}
+	return startTimes, nil
+}
+
+// ListProgress is needed to implement the ProgressManagerWithEnumeration interface.
+func (fbpm *FileBackedProgressManager) ListProgress(ctx context.Context) ([]ProgressEntry, error) {
+	files, err := ioutil.ReadDir(fbpm.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	fbpm.mu.Lock()
+	defer fbpm.mu.Unlock()
+
+	for _, file := range files {
+		if gen, ok := parseGenerationFileName(file.Name()); ok {
+			if _, err := fbpm.getGeneration(gen); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var entries []ProgressEntry
+	for _, fpg := range fbpm.generations {
+		for table, streams := range fpg.tables {
+			for streamHex, timestamp := range streams {
+				streamID, err := hex.DecodeString(streamHex)
+				if err != nil {
+					return nil, fmt.Errorf("invalid stream ID in %s: %s", generationFileName(fpg.gen), streamHex)
+				}
+				entries = append(entries, ProgressEntry{
+					Generation: fpg.gen,
+					TableName:  table,
+					StreamID:   streamID,
+					Progress:   Progress{timestamp},
+				})
+			}
+		}
+	}
+	sortProgressEntries(entries)
+	return entries, nil
+}
+
+// DeleteProgress is needed to implement the ProgressManagerWithEnumeration interface.
+func (fbpm *FileBackedProgressManager) DeleteProgress(ctx context.Context, gen time.Time, table string, streamID StreamID) error {
+	fbpm.mu.Lock()
+	fpg, err := fbpm.getGeneration(gen)
+	if err != nil {
+		fbpm.mu.Unlock()
+		return err
+	}
+	delete(fpg.tables[table], hex.EncodeToString(streamID))
+	fpg.version++
+	savedVersion := fpg.version
+	fbpm.mu.Unlock()
+
+	return fbpm.writeGeneration(fpg, savedVersion)
+}
+
+// Clear is needed to implement the ProgressManagerWithEnumeration interface.
+func (fbpm *FileBackedProgressManager) Clear(ctx context.Context) error {
+	err := fbpm.updateState(func(state *fileProgressState) {
+		state.CurrentGeneration = nil
+		state.ApplicationReadStartTime = nil
+		state.TableReadStartTimes = nil
+		state.TableGenerations = nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fbpm.mu.Lock()
+	fbpm.generations = make(map[int64]*fileProgressGeneration)
+	fbpm.mu.Unlock()
+
+	files, err := ioutil.ReadDir(fbpm.dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if _, ok := parseGenerationFileName(file.Name()); !ok {
+			continue
+		}
+		if err := os.Remove(filepath.Join(fbpm.dir, file.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fbpm *FileBackedProgressManager) updateState(update func(state *fileProgressState)) error {
+	fbpm.stateWriteMu.Lock()
+	defer fbpm.stateWriteMu.Unlock()
+
+	fbpm.mu.Lock()
+	update(&fbpm.state)
+	data, err := json.Marshal(fbpm.state)
+	fbpm.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomically(fbpm.dir, fileProgressStateName, data)
+}
+
+// Must be called with the mutex held.
+func (fbpm *FileBackedProgressManager) getGeneration(gen time.Time) (*fileProgressGeneration, error) {
+	if fpg, ok := fbpm.generations[gen.UnixNano()]; ok {
+		return fpg, nil
+	}
+
+	fpg := &fileProgressGeneration{
+		gen:    gen,
+		tables: make(map[string]map[string]gocql.UUID),
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(fbpm.dir, generationFileName(gen)))
+	if err == nil {
+		var fpgj fileProgressGenerationJSON
+		if err := json.Unmarshal(data, &fpgj); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %s", generationFileName(gen), err)
+		}
+		if fpgj.Version != fileProgressFormatVersion {
+			return nil, fmt.Errorf("unsupported version of %s: %d", generationFileName(gen), fpgj.Version)
+		}
+		if fpgj.Tables != nil {
+			fpg.tables = fpgj.Tables
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	fbpm.generations[gen.UnixNano()] = fpg
+	return fpg, nil
+}
+
+// Writes the generation file, unless a version not older than savedVersion
+// was already written by a concurrent call.
+func (fbpm *FileBackedProgressManager) writeGeneration(fpg *fileProgressGeneration, savedVersion uint64) error {
+	fpg.writeMu.Lock()
+	defer fpg.writeMu.Unlock()
+
+	fbpm.mu.Lock()
+	if fpg.writtenVersion >= savedVersion {
+		fbpm.mu.Unlock()
+		return nil
+	}
+	version := fpg.version
+	data, err := json.Marshal(fileProgressGenerationJSON{
+		Version:    fileProgressFormatVersion,
+		Generation: fpg.gen,
+		Tables:     fpg.tables,
+	})
+	fbpm.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomically(fbpm.dir, generationFileName(fpg.gen), data); err != nil {
+		return err
+	}
+
+	fbpm.mu.Lock()
+	fpg.writtenVersion = version
+	fbpm.mu.Unlock()
+	return nil
+}
+
+// Removes files and cached progress of generations older than the current
+// generation and the current generations of all tables.
+func (fbpm *FileBackedProgressManager) compact() error {
+	fbpm.mu.Lock()
+	var current time.Time
+	if fbpm.state.CurrentGeneration != nil {
+		current = *fbpm.state.CurrentGeneration
+	}
+	for _, gen := range fbpm.state.TableGenerations {
+		if current.IsZero() || gen.Before(current) {
+			current = gen
+		}
+	}
+	for key, fpg := range fbpm.generations {
+		if fpg.gen.Before(current) {
+			delete(fbpm.generations, key)
+		}
+	}
+	fbpm.mu.Unlock()
+
+	files, err := ioutil.ReadDir(fbpm.dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		gen, ok := parseGenerationFileName(file.Name())
+		if !ok || !gen.Before(current) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(fbpm.dir, file.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Removes leftovers of writes interrupted by a crash.
+func (fbpm *FileBackedProgressManager) removeTemporaryFiles() error {
+	files, err := ioutil.ReadDir(fbpm.dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if strings.Contains(file.Name(), fileProgressTempMarker) {
+			if err := os.Remove(filepath.Join(fbpm.dir, file.Name())); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func generationFileName(gen time.Time) string {
+	return fileProgressGenerationPrefix + strconv.FormatInt(gen.UnixNano(), 10) + fileProgressGenerationSuffix
+}
+
+func parseGenerationFileName(name string) (time.Time, bool) {
+	if !strings.HasPrefix(name, fileProgressGenerationPrefix) || !strings.HasSuffix(name, fileProgressGenerationSuffix) {
+		return time.Time{}, false
+	}
+	nanos, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(name, fileProgressGenerationPrefix), fileProgressGenerationSuffix), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, nanos), true
+}
+
+// Replaces the file with given data in a crash-safe manner: the data
+// is written to a temporary file, synced and renamed to the target name.
+func writeFileAtomically(dir, name string, data []byte) error {
+	tmp, err := ioutil.TempFile(dir, name+fileProgressTempMarker+"*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpName, filepath.Join(dir, name))
+	}
+	if err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	// Make sure that the rename itself is persisted
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if closeErr := d.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+var _ ProgressManager = (*FileBackedProgressManager)(nil)
+var _ ProgressManagerWithStartTime = (*FileBackedProgressManager)(nil)
+var _ ProgressManagerWithTableStartTime = (*FileBackedProgressManager)(nil)
+var _ ProgressManagerWithEnumeration = (*FileBackedProgressManager)(nil)
+var _ ProgressManagerWithTableGeneration = (*FileBackedProgressManager)(nil)
@@ -0,0 +1,240 @@
+package scyllacdc
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+func TestFileBackedProgressManager(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scylla-cdc-go-progress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	gen1 := time.Unix(1000, 0)
+	gen2 := time.Unix(2000, 0)
+	startTime := time.Unix(500, 0)
+
+	fbpm, err := NewFileBackedProgressManager(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if gen, err := fbpm.GetCurrentGeneration(ctx); err != nil || !gen.IsZero() {
+		t.Fatalf("expected no current generation, got %v (error: %v)", gen, err)
+	}
+	if err := fbpm.SaveApplicationReadStartTime(ctx, startTime); err != nil {
+		t.Fatal(err)
+	}
+	if err := fbpm.SaveTableReadStartTime(ctx, "ks.tbl", gen1); err != nil {
+		t.Fatal(err)
+	}
+	if err := fbpm.StartGeneration(ctx, gen1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Save progress concurrently for many streams
+	const streamCount = 50
+	progressFor := make([]gocql.UUID, streamCount)
+	for i := range progressFor {
+		progressFor[i] = gocql.UUIDFromTime(gen1.Add(time.Duration(i) * time.Second))
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < streamCount; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := fbpm.SaveProgress(ctx, gen1, "ks.tbl", StreamID{byte(i)}, Progress{progressFor[i]})
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// A new manager should see everything which was saved
+	fbpm, err = NewFileBackedProgressManager(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gen, err := fbpm.GetCurrentGeneration(ctx); err != nil || !gen.Equal(gen1) {
+		t.Errorf("expected current generation %v, got %v (error: %v)", gen1, gen, err)
+	}
+	if st, err := fbpm.GetApplicationReadStartTime(ctx); err != nil || !st.Equal(startTime) {
+		t.Errorf("expected start time %v, got %v (error: %v)", startTime, st, err)
+	}
+	if st, err := fbpm.GetTableReadStartTime(ctx, "ks.tbl"); err != nil || !st.Equal(gen1) {
+		t.Errorf("expected start time of the table %v, got %v (error: %v)", gen1, st, err)
+	}
+	if st, err := fbpm.GetTableReadStartTime(ctx, "ks.other"); err != nil || !st.IsZero() {
+		t.Errorf("expected no start time of another table, got %v (error: %v)", st, err)
+	}
+	for i := 0; i < streamCount; i++ {
+		progress, err := fbpm.GetProgress(ctx, gen1, "ks.tbl", StreamID{byte(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if progress.LastProcessedRecordTime != progressFor[i] {
+			t.Errorf("expected progress %s for stream %d, got %s", progressFor[i], i, progress.LastProcessedRecordTime)
+		}
+	}
+	if progress, _ := fbpm.GetProgress(ctx, gen1, "ks.other", StreamID{0}); progress.LastProcessedRecordTime != (gocql.UUID{}) {
+		t.Errorf("expected no progress for another table, got %s", progress.LastProcessedRecordTime)
+	}
+
+	// Starting the next generation should remove the old one
+	if err := fbpm.SaveProgress(ctx, gen2, "ks.tbl", StreamID{0}, Progress{gocql.UUIDFromTime(gen2)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fbpm.StartGeneration(ctx, gen2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, generationFileName(gen1))); !os.IsNotExist(err) {
+		t.Errorf("expected the file of the old generation to be removed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, generationFileName(gen2))); err != nil {
+		t.Errorf("expected the file of the current generation to exist, got %v", err)
+	}
+
+	// Leftovers of interrupted writes should be ignored and removed
+	leftover := filepath.Join(dir, fmt.Sprintf("%s%s123", fileProgressStateName, fileProgressTempMarker))
+	if err := ioutil.WriteFile(leftover, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fbpm, err = NewFileBackedProgressManager(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+		t.Errorf("expected the temporary file to be removed, got %v", err)
+	}
+	if progress, _ := fbpm.GetProgress(ctx, gen1, "ks.tbl", StreamID{1}); progress.LastProcessedRecordTime != (gocql.UUID{}) {
+		t.Errorf("expected no progress for a removed generation, got %s", progress.LastProcessedRecordTime)
+	}
+}
+
+func TestFileBackedProgressManagerKeepsTableGenerations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scylla-cdc-go-progress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	tableGen1 := time.Unix(1000, 0)
+	tableGen2 := time.Unix(3000, 0)
+	clusterGen1 := time.Unix(2000, 0)
+	clusterGen2 := time.Unix(4000, 0)
+
+	fbpm, err := NewFileBackedProgressManager(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fbpm.StartTableGeneration(ctx, "ks.tablets", tableGen1); err != nil {
+		t.Fatal(err)
+	}
+	if err := fbpm.SaveProgress(ctx, tableGen1, "ks.tablets", StreamID{1}, Progress{gocql.UUIDFromTime(tableGen1)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fbpm.StartGeneration(ctx, clusterGen1); err != nil {
+		t.Fatal(err)
+	}
+	if err := fbpm.StartGeneration(ctx, clusterGen2); err != nil {
+		t.Fatal(err)
+	}
+
+	// The table still reads its generation, which is older than
+	// the cluster-wide one
+	if _, err := os.Stat(filepath.Join(dir, generationFileName(tableGen1))); err != nil {
+		t.Errorf("expected the file of the current generation of the table to exist, got %v", err)
+	}
+
+	fbpm, err = NewFileBackedProgressManager(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gen, err := fbpm.GetTableGeneration(ctx, "ks.tablets"); err != nil || !gen.Equal(tableGen1) {
+		t.Errorf("expected generation of the table %v, got %v (error: %v)", tableGen1, gen, err)
+	}
+	if gen, err := fbpm.GetTableGeneration(ctx, "ks.other"); err != nil || !gen.IsZero() {
+		t.Errorf("expected no generation of another table, got %v (error: %v)", gen, err)
+	}
+
+	if err := fbpm.StartTableGeneration(ctx, "ks.tablets", tableGen2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, generationFileName(tableGen1))); !os.IsNotExist(err) {
+		t.Errorf("expected the file of the old generation of the table to be removed, got %v", err)
+	}
+}
+
+func TestFileBackedProgressManagerEnumeration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scylla-cdc-go-progress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	gen := time.Unix(1000, 0)
+	progress := Progress{gocql.UUIDFromTime(gen.Add(time.Second))}
+
+	fbpm, err := NewFileBackedProgressManager(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fbpm.StartGeneration(ctx, gen); err != nil {
+		t.Fatal(err)
+	}
+	for _, streamID := range []StreamID{{0x02}, {0x01}} {
+		if err := fbpm.SaveProgress(ctx, gen, "ks.tbl", streamID, progress); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Progress should be listed also by a new manager, which did not load
+	// the generation file yet
+	fbpm, err = NewFileBackedProgressManager(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := fbpm.ListProgress(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].StreamID[0] != 0x01 || entries[1].StreamID[0] != 0x02 || entries[0].Progress != progress {
+		t.Fatalf("unexpected progress entries: %v", entries)
+	}
+
+	if err := fbpm.DeleteProgress(ctx, gen, "ks.tbl", StreamID{0x01}); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := fbpm.ListProgress(ctx); len(entries) != 1 {
+		t.Fatalf("expected one entry after deletion, got %v", entries)
+	}
+
+	if err := fbpm.Clear(ctx); err != nil {
+		t.Fatal(err)
+	}
+	fbpm, err = NewFileBackedProgressManager(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := fbpm.ListProgress(ctx); len(entries) != 0 {
+		t.Fatalf("expected no entries after clearing, got %v", entries)
+	}
+	if gen, err := fbpm.GetCurrentGeneration(ctx); err != nil || !gen.IsZero() {
+		t.Errorf("expected no current generation after clearing, got %v (error: %v)", gen, err)
+	}
+}
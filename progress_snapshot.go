@@ -0,0 +1,268 @@
+package scyllacdc
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// ProgressSnapshotJSONVersion is the version of the JSON encoding
+// of ProgressSnapshot. The version is included in the encoded snapshot,
+// and UnmarshalJSON rejects versions it does not understand.
+//
+// Version 1 of the encoding looks as follows:
+//
+//	{
+//	    "version": 1,
+//	    "current_generation": "<RFC 3339 timestamp>",
+//	    "application_read_start_time": "<RFC 3339 timestamp>",
+//	    "table_read_start_times": {
+//	        "<keyspace>.<table>": "<RFC 3339 timestamp>",
+//	        ...
+//	    },
+//	    "table_generations": {
+//	        "<keyspace>.<table>": "<RFC 3339 timestamp>",
+//	        ...
+//	    },
+//	    "progress": [
+//	        {
+//	            "generation": "<RFC 3339 timestamp>",
+//	            "table_name": "<keyspace>.<table>",
+//	            "stream_id": "<hex-encoded stream ID>",
+//	            "last_processed_record_time": "<timeuuid>"
+//	        },
+//	        ...
+//	    ]
+//	}
+//
+// The "current_generation", "application_read_start_time",
+// "table_read_start_times" and "table_generations" keys are omitted
+// if the values are not set.
+const ProgressSnapshotJSONVersion = 1
+
+// ProgressSnapshot holds all information saved by a ProgressManager
+// for an application. It can be used to move progress between
+// ProgressManagers, e.g. from a TableBackedProgressManager to one using
+// a table in a different keyspace, or to a FileBackedProgressManager.
+type ProgressSnapshot struct {
+	// The generation returned by GetCurrentGeneration. Zero if not set.
+	CurrentGeneration time.Time
+
+	// The time returned by GetApplicationReadStartTime. Zero if not set,
+	// or if the ProgressManager does not implement ProgressManagerWithStartTime.
+	ApplicationReadStartTime time.Time
+
+	// Times returned by GetTableReadStartTime, indexed by table name.
+	// Empty if the ProgressManager does not implement
+	// ProgressManagerWithTableStartTime.
+	TableReadStartTimes map[string]time.Time
+
+	// Generations returned by GetTableGeneration, indexed by table name.
+	// Empty if the ProgressManager does not implement
+	// ProgressManagerWithTableGeneration.
+	TableGenerations map[string]time.Time
+
+	// Progress of streams, ordered by generation, table name and stream ID.
+	Entries []ProgressEntry
+}
+
+type progressSnapshotJSON struct {
+	Version                  int                  `json:"version"`
+	CurrentGeneration        *time.Time           `json:"current_generation,omitempty"`
+	ApplicationReadStartTime *time.Time           `json:"application_read_start_time,omitempty"`
+	TableReadStartTimes      map[string]time.Time `json:"table_read_start_times,omitempty"`
+	TableGenerations         map[string]time.Time `json:"table_generations,omitempty"`
+	Progress                 []progressEntryJSON  `json:"progress"`
+}
+
+type progressEntryJSON struct {
+	Generation              time.Time  `json:"generation"`
+	TableName               string     `json:"table_name"`
+	StreamID                string     `json:"stream_id"`
+	LastProcessedRecordTime gocql.UUID `json:"last_processed_record_time"`
+}
+
+// MarshalJSON encodes the snapshot in the format described
+// by ProgressSnapshotJSONVersion.
+func (ps *ProgressSnapshot) MarshalJSON() ([]byte, error) {
+	psj := progressSnapshotJSON{
+		Version:  ProgressSnapshotJSONVersion,
+		Progress: make([]progressEntryJSON, 0, len(ps.Entries)),
+	}
+	if !ps.CurrentGeneration.IsZero() {
+		psj.CurrentGeneration = &ps.CurrentGeneration
+	}
+	if !ps.ApplicationReadStartTime.IsZero() {
+		psj.ApplicationReadStartTime = &ps.ApplicationReadStartTime
+	}
+	if len(ps.TableReadStartTimes) > 0 {
+		psj.TableReadStartTimes = ps.TableReadStartTimes
+	}
+	if len(ps.TableGenerations) > 0 {
+		psj.TableGenerations = ps.TableGenerations
+	}
+	for _, entry := range ps.Entries {
+		psj.Progress = append(psj.Progress, progressEntryJSON{
+			Generation:              entry.Generation,
+			TableName:               entry.TableName,
+			StreamID:                hex.EncodeToString(entry.StreamID),
+			LastProcessedRecordTime: entry.Progress.LastProcessedRecordTime,
+		})
+	}
+	return json.Marshal(psj)
+}
+
+// UnmarshalJSON decodes a snapshot encoded by MarshalJSON.
+func (ps *ProgressSnapshot) UnmarshalJSON(data []byte) error {
+	var psj progressSnapshotJSON
+	if err := json.Unmarshal(data, &psj); err != nil {
+		return err
+	}
+	if psj.Version != ProgressSnapshotJSONVersion {
+		return fmt.Errorf("unsupported version of the progress snapshot: %d", psj.Version)
+	}
+
+	*ps = ProgressSnapshot{}
+	if psj.CurrentGeneration != nil {
+		ps.CurrentGeneration = *psj.CurrentGeneration
+	}
+	if psj.ApplicationReadStartTime != nil {
+		ps.ApplicationReadStartTime = *psj.ApplicationReadStartTime
+	}
+	ps.TableReadStartTimes = psj.TableReadStartTimes
+	ps.TableGenerations = psj.TableGenerations
+	for _, entry := range psj.Progress {
+		streamID, err := hex.DecodeString(entry.StreamID)
+		if err != nil {
+			return fmt.Errorf("invalid stream ID in the progress snapshot: %s", entry.StreamID)
+		}
+		ps.Entries = append(ps.Entries, ProgressEntry{
+			Generation: entry.Generation,
+			TableName:  entry.TableName,
+			StreamID:   streamID,
+			Progress:   Progress{entry.LastProcessedRecordTime},
+		})
+	}
+	return nil
+}
+
+// ExportProgress returns a snapshot of all information saved by given
+// ProgressManager. The ProgressManager must implement
+// the ProgressManagerWithEnumeration interface.
+//
+// The snapshot is consistent only if the ProgressManager is not used
+// by a running Reader.
+func ExportProgress(ctx context.Context, pm ProgressManager) (*ProgressSnapshot, error) {
+	withEnumeration, ok := pm.(ProgressManagerWithEnumeration)
+	if !ok {
+		return nil, errors.New("the progress manager does not support enumeration of progress")
+	}
+
+	gen, err := pm.GetCurrentGeneration(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var startTime time.Time
+	if withStartTime, ok := pm.(ProgressManagerWithStartTime); ok {
+		startTime, err = withStartTime.GetApplicationReadStartTime(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var tableStartTimes map[string]time.Time
+	if withTableStartTime, ok := pm.(ProgressManagerWithTableStartTime); ok {
+		tableStartTimes, err = withTableStartTime.ListTableReadStartTimes(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var tableGens map[string]time.Time
+	if withTableGen, ok := pm.(ProgressManagerWithTableGeneration); ok {
+		tableGens, err = withTableGen.ListTableGenerations(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	entries, err := withEnumeration.ListProgress(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ProgressSnapshot{
+		CurrentGeneration:        gen,
+		ApplicationReadStartTime: startTime,
+		TableReadStartTimes:      tableStartTimes,
+		TableGenerations:         tableGens,
+		Entries:                  entries,
+	}, nil
+}
+
+// ImportProgress saves the information from the snapshot in given
+// ProgressManager. If the ProgressManager implements
+// the ProgressManagerWithEnumeration interface, information previously
+// saved in it is removed first. If the snapshot has an application start
+// time, the ProgressManager must implement ProgressManagerWithStartTime,
+// if it has start times of tables, ProgressManagerWithTableStartTime,
+// and if it has generations of tables, ProgressManagerWithTableGeneration.
+//
+// The ProgressManager must not be used by a running Reader.
+func ImportProgress(ctx context.Context, pm ProgressManager, snapshot *ProgressSnapshot) error {
+	withStartTime, hasStartTime := pm.(ProgressManagerWithStartTime)
+	if !snapshot.ApplicationReadStartTime.IsZero() && !hasStartTime {
+		return errors.New("the progress manager does not support saving the application start time")
+	}
+	withTableStartTime, hasTableStartTime := pm.(ProgressManagerWithTableStartTime)
+	if len(snapshot.TableReadStartTimes) > 0 && !hasTableStartTime {
+		return errors.New("the progress manager does not support saving start times of tables")
+	}
+	withTableGen, hasTableGen := pm.(ProgressManagerWithTableGeneration)
+	if len(snapshot.TableGenerations) > 0 && !hasTableGen {
+		return errors.New("the progress manager does not support saving generations of tables")
+	}
+
+	if withEnumeration, ok := pm.(ProgressManagerWithEnumeration); ok {
+		if err := withEnumeration.Clear(ctx); err != nil {
+			return err
+		}
+	}
+
+	if !snapshot.ApplicationReadStartTime.IsZero() {
+		if err := withStartTime.SaveApplicationReadStartTime(ctx, snapshot.ApplicationReadStartTime); err != nil {
+			return err
+		}
+	}
+	for table, startTime := range snapshot.TableReadStartTimes {
+		if err := withTableStartTime.SaveTableReadStartTime(ctx, table, startTime); err != nil {
+			return err
+		}
+	}
+	if !snapshot.CurrentGeneration.IsZero() {
+		if err := pm.StartGeneration(ctx, snapshot.CurrentGeneration); err != nil {
+			return err
+		}
+	}
+	for table, gen := range snapshot.TableGenerations {
+		if err := withTableGen.StartTableGeneration(ctx, table, gen); err != nil {
+			return err
+		}
+	}
+	for _, entry := range snapshot.Entries {
+		if err := pm.SaveProgress(ctx, entry.Generation, entry.TableName, entry.StreamID, entry.Progress); err != nil {
+			return err
+		}
+	}
+
+	if withFlush, ok := pm.(ProgressManagerWithFlush); ok {
+		return withFlush.Flush(ctx)
+	}
+	return nil
+}
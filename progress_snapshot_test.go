@@ -0,0 +1,130 @@
+package scyllacdc
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+func TestProgressSnapshotExportImport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scylla-cdc-go-progress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	gen1 := time.Unix(1000, 0).UTC()
+	gen2 := time.Unix(2000, 0).UTC()
+	startTime := time.Unix(500, 0).UTC()
+
+	source := NewInMemoryProgressManager()
+	if err := source.SaveApplicationReadStartTime(ctx, startTime); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.SaveTableReadStartTime(ctx, "ks.tbl", startTime.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.StartGeneration(ctx, gen2); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.StartTableGeneration(ctx, "ks.tablets", gen1); err != nil {
+		t.Fatal(err)
+	}
+	saved := map[time.Time][]StreamID{
+		gen1: {{0x01}},
+		gen2: {{0x02}, {0x03}},
+	}
+	for gen, streams := range saved {
+		for _, streamID := range streams {
+			progress := Progress{gocql.UUIDFromTime(gen.Add(time.Second))}
+			if err := source.SaveProgress(ctx, gen, "ks.tbl", streamID, progress); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	snapshot, err := ExportProgress(ctx, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The snapshot should survive encoding
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded ProgressSnapshot
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	expectSameSnapshot(t, snapshot, &decoded)
+
+	// Progress previously saved in the destination should be replaced
+	destination, err := NewFileBackedProgressManager(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := destination.SaveProgress(ctx, gen2, "ks.other", StreamID{0x04}, Progress{gocql.UUIDFromTime(gen2)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := destination.SaveTableReadStartTime(ctx, "ks.other", startTime); err != nil {
+		t.Fatal(err)
+	}
+	if err := ImportProgress(ctx, destination, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	imported, err := ExportProgress(ctx, destination)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectSameSnapshot(t, snapshot, imported)
+}
+
+func expectSameSnapshot(t *testing.T, expected, actual *ProgressSnapshot) {
+	t.Helper()
+	if !actual.CurrentGeneration.Equal(expected.CurrentGeneration) || !actual.ApplicationReadStartTime.Equal(expected.ApplicationReadStartTime) {
+		t.Errorf("expected generation %v and start time %v, got %v and %v",
+			expected.CurrentGeneration, expected.ApplicationReadStartTime,
+			actual.CurrentGeneration, actual.ApplicationReadStartTime)
+	}
+	if len(actual.TableReadStartTimes) != len(expected.TableReadStartTimes) {
+		t.Errorf("expected table start times %v, got %v", expected.TableReadStartTimes, actual.TableReadStartTimes)
+	}
+	for table, startTime := range expected.TableReadStartTimes {
+		if !actual.TableReadStartTimes[table].Equal(startTime) {
+			t.Errorf("expected start time %v of table %s, got %v", startTime, table, actual.TableReadStartTimes[table])
+		}
+	}
+	if len(actual.TableGenerations) != len(expected.TableGenerations) {
+		t.Errorf("expected table generations %v, got %v", expected.TableGenerations, actual.TableGenerations)
+	}
+	for table, gen := range expected.TableGenerations {
+		if !actual.TableGenerations[table].Equal(gen) {
+			t.Errorf("expected generation %v of table %s, got %v", gen, table, actual.TableGenerations[table])
+		}
+	}
+	if len(actual.Entries) != len(expected.Entries) {
+		t.Fatalf("expected entries %v, got %v", expected.Entries, actual.Entries)
+	}
+	for i, entry := range actual.Entries {
+		e := expected.Entries[i]
+		if !entry.Generation.Equal(e.Generation) || entry.TableName != e.TableName ||
+			string(entry.StreamID) != string(e.StreamID) || entry.Progress != e.Progress {
+			t.Errorf("expected entry %v, got %v", e, entry)
+		}
+	}
+}
+
+func TestProgressSnapshotRejectsUnknownVersion(t *testing.T) {
+	var snapshot ProgressSnapshot
+	if err := json.Unmarshal([]byte(`{"version": 2, "progress": []}`), &snapshot); err == nil {
+		t.Fatal("expected an error for an unknown version")
+	}
+}
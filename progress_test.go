@@ -0,0 +1,142 @@
+package scyllacdc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/scylladb/scylla-cdc-go/internal/testutils"
+)
+
+func TestTableBackedProgressManagerDeletesFinishedGenerations(t *testing.T) {
+	// Configure a session
+	address := testutils.GetSourceClusterContactPoint()
+	keyspaceName := testutils.CreateUniqueKeyspace(t, address)
+	cluster := gocql.NewCluster(address)
+	cluster.Keyspace = keyspaceName
+	session, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+
+	ctx := context.Background()
+	gen1 := time.Unix(1000, 0)
+	gen2 := time.Unix(2000, 0)
+	gen3 := time.Unix(3000, 0)
+	streamID := StreamID{0x0A}
+	progress := Progress{gocql.MinTimeUUID(time.Unix(1500, 0))}
+
+	progressManager, err := NewTableBackedProgressManager(session, "progress", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherProgressManager, err := NewTableBackedProgressManager(session, "progress", "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	progressManager.SetTTL(0)
+	progressManager.SetGenerationCleanup(true)
+
+	for _, pm := range []*TableBackedProgressManager{progressManager, otherProgressManager} {
+		if err := pm.SaveApplicationReadStartTime(ctx, gen1); err != nil {
+			t.Fatal(err)
+		}
+		for _, gen := range []time.Time{gen1, gen2} {
+			if err := pm.StartGeneration(ctx, gen); err != nil {
+				t.Fatal(err)
+			}
+			if err := pm.SaveProgress(ctx, gen, "ks.tbl", streamID, progress); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := progressManager.StartGeneration(ctx, gen3); err != nil {
+		t.Fatal(err)
+	}
+
+	expectProgress := func(pm *TableBackedProgressManager, gen time.Time, expected Progress) {
+		t.Helper()
+		actual, err := pm.GetProgress(ctx, gen, "ks.tbl", streamID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual != expected {
+			t.Errorf("expected progress %v in generation %v, got %v", expected, gen, actual)
+		}
+	}
+
+	// Only progress older than the previous generation should be removed
+	expectProgress(progressManager, gen1, Progress{})
+	expectProgress(progressManager, gen2, progress)
+
+	// Other applications should not be affected
+	expectProgress(otherProgressManager, gen1, progress)
+
+	if gen, err := progressManager.GetCurrentGeneration(ctx); err != nil || !gen.Equal(gen3) {
+		t.Errorf("expected current generation %v, got %v (error: %v)", gen3, gen, err)
+	}
+	if startTime, err := progressManager.GetApplicationReadStartTime(ctx); err != nil || !startTime.Equal(gen1) {
+		t.Errorf("expected application start time %v, got %v (error: %v)", gen1, startTime, err)
+	}
+}
+
+func TestTableBackedProgressManagerStatementInBatch(t *testing.T) {
+	// Configure a session
+	address := testutils.GetSourceClusterContactPoint()
+	keyspaceName := testutils.CreateUniqueKeyspace(t, address)
+	cluster := gocql.NewCluster(address)
+	cluster.Keyspace = keyspaceName
+	session, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+
+	if err := session.Query("CREATE TABLE destination (pk int PRIMARY KEY, v int)").Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	gen := time.Unix(1000, 0)
+	streamID := StreamID{0x0A}
+	progress := Progress{gocql.MinTimeUUID(time.Unix(1500, 0))}
+
+	progressManager, err := NewTableBackedProgressManager(session, "progress", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reporter := &ProgressReporter{
+		progressManager: progressManager,
+		gen:             gen,
+		tableName:       "ks.tbl",
+		streamID:        streamID,
+	}
+	if !reporter.SupportsProgressStatement() {
+		t.Fatal("expected progress statements to be supported")
+	}
+
+	stmt, err := reporter.ProgressStatement(ctx, progress)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The statement should take effect even if the batch has an earlier timestamp
+	batch := session.NewBatch(gocql.LoggedBatch).WithContext(ctx)
+	batch.WithTimestamp(progress.LastProcessedRecordTime.Time().UnixNano() / int64(time.Microsecond))
+	batch.Query("INSERT INTO destination (pk, v) VALUES (?, ?)", 1, 2)
+	batch.Query(stmt.Query, stmt.Values...)
+	if err := session.ExecuteBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+
+	var v int
+	if err := session.Query("SELECT v FROM destination WHERE pk = ?", 1).Scan(&v); err != nil || v != 2 {
+		t.Errorf("expected the write of the batch to be applied, got %d (error: %v)", v, err)
+	}
+	if actual, err := progressManager.GetProgress(ctx, gen, "ks.tbl", streamID); err != nil || actual != progress {
+		t.Errorf("expected progress %v, got %v (error: %v)", progress, actual, err)
+	}
+}
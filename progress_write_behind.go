@@ -0,0 +1,275 @@
+package scyllacdc
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ProgressWriteBehindConfig configures the write-behind mode
+// of TableBackedProgressManager.
+type ProgressWriteBehindConfig struct {
+	// How often buffered progress is written to the progress table.
+	//
+	// If the parameter is left as 0, progress will be written every 10 seconds.
+	FlushInterval time.Duration
+
+	// If the number of streams with buffered progress reaches this value,
+	// SaveProgress writes all buffered progress before returning.
+	//
+	// If the parameter is left as 0, the limit of 1000 streams will be used.
+	MaxPendingStreams int
+
+	// Called with errors which occurred while writing progress in
+	// the background, after FlushInterval has passed. Progress which
+	// failed to be written is kept and written again during the next flush.
+	// Errors of flushes triggered by SaveProgress, StartGeneration or Flush
+	// are returned from those methods instead.
+	//
+	// If not set, background errors are ignored.
+	OnFlushError func(err error)
+}
+
+func (pwbc *ProgressWriteBehindConfig) setDefaults() {
+	if pwbc.FlushInterval == 0 {
+		pwbc.FlushInterval = 10 * time.Second
+	}
+	if pwbc.MaxPendingStreams == 0 {
+		pwbc.MaxPendingStreams = 1000
+	}
+}
+
+type pendingProgressKey struct {
+	gen      int64
+	table    string
+	streamID string
+}
+
+type pendingProgress struct {
+	gen      time.Time
+	table    string
+	streamID StreamID
+	progress Progress
+
+	// Write timestamp taken when the progress was saved
+	timestamp int64
+}
+
+// progressWriteBehind buffers progress of streams and writes only
+// the most recent progress of each stream, periodically or when
+// explicitly flushed.
+type progressWriteBehind struct {
+	config ProgressWriteBehindConfig
+	write  func(ctx context.Context, pp pendingProgress) error
+
+	mu      sync.Mutex
+	pending map[pendingProgressKey]pendingProgress
+
+	// Set after the background goroutine is stopped. From then on,
+	// progress is written right away, as nothing would flush it later.
+	stopped bool
+
+	// Serializes flushes, so that an older progress of a stream
+	// is never written after a newer one
+	flushMu sync.Mutex
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+	finishCh chan struct{}
+}
+
+func newProgressWriteBehind(
+	config ProgressWriteBehindConfig,
+	write func(ctx context.Context, pp pendingProgress) error,
+) *progressWriteBehind {
+	config.setDefaults()
+	return &progressWriteBehind{
+		config: config,
+		write:  write,
+
+		pending: make(map[pendingProgressKey]pendingProgress),
+
+		stopCh:   make(chan struct{}),
+		finishCh: make(chan struct{}),
+	}
+}
+
+func (pwb *progressWriteBehind) start() {
+	go func() {
+		defer close(pwb.finishCh)
+		ticker := time.NewTicker(pwb.config.FlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-pwb.stopCh:
+				return
+			}
+
+			err := pwb.flush(context.Background())
+			if err != nil && pwb.config.OnFlushError != nil {
+				pwb.config.OnFlushError(err)
+			}
+		}
+	}()
+}
+
+// Stops the background goroutine started by start. It can be called
+// multiple times.
+func (pwb *progressWriteBehind) stop() {
+	pwb.stopOnce.Do(func() {
+		pwb.mu.Lock()
+		pwb.stopped = true
+		pwb.mu.Unlock()
+
+		close(pwb.stopCh)
+		<-pwb.finishCh
+	})
+}
+
+// Stops the background goroutine and writes buffered progress. Progress
+// which could not be written is moved to next, so that it is not lost.
+func (pwb *progressWriteBehind) stopAndHandOver(ctx context.Context, next *progressWriteBehind) error {
+	pwb.stop()
+	err := pwb.flush(ctx)
+
+	pwb.mu.Lock()
+	remaining := pwb.pending
+	pwb.pending = make(map[pendingProgressKey]pendingProgress)
+	pwb.mu.Unlock()
+
+	next.mu.Lock()
+	for key, pp := range remaining {
+		if _, ok := next.pending[key]; !ok {
+			next.pending[key] = pp
+		}
+	}
+	next.mu.Unlock()
+	return err
+}
+
+func (pwb *progressWriteBehind) save(ctx context.Context, gen time.Time, table string, streamID StreamID, progress Progress) error {
+	pp := pendingProgress{
+		gen:      gen,
+		table:    table,
+		streamID: streamID,
+		progress: progress,
+
+		timestamp: nextProgressWriteTimestamp(),
+	}
+
+	pwb.mu.Lock()
+	if pwb.stopped {
+		pwb.mu.Unlock()
+		return pwb.write(ctx, pp)
+	}
+	pwb.pending[makePendingProgressKey(gen, table, streamID)] = pp
+	full := len(pwb.pending) >= pwb.config.MaxPendingStreams
+	pwb.mu.Unlock()
+
+	if full {
+		return pwb.flush(ctx)
+	}
+	return nil
+}
+
+// Returns progress which was saved, but not written yet.
+func (pwb *progressWriteBehind) get(gen time.Time, table string, streamID StreamID) (Progress, bool) {
+	pwb.mu.Lock()
+	defer pwb.mu.Unlock()
+	pp, ok := pwb.pending[makePendingProgressKey(gen, table, streamID)]
+	return pp.progress, ok
+}
+
+// Drops progress of given stream which was saved, but not written yet.
+func (pwb *progressWriteBehind) discard(gen time.Time, table string, streamID StreamID) {
+	pwb.mu.Lock()
+	defer pwb.mu.Unlock()
+	delete(pwb.pending, makePendingProgressKey(gen, table, streamID))
+}
+
+// Drops all progress which was saved, but not written yet.
+func (pwb *progressWriteBehind) discardAll() {
+	pwb.mu.Lock()
+	defer pwb.mu.Unlock()
+	pwb.pending = make(map[pendingProgressKey]pendingProgress)
+}
+
+func (pwb *progressWriteBehind) flush(ctx context.Context) error {
+	pwb.flushMu.Lock()
+	defer pwb.flushMu.Unlock()
+
+	pwb.mu.Lock()
+	toWrite := pwb.pending
+	pwb.pending = make(map[pendingProgressKey]pendingProgress)
+	pwb.mu.Unlock()
+
+	if len(toWrite) == 0 {
+		return nil
+	}
+
+	var (
+		wg       sync.WaitGroup
+		errMu    sync.Mutex
+		firstErr error
+		failed   []pendingProgressKey
+	)
+	for key, pp := range toWrite {
+		key, pp := key, pp
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := pwb.write(ctx, pp); err != nil {
+				errMu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				failed = append(failed, key)
+				errMu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(failed) > 0 {
+		// Put back progress which could not be written, unless a newer
+		// progress was saved in the meantime
+		pwb.mu.Lock()
+		for _, key := range failed {
+			if _, ok := pwb.pending[key]; !ok {
+				pwb.pending[key] = toWrite[key]
+			}
+		}
+		pwb.mu.Unlock()
+	}
+	return firstErr
+}
+
+var lastProgressWriteTimestamp int64
+
+// Returns a write timestamp, in microseconds, for a write of progress.
+// Progress is written with timestamps taken when it is saved, not when
+// the write is executed, so that a flush of older progress which is
+// in progress can't overwrite progress saved later, e.g. with a progress
+// statement. The timestamps are strictly increasing within the process.
+func nextProgressWriteTimestamp() int64 {
+	for {
+		last := atomic.LoadInt64(&lastProgressWriteTimestamp)
+		ts := time.Now().UnixNano() / int64(time.Microsecond)
+		if ts <= last {
+			ts = last + 1
+		}
+		if atomic.CompareAndSwapInt64(&lastProgressWriteTimestamp, last, ts) {
+			return ts
+		}
+	}
+}
+
+func makePendingProgressKey(gen time.Time, table string, streamID StreamID) pendingProgressKey {
+	return pendingProgressKey{
+		gen:      gen.UnixNano(),
+		table:    table,
+		streamID: string(streamID),
+	}
+}
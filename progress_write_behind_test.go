@@ -0,0 +1,243 @@
+package scyllacdc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+type recordingProgressWriter struct {
+	mu      sync.Mutex
+	written map[string][]Progress
+	failing bool
+}
+
+func (rpw *recordingProgressWriter) write(ctx context.Context, pp pendingProgress) error {
+	rpw.mu.Lock()
+	defer rpw.mu.Unlock()
+	if rpw.failing {
+		return errors.New("write failed")
+	}
+	if rpw.written == nil {
+		rpw.written = make(map[string][]Progress)
+	}
+	rpw.written[string(pp.streamID)] = append(rpw.written[string(pp.streamID)], pp.progress)
+	return nil
+}
+
+func (rpw *recordingProgressWriter) getWritten(streamID StreamID) []Progress {
+	rpw.mu.Lock()
+	defer rpw.mu.Unlock()
+	return append([]Progress{}, rpw.written[string(streamID)]...)
+}
+
+func (rpw *recordingProgressWriter) setFailing(failing bool) {
+	rpw.mu.Lock()
+	defer rpw.mu.Unlock()
+	rpw.failing = failing
+}
+
+func TestProgressWriteBehindKeepsLatestProgress(t *testing.T) {
+	ctx := context.Background()
+	gen := time.Unix(1000, 0)
+	streamA := StreamID{0x0A}
+	streamB := StreamID{0x0B}
+	times := []gocql.UUID{
+		gocql.MinTimeUUID(time.Unix(1001, 0)),
+		gocql.MinTimeUUID(time.Unix(1002, 0)),
+		gocql.MinTimeUUID(time.Unix(1003, 0)),
+	}
+
+	writer := &recordingProgressWriter{}
+	pwb := newProgressWriteBehind(ProgressWriteBehindConfig{}, writer.write)
+
+	for _, tm := range times {
+		if err := pwb.save(ctx, gen, "ks.tbl", streamA, Progress{tm}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pwb.save(ctx, gen, "ks.tbl", streamB, Progress{times[0]}); err != nil {
+		t.Fatal(err)
+	}
+
+	if progress, ok := pwb.get(gen, "ks.tbl", streamA); !ok || progress.LastProcessedRecordTime != times[2] {
+		t.Fatalf("expected pending progress %v, got %v", times[2], progress.LastProcessedRecordTime)
+	}
+	if written := writer.getWritten(streamA); len(written) != 0 {
+		t.Fatalf("expected no writes before flush, got %v", written)
+	}
+
+	if err := pwb.flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if written := writer.getWritten(streamA); len(written) != 1 || written[0].LastProcessedRecordTime != times[2] {
+		t.Fatalf("expected only the latest progress to be written, got %v", written)
+	}
+	if written := writer.getWritten(streamB); len(written) != 1 {
+		t.Fatalf("expected progress of the second stream to be written, got %v", written)
+	}
+	if _, ok := pwb.get(gen, "ks.tbl", streamA); ok {
+		t.Fatal("expected no pending progress after flush")
+	}
+}
+
+func TestProgressWriteBehindFlushesWhenFull(t *testing.T) {
+	ctx := context.Background()
+	gen := time.Unix(1000, 0)
+	progress := Progress{gocql.MinTimeUUID(time.Unix(1001, 0))}
+
+	writer := &recordingProgressWriter{}
+	pwb := newProgressWriteBehind(ProgressWriteBehindConfig{MaxPendingStreams: 2}, writer.write)
+
+	if err := pwb.save(ctx, gen, "ks.tbl", StreamID{0x01}, progress); err != nil {
+		t.Fatal(err)
+	}
+	if written := writer.getWritten(StreamID{0x01}); len(written) != 0 {
+		t.Fatalf("expected no writes below the limit, got %v", written)
+	}
+	if err := pwb.save(ctx, gen, "ks.tbl", StreamID{0x02}, progress); err != nil {
+		t.Fatal(err)
+	}
+	if written := writer.getWritten(StreamID{0x01}); len(written) != 1 {
+		t.Fatalf("expected a flush after reaching the limit, got %v", written)
+	}
+}
+
+func TestProgressWriteBehindRetriesFailedWrites(t *testing.T) {
+	ctx := context.Background()
+	gen := time.Unix(1000, 0)
+	streamID := StreamID{0x0A}
+	progress := Progress{gocql.MinTimeUUID(time.Unix(1001, 0))}
+
+	writer := &recordingProgressWriter{failing: true}
+	pwb := newProgressWriteBehind(ProgressWriteBehindConfig{}, writer.write)
+
+	if err := pwb.save(ctx, gen, "ks.tbl", streamID, progress); err != nil {
+		t.Fatal(err)
+	}
+	if err := pwb.flush(ctx); err == nil {
+		t.Fatal("expected the flush to fail")
+	}
+	if _, ok := pwb.get(gen, "ks.tbl", streamID); !ok {
+		t.Fatal("expected progress to be kept after a failed write")
+	}
+
+	writer.setFailing(false)
+	if err := pwb.flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if written := writer.getWritten(streamID); len(written) != 1 {
+		t.Fatalf("expected progress to be written after retry, got %v", written)
+	}
+}
+
+func TestProgressWriteBehindReportsBackgroundErrors(t *testing.T) {
+	ctx := context.Background()
+	errCh := make(chan error, 1)
+
+	writer := &recordingProgressWriter{failing: true}
+	pwb := newProgressWriteBehind(ProgressWriteBehindConfig{
+		FlushInterval: 10 * time.Millisecond,
+		OnFlushError: func(err error) {
+			select {
+			case errCh <- err:
+			default:
+			}
+		},
+	}, writer.write)
+	pwb.start()
+	defer pwb.stop()
+
+	progress := Progress{gocql.MinTimeUUID(time.Unix(1001, 0))}
+	if err := pwb.save(ctx, time.Unix(1000, 0), "ks.tbl", StreamID{0x0A}, progress); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-errCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a background flush error to be reported")
+	}
+}
+
+func TestProgressWriteBehindWritesDirectlyAfterStop(t *testing.T) {
+	ctx := context.Background()
+	streamID := StreamID{0x0A}
+	progress := Progress{gocql.MinTimeUUID(time.Unix(1001, 0))}
+
+	writer := &recordingProgressWriter{}
+	pwb := newProgressWriteBehind(ProgressWriteBehindConfig{}, writer.write)
+	pwb.start()
+	pwb.stop()
+
+	// Stopping again must not panic
+	pwb.stop()
+
+	if err := pwb.save(ctx, time.Unix(1000, 0), "ks.tbl", streamID, progress); err != nil {
+		t.Fatal(err)
+	}
+	if written := writer.getWritten(streamID); len(written) != 1 {
+		t.Fatalf("expected progress saved after stop to be written right away, got %v", written)
+	}
+}
+
+func TestProgressWriteBehindHandsOverPendingProgress(t *testing.T) {
+	ctx := context.Background()
+	gen := time.Unix(1000, 0)
+	streamA := StreamID{0x0A}
+	streamB := StreamID{0x0B}
+	progress := Progress{gocql.MinTimeUUID(time.Unix(1001, 0))}
+
+	writer := &recordingProgressWriter{}
+	prev := newProgressWriteBehind(ProgressWriteBehindConfig{}, writer.write)
+	prev.start()
+	if err := prev.save(ctx, gen, "ks.tbl", streamA, progress); err != nil {
+		t.Fatal(err)
+	}
+
+	next := newProgressWriteBehind(ProgressWriteBehindConfig{}, writer.write)
+	if err := prev.stopAndHandOver(ctx, next); err != nil {
+		t.Fatal(err)
+	}
+	if written := writer.getWritten(streamA); len(written) != 1 {
+		t.Fatalf("expected buffered progress to be written before replacing the writer, got %v", written)
+	}
+
+	// Progress which fails to be written is moved to the next writer
+	failingWriter := &recordingProgressWriter{failing: true}
+	prev = newProgressWriteBehind(ProgressWriteBehindConfig{}, failingWriter.write)
+	prev.start()
+	if err := prev.save(ctx, gen, "ks.tbl", streamB, progress); err != nil {
+		t.Fatal(err)
+	}
+	if err := prev.stopAndHandOver(ctx, next); err == nil {
+		t.Fatal("expected the flush to fail")
+	}
+	if _, ok := next.get(gen, "ks.tbl", streamB); !ok {
+		t.Fatal("expected progress which failed to be written to be moved to the next writer")
+	}
+}
+
+func TestProgressWriteBehindKeepsSaveTimestamps(t *testing.T) {
+	ctx := context.Background()
+	gen := time.Unix(1000, 0)
+	streamID := StreamID{0x0A}
+
+	writer := &recordingProgressWriter{}
+	pwb := newProgressWriteBehind(ProgressWriteBehindConfig{}, writer.write)
+
+	if err := pwb.save(ctx, gen, "ks.tbl", streamID, Progress{gocql.MinTimeUUID(time.Unix(1001, 0))}); err != nil {
+		t.Fatal(err)
+	}
+	saved := pwb.pending[makePendingProgressKey(gen, "ks.tbl", streamID)].timestamp
+
+	// A progress statement created later must win over the buffered
+	// progress, even if the buffered one is written after it
+	if later := nextProgressWriteTimestamp(); later <= saved {
+		t.Errorf("expected timestamp %d to be later than the timestamp of buffered progress %d", later, saved)
+	}
+}
@@ -4,7 +4,11 @@ import (
 	"context"
 	"encoding/binary"
 	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -17,11 +21,33 @@ type ReaderConfig struct {
 	// An active gocql session to the cluster.
 	Session *gocql.Session
 
+	// A source of generations, streams and CDC log rows. If not specified,
+	// a GocqlDataSource using the Session will be created.
+	DataSource DataSource
+
 	// Names of the tables for which to read changes. This should be the name
 	// of the base table, not the cdc log table.
 	// Can be prefixed with keyspace name.
+	//
+	// Tables with their own generations, such as tables of tablet-based
+	// keyspaces, are supported if the DataSource implements
+	// the DataSourceWithTableGenerations interface. Each of them switches
+	// generations independently of the other tables.
 	TableNames []string
 
+	// Columns of the base tables which should be fetched from the CDC log,
+	// indexed by fully qualified table name. For a table present in this map,
+	// only listed columns, their cdc$deleted_ and cdc$deleted_elements_
+	// columns and the cdc$ metadata columns are fetched; other columns are
+	// reported as absent by ChangeRow accessors. Remember to list primary
+	// key columns if the consumer needs them.
+	// Tables which are not present in the map have all columns fetched.
+	ColumnProjections map[string][]string
+
+	// Selects which rows of the CDC log are delivered to consumers. By default,
+	// all rows are delivered.
+	RowFilter RowFilter
+
 	// Consistency to use when querying CDC log.
 	// If not specified, QUORUM consistency will be used.
 	Consistency gocql.Consistency
@@ -37,17 +63,143 @@ type ReaderConfig struct {
 	// A logger. If set, it will receive log messages useful for debugging of the library.
 	Logger Logger
 
+	// Receives measurements of the reader's activity, such as poll latency,
+	// number of rows read or lag. If not set, measurements are discarded.
+	Metrics ReaderMetrics
+
+	// Receives notifications about generations which are discovered,
+	// started and drained by the reader, including the generations of
+	// tables which have their own. If not set, notifications are discarded.
+	GenerationObserver GenerationObserver
+
+	// If set, the Reader shares the work of reading changes with other
+	// Readers which use the same lease store. Stream groups are split
+	// between the Readers, and each of them only reads the groups whose
+	// leases it holds. If not set, the Reader reads all streams.
+	// Coordination is not supported for tables with their own generations.
+	Coordination *StreamCoordinationConfig
+
+	// If ShardCount is set, the Reader reads only the stream groups which
+	// are assigned to the shard with index ShardIndex, which must be
+	// in range [0, ShardCount). Readers with the same ShardCount and
+	// all indexes from that range together read all streams.
+	//
+	// A group of streams is assigned to a shard based on the hash of its
+	// vnode index, so the assignment doesn't change between generations
+	// as long as the number of vnodes in the cluster stays the same.
+	//
+	// If ShardCount is left as 0, the Reader reads all stream groups.
+	ShardIndex int
+	ShardCount int
+
+	// If set, streams are grouped by the nodes which own them, instead of
+	// by vnodes, and the queries of each group are routed to one of the nodes.
+	// Streams owned by the same nodes in all keyspaces of the read tables
+	// are put into the same group, up to AdvancedReaderConfig.MaxStreamsPerGroup
+	// streams, which reduces the number of queries and avoids forwarding
+	// them between the nodes. The routing requires
+	// the session to use ClusterEventPolicy, which also implements
+	// this interface. Streams of tables with their own generations are
+	// always grouped by vnodes.
+	//
+	// Groups built from replicas depend on the view of the ring of each
+	// Reader, and Readers which share the streams must build the same
+	// groups. Therefore, if ShardCount or Coordination is set, streams are
+	// grouped by vnodes, and only the routing of the queries is used.
+	ReplicaLocator ReplicaLocator
+
 	// Advanced parameters.
 	Advanced AdvancedReaderConfig
 }
 
+// StreamCoordinationConfig configures sharing of the work between Readers
+// which run in separate processes.
+//
+// Groups of streams of each generation are assigned to Readers using
+// leases. A Reader tries to hold an equal share of the groups, acquires
+// free groups and releases excess ones when other Readers join. If a Reader
+// crashes, its leases expire and are acquired by the remaining Readers,
+// which resume reading the groups from the progress saved by
+// the ProgressManager. Therefore, all Readers should use a ProgressManager
+// which shares progress between processes, e.g. TableBackedProgressManager
+// with the same application name.
+//
+// A Reader switches to the next generation only after all groups of
+// the current generation were read, possibly by other Readers.
+type StreamCoordinationConfig struct {
+	// Keeps the leases. All Readers which share the work must use
+	// the same store.
+	LeaseStore StreamLeaseStore
+
+	// Uniquely identifies the Reader among the Readers which share the work.
+	// If not set, a random ID will be used.
+	OwnerID string
+
+	// How long a lease is valid if it is not renewed.
+	//
+	// If the parameter is left as 0, leases will be valid for 30 seconds.
+	LeaseTTL time.Duration
+
+	// How often the Reader renews its leases and rebalances groups.
+	//
+	// If the parameter is left as 0, a third of LeaseTTL will be used.
+	RenewInterval time.Duration
+}
+
+func (scc *StreamCoordinationConfig) setDefaults() {
+	if scc.OwnerID == "" {
+		scc.OwnerID = gocql.TimeUUID().String()
+	}
+	if scc.LeaseTTL == 0 {
+		scc.LeaseTTL = 30 * time.Second
+	}
+	if scc.RenewInterval == 0 {
+		scc.RenewInterval = scc.LeaseTTL / 3
+	}
+}
+
 func (rc *ReaderConfig) validate() error {
 	if len(rc.TableNames) == 0 {
 		return errors.New("no table names specified to read from")
 	}
+	for _, name := range rc.TableNames {
+		if _, _, err := splitTableName(name); err != nil {
+			return err
+		}
+	}
+	for name, columns := range rc.ColumnProjections {
+		if _, _, err := splitTableName(name); err != nil {
+			return err
+		}
+		for _, col := range columns {
+			if strings.HasPrefix(col, "cdc$") {
+				return fmt.Errorf("column projection of table %s contains a cdc$ column: %s", name, col)
+			}
+		}
+	}
+	if err := rc.RowFilter.validate(); err != nil {
+		return err
+	}
 	if rc.ChangeConsumerFactory == nil {
 		return errors.New("no change consumer factory specified")
 	}
+	if rc.Session == nil && rc.DataSource == nil {
+		return errors.New("neither session nor data source specified")
+	}
+	if rc.ShardCount < 0 {
+		return errors.New("shard count must not be negative")
+	}
+	if rc.ShardCount > 0 && (rc.ShardIndex < 0 || rc.ShardIndex >= rc.ShardCount) {
+		return fmt.Errorf("shard index %d is out of range [0, %d)", rc.ShardIndex, rc.ShardCount)
+	}
+	if rc.Coordination != nil {
+		if rc.Coordination.LeaseStore == nil {
+			return errors.New("no lease store specified for coordination")
+		}
+		if rc.Coordination.RenewInterval >= rc.Coordination.LeaseTTL {
+			return errors.New("lease renew interval must be shorter than lease TTL")
+		}
+	}
 
 	return nil
 }
@@ -64,6 +216,17 @@ func (rc *ReaderConfig) setDefaults() {
 	if rc.Logger == nil {
 		rc.Logger = noLogger{}
 	}
+	if rc.Metrics == nil {
+		rc.Metrics = noReaderMetrics{}
+	}
+	if rc.GenerationObserver == nil {
+		rc.GenerationObserver = noGenerationObserver{}
+	}
+	if rc.Coordination != nil {
+		coordination := *rc.Coordination
+		coordination.setDefaults()
+		rc.Coordination = &coordination
+	}
 	rc.Advanced.setDefaults()
 }
 
@@ -90,7 +253,10 @@ type AdvancedReaderConfig struct {
 	// issued after a delay. This parameter specifies the length of the delay.
 	//
 	// If the parameter is left as 0, the library will automatically adjust
-	// the length of the delay.
+	// the length of the delay, separately for each set of CDC streams.
+	// The delay is shortened when selects return many changes or the reader
+	// lags behind the confidence window, and is restored to 10 seconds
+	// when the load decreases.
 	PostNonEmptyQueryDelay time.Duration
 
 	// The library uses select statements to fetch changes from CDC Log tables.
@@ -100,15 +266,16 @@ type AdvancedReaderConfig struct {
 	// a delay. This parameter specifies the length of the delay.
 	//
 	// If the parameter is left as 0, the library will automatically adjust
-	// the length of the delay.
+	// the length of the delay, separately for each set of CDC streams.
+	// The delay is gradually increased, up to 30 seconds, while selects
+	// keep returning no changes.
 	PostEmptyQueryDelay time.Duration
 
 	// If the library tries to read from the CDC log and the read operation
 	// fails, it will wait some time before attempting to read again. This
 	// parameter specifies the length of the delay.
 	//
-	// If the parameter is left as 0, the library will automatically adjust
-	// the length of the delay.
+	// If the parameter is left as 0, a delay of 1 second will be used.
 	PostFailedQueryDelay time.Duration
 
 	// Changes are queried using select statements with restriction on the time
@@ -117,7 +284,10 @@ type AdvancedReaderConfig struct {
 	// window used for the restriction.
 	//
 	// If the parameter is left as 0, the library will automatically adjust
-	// the size of the restriction window.
+	// the size of the restriction window, separately for each set of CDC
+	// streams. The window starts at 30 seconds and is widened, up to
+	// 10 minutes, when selects return many changes or the reader lags
+	// behind the confidence window.
 	QueryTimeWindowSize time.Duration
 
 	// When the library starts for the first time it has to start consuming
@@ -133,8 +303,81 @@ type AdvancedReaderConfig struct {
 	// If the parameter is left as 0, the library will automatically adjust
 	// the size of the restriction window.
 	ChangeAgeLimit time.Duration
+
+	// MaxInFlightChanges limits the number of changes of a single stream
+	// which were handed over to an AsyncChangeConsumer, but were not
+	// acknowledged yet.
+	//
+	// If the parameter is left as 0, the limit of 100 changes will be used.
+	MaxInFlightChanges int
+
+	// AsyncProgressSaveInterval specifies how often the library saves
+	// progress of streams consumed by AsyncChangeConsumers.
+	//
+	// If the parameter is left as 0, progress will be saved every 10 seconds.
+	AsyncProgressSaveInterval time.Duration
+
+	// NewTableStartPolicy determines from which point the library starts
+	// reading a table which is added to an application that has already
+	// been reading other tables. It only applies to streams of the table
+	// for which no progress was saved, and it doesn't apply to tables which
+	// already have progress saved for some of their streams.
+	//
+	// If the application has no start time of any table saved, e.g.
+	// because its progress was saved by an older version of the library,
+	// the tables from ReaderConfig.TableNames are read from the point
+	// the application started reading.
+	//
+	// The policy is used only if the ProgressManager implements
+	// the ProgressManagerWithTableStartTime interface. The chosen start time
+	// is saved, so that it is not recalculated after a restart.
+	//
+	// If the parameter is left as 0, new tables are read from the point
+	// the application started reading.
+	NewTableStartPolicy NewTableStartPolicy
+
+	// MaxStreamsPerGroup limits the number of streams in a group created
+	// by grouping the streams by replicas (see ReaderConfig.ReplicaLocator).
+	// The streams of a group are queried together, so the limit should not
+	// exceed the limit of partition keys in a single query of the cluster.
+	// Streams of the same vnode are never put into separate groups, so
+	// a group with streams of a single vnode may exceed the limit.
+	//
+	// If the parameter is left as 0, the limit of 100 streams will be used.
+	MaxStreamsPerGroup int
+
+	// GenerationFetchPeriod is the longest period between two consecutive
+	// checks for new generations. After a new generation is found or
+	// a refresh is triggered with (*Reader).TriggerRefresh, the library
+	// checks for new generations every second, and then gradually backs
+	// off to this period.
+	//
+	// If the parameter is left as 0, the period of 15 seconds will be used.
+	GenerationFetchPeriod time.Duration
 }
 
+// NewTableStartPolicy determines from which point a new table is read.
+type NewTableStartPolicy int
+
+const (
+	// NewTableStartFromApplicationStart starts reading from the point
+	// the application started reading.
+	NewTableStartFromApplicationStart NewTableStartPolicy = iota
+
+	// NewTableStartFromNow starts reading from the moment the table
+	// was added.
+	NewTableStartFromNow
+
+	// NewTableStartFromChangeAgeLimit starts reading from the moment
+	// the table was added, minus AdvancedReaderConfig.ChangeAgeLimit.
+	NewTableStartFromChangeAgeLimit
+
+	// NewTableStartFromEarliest starts reading from the earliest available
+	// data in the generation which is being read, limited by the TTL
+	// of the CDC log.
+	NewTableStartFromEarliest
+)
+
 func (arc *AdvancedReaderConfig) setDefaults() {
 	setIfZero := func(p *time.Duration, v time.Duration) {
 		if *p == 0 {
@@ -143,12 +386,20 @@ func (arc *AdvancedReaderConfig) setDefaults() {
 	}
 	setIfZero(&arc.ConfidenceWindowSize, 30*time.Second)
 
-	setIfZero(&arc.PostNonEmptyQueryDelay, 10*time.Second)
-	setIfZero(&arc.PostEmptyQueryDelay, 30*time.Second)
+	// PostNonEmptyQueryDelay, PostEmptyQueryDelay and QueryTimeWindowSize
+	// are left as zero, which means that they are adjusted by pollController
 	setIfZero(&arc.PostFailedQueryDelay, 1*time.Second)
 
-	setIfZero(&arc.QueryTimeWindowSize, 30*time.Second)
 	setIfZero(&arc.ChangeAgeLimit, 1*time.Minute)
+
+	if arc.MaxInFlightChanges == 0 {
+		arc.MaxInFlightChanges = 100
+	}
+	if arc.MaxStreamsPerGroup == 0 {
+		arc.MaxStreamsPerGroup = 100
+	}
+	setIfZero(&arc.AsyncProgressSaveInterval, 10*time.Second)
+	setIfZero(&arc.GenerationFetchPeriod, 15*time.Second)
 }
 
 // Copy makes a shallow copy of the ReaderConfig.
@@ -166,9 +417,61 @@ const (
 type Reader struct {
 	config     *ReaderConfig
 	genFetcher *generationFetcher
-	readFrom   time.Time
 	stoppedCh  chan struct{}
 	stopTime   atomic.Value
+	observer   *syncGenerationObserver
+
+	// The point from which the application started reading, used for
+	// tables added with the NewTableStartFromApplicationStart policy
+	applicationReadFrom time.Time
+
+	// Protects fields below
+	mu         sync.Mutex
+	readFrom   time.Time
+	tableNames []string
+	currentGen *runningGeneration
+
+	// Tables with their own generations, which are not listed in tableNames
+	tableLoops map[string]*tableGenerationLoop
+
+	// Set when Run starts, used to start loops of tables added by AddTable
+	runErrG *errgroup.Group
+	runCtx  context.Context
+
+	// Start times of tables, if the ProgressManager keeps them
+	tableStartTimes map[string]time.Time
+}
+
+// Stream batch readers of the generation which is currently being read.
+type runningGeneration struct {
+	gen   *generation
+	split [][]StreamID
+	errG  *errgroup.Group
+	ctx   context.Context
+
+	// The point from which readers of the generation start reading
+	// if no progress was saved for their streams
+	readFrom time.Time
+
+	// Stream batch readers, indexed by the fully qualified table name
+	readers map[string][]*streamBatchReader
+
+	// Set when the readers of the generation are about to be closed,
+	// after that no new readers can be started, unless finished is set
+	closing bool
+
+	// Set along with closing if the next generation is known. Readers
+	// which are started after that are closed right away at closeAt.
+	finished bool
+	closeAt  gocql.UUID
+
+	// Points up to which the tables were read, set when the generation
+	// started closing
+	tableCloseTimes map[string]time.Time
+
+	// Set if the generation belongs to a single table with its own
+	// generations
+	tableGeneration bool
 }
 
 // NewReader creates a new CDC reader using the specified configuration.
@@ -180,33 +483,86 @@ func NewReader(ctx context.Context, config *ReaderConfig) (*Reader, error) {
 		return nil, err
 	}
 
-	readFrom, err := determineStartTimestamp(ctx, config)
+	if config.DataSource == nil {
+		dataSource, err := NewGocqlDataSource(config.Session, config.Logger)
+		if err != nil {
+			return nil, err
+		}
+		config.DataSource = dataSource
+	}
+
+	readFrom, isNewApplication, err := determineStartTimestamp(ctx, config)
 	if err != nil {
 		return nil, err
 	}
 
-	genFetcher, err := newGenerationFetcher(
-		config.Session,
+	genFetcher := newGenerationFetcher(
+		config.DataSource,
 		readFrom,
+		config.Advanced.GenerationFetchPeriod,
 		config.Logger,
 	)
-	if err != nil {
-		return nil, err
-	}
 
 	reader := &Reader{
 		config:     config,
 		genFetcher: genFetcher,
-		readFrom:   readFrom,
 		stoppedCh:  make(chan struct{}),
+		observer:   &syncGenerationObserver{observer: config.GenerationObserver},
+
+		applicationReadFrom: readFrom,
+
+		readFrom:        readFrom,
+		tableLoops:      make(map[string]*tableGenerationLoop),
+		tableStartTimes: make(map[string]time.Time),
+	}
+
+	// If an existing application has no start times of tables saved,
+	// its progress was saved by a version of the library which didn't keep
+	// them, and the tables were read from the start of the application
+	usePolicy := false
+	if !isNewApplication {
+		usePolicy, err = hasSavedTableStartTimes(ctx, config)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, tableName := range config.TableNames {
+		hasTableGens, err := reader.hasTableGenerations(ctx, tableName)
+		if err != nil {
+			return nil, err
+		}
+		if hasTableGens && config.Coordination != nil {
+			return nil, fmt.Errorf("table %s has its own generations, which is not supported with coordination", tableName)
+		}
+
+		startTime, err := determineTableStartTimestamp(ctx, config, tableName, readFrom, usePolicy)
+		if err != nil {
+			return nil, err
+		}
+		if !startTime.IsZero() {
+			reader.tableStartTimes[tableName] = startTime
+		}
+
+		if !hasTableGens {
+			reader.tableNames = append(reader.tableNames, tableName)
+			continue
+		}
+		tl, err := reader.newTableGenerationLoop(ctx, tableName)
+		if err != nil {
+			return nil, err
+		}
+		reader.tableLoops[tableName] = tl
 	}
 	return reader, nil
 }
 
-func determineStartTimestamp(ctx context.Context, config *ReaderConfig) (time.Time, error) {
+// Returns the point from which the application should start reading,
+// and whether the application reads for the first time.
+func determineStartTimestamp(ctx context.Context, config *ReaderConfig) (time.Time, bool, error) {
 	mostRecentGeneration, err := config.ProgressManager.GetCurrentGeneration(ctx)
 	if err != nil {
-		return time.Time{}, err
+		return time.Time{}, false, err
 	}
 	if mostRecentGeneration.IsZero() {
 		config.Logger.Printf("no information about the last generation was found")
@@ -218,7 +574,7 @@ func determineStartTimestamp(ctx context.Context, config *ReaderConfig) (time.Ti
 	if withStartTime, ok := config.ProgressManager.(ProgressManagerWithStartTime); ok {
 		applicationStartTime, err = withStartTime.GetApplicationReadStartTime(ctx)
 		if err != nil {
-			return time.Time{}, err
+			return time.Time{}, false, err
 		}
 		if applicationStartTime.IsZero() {
 			config.Logger.Printf("no information about the application start time was found")
@@ -234,20 +590,118 @@ func determineStartTimestamp(ctx context.Context, config *ReaderConfig) (time.Ti
 	}
 
 	// If the timestamp is still zero, calculate the start time based on ChangeAgeLimit
-	if readFrom.IsZero() {
+	isNewApplication := readFrom.IsZero()
+	if isNewApplication {
 		config.Logger.Printf("neither last generation nor application start time is available, will use ChangeAgeLimit")
 		readFrom = time.Now().Add(-config.Advanced.ChangeAgeLimit)
 
 		// Need to save this timestamp, if the ProgressManager supports that
 		if withStartTime, ok := config.ProgressManager.(ProgressManagerWithStartTime); ok {
 			if err := withStartTime.SaveApplicationReadStartTime(ctx, readFrom); err != nil {
-				return time.Time{}, err
+				return time.Time{}, false, err
 			}
 		}
 	}
 
 	config.Logger.Printf("the application will start reading from %v or later (depending on per-stream saved progress)", readFrom)
-	return readFrom, nil
+	return readFrom, isNewApplication, nil
+}
+
+// Returns true if the ProgressManager keeps start times of tables and saved
+// the start time of at least one table.
+func hasSavedTableStartTimes(ctx context.Context, config *ReaderConfig) (bool, error) {
+	withTableStartTime, ok := config.ProgressManager.(ProgressManagerWithTableStartTime)
+	if !ok {
+		return false, nil
+	}
+	startTimes, err := withTableStartTime.ListTableReadStartTimes(ctx)
+	if err != nil {
+		return false, err
+	}
+	if len(startTimes) == 0 {
+		config.Logger.Printf("no start times of tables were saved, the tables will be read from the application start time")
+	}
+	return len(startTimes) > 0, nil
+}
+
+// Returns true if the ProgressManager has progress saved for any stream
+// of the table. Returns false if the progress can't be enumerated.
+func hasSavedTableProgress(ctx context.Context, config *ReaderConfig, tableName string) (bool, error) {
+	withEnumeration, ok := config.ProgressManager.(ProgressManagerWithEnumeration)
+	if !ok {
+		return false, nil
+	}
+	entries, err := withEnumeration.ListProgress(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, entry := range entries {
+		if entry.TableName == tableName {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Returns the point from which streams of the table without saved progress
+// should be read, or zero if the ProgressManager doesn't keep start times
+// of tables. If the start time was not saved before, it is chosen and saved.
+// NewTableStartPolicy is used only if usePolicy is true and the table has
+// no saved progress, otherwise the table is read from the application
+// start time.
+func determineTableStartTimestamp(
+	ctx context.Context,
+	config *ReaderConfig,
+	tableName string,
+	applicationReadFrom time.Time,
+	usePolicy bool,
+) (time.Time, error) {
+	withTableStartTime, ok := config.ProgressManager.(ProgressManagerWithTableStartTime)
+	if !ok {
+		return time.Time{}, nil
+	}
+
+	startTime, err := withTableStartTime.GetTableReadStartTime(ctx, tableName)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !startTime.IsZero() {
+		config.Logger.Printf("the table %s started being read from time point %v", tableName, startTime)
+		return startTime, nil
+	}
+
+	if usePolicy {
+		// A table with saved progress was read before, even though
+		// its start time was not saved
+		hasProgress, err := hasSavedTableProgress(ctx, config, tableName)
+		if err != nil {
+			return time.Time{}, err
+		}
+		usePolicy = !hasProgress
+	}
+
+	if !usePolicy {
+		startTime = applicationReadFrom
+	} else {
+		switch config.Advanced.NewTableStartPolicy {
+		case NewTableStartFromNow:
+			startTime = time.Now()
+		case NewTableStartFromChangeAgeLimit:
+			startTime = time.Now().Add(-config.Advanced.ChangeAgeLimit)
+		case NewTableStartFromEarliest:
+			// Readers don't start before the beginning of the generation
+			// and the TTL of the CDC log
+			startTime = time.Unix(0, 0)
+		default:
+			startTime = applicationReadFrom
+		}
+	}
+
+	if err := withTableStartTime.SaveTableReadStartTime(ctx, tableName, startTime); err != nil {
+		return time.Time{}, err
+	}
+	config.Logger.Printf("the table %s will be read from time point %v", tableName, startTime)
+	return startTime, nil
 }
 
 // Run runs the CDC reader. This call is blocking and returns after an error occurs, or the reader
@@ -257,6 +711,14 @@ func (r *Reader) Run(ctx context.Context) error {
 
 	runErrG, runCtx := errgroup.WithContext(ctx)
 
+	r.mu.Lock()
+	r.runErrG = runErrG
+	r.runCtx = runCtx
+	for _, tl := range r.tableLoops {
+		r.startTableGenerationLoop(tl)
+	}
+	r.mu.Unlock()
+
 	runErrG.Go(func() error {
 		select {
 		case <-runCtx.Done():
@@ -270,17 +732,28 @@ func (r *Reader) Run(ctx context.Context) error {
 		return r.genFetcher.Run(runCtx)
 	})
 	runErrG.Go(func() error {
+		observer := r.observer
+
 		gen, err := r.genFetcher.Get(runCtx)
 		if gen == nil {
 			return err
 		}
+		err = observer.GenerationDiscovered(runCtx, GenerationInfo{
+			StartTime:   gen.startTime,
+			StreamCount: len(gen.streams),
+		})
+		if err != nil {
+			return err
+		}
 
+		r.mu.Lock()
 		if r.readFrom.Before(gen.startTime) {
 			r.readFrom = gen.startTime
 		}
+		r.mu.Unlock()
 
 		for {
-			l.Printf("starting reading generation %v from timestamp %v", gen.startTime, r.readFrom)
+			l.Printf("starting reading generation %v from timestamp %v", gen.startTime, r.getReadFrom())
 
 			if err := r.config.ProgressManager.StartGeneration(ctx, gen.startTime); err != nil {
 				return err
@@ -291,45 +764,59 @@ func (r *Reader) Run(ctx context.Context) error {
 
 			l.Printf("grouped %d streams into %d batches", len(gen.streams), len(split))
 
+			if r.config.ShardCount > 0 {
+				split = r.filterShardStreamGroups(split)
+				l.Printf("%d batches are assigned to shard %d of %d", len(split), r.config.ShardIndex, r.config.ShardCount)
+			}
+
+			genInfo := GenerationInfo{
+				StartTime:   gen.startTime,
+				StreamCount: len(gen.streams),
+				GroupCount:  len(split),
+			}
+			if err := observer.GenerationStarted(runCtx, genInfo); err != nil {
+				return err
+			}
+
 			genErrG, genCtx := errgroup.WithContext(runCtx)
 
-			readers := make([]*streamBatchReader, 0, len(split)*len(r.config.TableNames))
-			for _, fullTableName := range r.config.TableNames {
-				// TODO: This is ugly?
-				splitName := strings.SplitN(fullTableName, ".", 2)
-				keyspaceName := splitName[0]
-				tableName := splitName[1]
-
-				// Fetch the current table's TTL
-				startTime := r.readFrom
-				ttl, err := fetchScyllaCDCExtensionTTL(r.config.Session, keyspaceName, tableName)
-				if err == nil {
-					if ttl != 0 {
-						l.Printf("the TTL for %s.%s is %d seconds", keyspaceName, tableName, ttl)
-						ttlBound := time.Now().Add(-time.Duration(ttl) * time.Second)
-						if startTime.Before(ttlBound) {
-							startTime = ttlBound
-						}
-					} else {
-						l.Printf("the table %s.%s has not TTL set", keyspaceName, tableName)
-					}
-				} else {
-					l.Printf("failed to fetch TTL for table %s.%s, assuming no TTL; error: %s", keyspaceName, tableName, err)
+			r.mu.Lock()
+			rg := &runningGeneration{
+				gen:      gen,
+				split:    split,
+				errG:     genErrG,
+				ctx:      genCtx,
+				readFrom: r.readFrom,
+				readers:  make(map[string][]*streamBatchReader),
+			}
+			r.currentGen = rg
+			var readers []*streamBatchReader
+			if r.config.Coordination == nil {
+				for _, fullTableName := range r.tableNames {
+					tableReaders := r.newReadersForTable(genCtx, rg, fullTableName, split)
+					rg.readers[fullTableName] = tableReaders
+					readers = append(readers, tableReaders...)
 				}
+			}
+			r.mu.Unlock()
 
-				for _, group := range split {
-					readers = append(readers, newStreamBatchReader(
-						r.config,
-						gen.startTime,
-						group,
-						keyspaceName,
-						tableName,
-						gocql.MinTimeUUID(startTime),
-					))
-				}
+			if r.config.Coordination != nil {
+				// Readers are started when leases are acquired
+				coordinator := newStreamCoordinator(r, rg)
+				genErrG.Go(func() error {
+					return coordinator.run(genCtx)
+				})
 			}
 
-			sleepAmount := r.config.Advanced.PostNonEmptyQueryDelay / time.Duration(len(readers))
+			// Spread the first queries of stream batch readers evenly
+			startupPeriod := r.config.Advanced.PostNonEmptyQueryDelay
+			if startupPeriod == 0 {
+				startupPeriod = initialAdaptiveQueryDelay
+			}
+			var sleepAmount time.Duration
+			if len(readers) > 0 {
+				sleepAmount = startupPeriod / time.Duration(len(readers))
+			}
 			for i := range readers {
 				reader := readers[i]
 				select {
@@ -344,33 +831,81 @@ func (r *Reader) Run(ctx context.Context) error {
 
 			var nextGen *generation
 			genErrG.Go(func() error {
+				// If the reader was stopped, tables added with AddTable
+				// after that are not read anymore
+				defer func() {
+					r.mu.Lock()
+					rg.closing = true
+					r.mu.Unlock()
+				}()
+
 				var err error
 				nextGen, err = r.genFetcher.Get(genCtx)
 				if err != nil {
 					return err
 				}
-				for _, reader := range readers {
-					if nextGen == nil {
-						// The reader was stopped
-						stopAt, _ := r.stopTime.Load().(time.Time)
-						if stopAt.IsZero() {
-							reader.stopNow()
-						} else {
-							reader.close(gocql.MaxTimeUUID(stopAt))
-							r.readFrom = stopAt
-						}
-					} else {
-						reader.close(gocql.MinTimeUUID(nextGen.startTime))
-						r.readFrom = nextGen.startTime
+				if nextGen != nil {
+					err = observer.GenerationDiscovered(genCtx, GenerationInfo{
+						StartTime:   nextGen.startTime,
+						StreamCount: len(nextGen.streams),
+					})
+					if err != nil {
+						return err
+					}
+				}
+
+				r.mu.Lock()
+				defer r.mu.Unlock()
+				rg.closing = true
+				var closeTime time.Time
+				if nextGen == nil {
+					// The reader was stopped
+					stopAt, _ := r.stopTime.Load().(time.Time)
+					if !stopAt.IsZero() {
+						rg.closeAt = gocql.MaxTimeUUID(stopAt)
+						r.readFrom = stopAt
+						closeTime = stopAt
+					}
+				} else {
+					rg.finished = true
+					rg.closeAt = gocql.MinTimeUUID(nextGen.startTime)
+					r.readFrom = nextGen.startTime
+					closeTime = nextGen.startTime
+				}
+				rg.tableCloseTimes = make(map[string]time.Time, len(r.tableNames))
+				for _, tableName := range r.tableNames {
+					rg.tableCloseTimes[tableName] = closeTime
+				}
+				for _, tableReaders := range rg.readers {
+					for _, reader := range tableReaders {
+						rg.closeReader(reader)
 					}
 				}
 				return nil
 			})
 
-			if err := genErrG.Wait(); err != nil {
+			err := genErrG.Wait()
+
+			r.mu.Lock()
+			r.currentGen = nil
+			r.mu.Unlock()
+
+			if err != nil {
 				return err
 			}
 			l.Printf("stopped reading from generation %v", gen.startTime)
+
+			drainInfo := GenerationDrainInfo{
+				GenerationInfo:  genInfo,
+				TableCloseTimes: rg.tableCloseTimes,
+			}
+			if nextGen != nil {
+				drainInfo.NextStartTime = nextGen.startTime
+			}
+			if err := observer.GenerationDrained(runCtx, drainInfo); err != nil {
+				return err
+			}
+
 			if nextGen == nil {
 				break
 			}
@@ -383,6 +918,248 @@ func (r *Reader) Run(ctx context.Context) error {
 	return runErrG.Wait()
 }
 
+// AddTable starts reading changes from the CDC log of given table. If the
+// reader is running, changes are read starting from the current generation,
+// otherwise the table will be read after the reader is started.
+// The table name must be prefixed with keyspace name.
+func (r *Reader) AddTable(ctx context.Context, tableName string) error {
+	if _, _, err := splitTableName(tableName); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	isRead := r.isTableRead(tableName)
+	r.mu.Unlock()
+	if isRead {
+		return fmt.Errorf("table %s is already being read", tableName)
+	}
+
+	hasTableGens, err := r.hasTableGenerations(ctx, tableName)
+	if err != nil {
+		return err
+	}
+	if hasTableGens && r.config.Coordination != nil {
+		return fmt.Errorf("table %s has its own generations, which is not supported with coordination", tableName)
+	}
+
+	startTime, err := determineTableStartTimestamp(ctx, r.config, tableName, r.applicationReadFrom, true)
+	if err != nil {
+		return err
+	}
+
+	var tl *tableGenerationLoop
+	if hasTableGens {
+		tl, err = r.newTableGenerationLoop(ctx, tableName)
+		if err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.isTableRead(tableName) {
+		return fmt.Errorf("table %s is already being read", tableName)
+	}
+	if !startTime.IsZero() {
+		r.tableStartTimes[tableName] = startTime
+	}
+
+	if tl != nil {
+		r.tableLoops[tableName] = tl
+		if r.runErrG != nil && r.runCtx.Err() == nil && !isClosed(r.stoppedCh) {
+			r.config.Logger.Printf("starting reading table %s with its own generations", tableName)
+			r.startTableGenerationLoop(tl)
+		}
+		return nil
+	}
+
+	r.tableNames = append(r.tableNames, tableName)
+
+	rg := r.currentGen
+	if rg == nil || (rg.closing && !rg.finished) || r.config.Coordination != nil {
+		// If the work is coordinated, readers of the table will be
+		// started after leases are acquired
+		return nil
+	}
+
+	r.config.Logger.Printf("starting reading table %s in generation %v", tableName, rg.gen.startTime)
+	tableReaders := r.newReadersForTable(ctx, rg, tableName, rg.split)
+	rg.readers[tableName] = tableReaders
+	if rg.closing {
+		// The next generation is already known, so the table is read
+		// only up to its start
+		for _, reader := range tableReaders {
+			rg.closeReader(reader)
+		}
+		rg.tableCloseTimes[tableName] = rg.closeAt.Time()
+	}
+	for i := range tableReaders {
+		reader := tableReaders[i]
+		rg.errG.Go(func() error {
+			return reader.run(rg.ctx)
+		})
+	}
+	return nil
+}
+
+// RemoveTable stops reading changes from the CDC log of given table.
+// If the reader is running, readers of the table are stopped, and their
+// consumers are ended. RemoveTable waits until all consumers of the table
+// are ended, or the context is cancelled.
+func (r *Reader) RemoveTable(ctx context.Context, tableName string) error {
+	r.mu.Lock()
+
+	if tl, ok := r.tableLoops[tableName]; ok {
+		delete(r.tableLoops, tableName)
+		close(tl.removedCh)
+		started := tl.started
+		r.mu.Unlock()
+
+		if !started {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tl.doneCh:
+		}
+		return nil
+	}
+
+	found := false
+	for i, name := range r.tableNames {
+		if name == tableName {
+			r.tableNames = append(r.tableNames[:i:i], r.tableNames[i+1:]...)
+			found = true
+			break
+		}
+	}
+	if !found {
+		r.mu.Unlock()
+		return fmt.Errorf("table %s is not being read", tableName)
+	}
+
+	var tableReaders []*streamBatchReader
+	if rg := r.currentGen; rg != nil {
+		tableReaders = rg.readers[tableName]
+		delete(rg.readers, tableName)
+		for _, reader := range tableReaders {
+			reader.stopNow()
+		}
+		// The table isn't read up to the point where the generation is
+		// closed anymore
+		delete(rg.tableCloseTimes, tableName)
+	}
+	r.mu.Unlock()
+
+	for _, reader := range tableReaders {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-reader.doneCh:
+		}
+	}
+	return nil
+}
+
+// Closes the reader at the point determined when the generation
+// started closing. Must be called with the mutex of the Reader held.
+func (rg *runningGeneration) closeReader(reader *streamBatchReader) {
+	if rg.closeAt == (gocql.UUID{}) {
+		reader.stopNow()
+	} else {
+		reader.close(rg.closeAt)
+	}
+}
+
+// Must be called with the mutex held.
+func (r *Reader) newReadersForTable(ctx context.Context, rg *runningGeneration, fullTableName string, groups [][]StreamID) []*streamBatchReader {
+	l := r.config.Logger
+
+	// The name was validated before
+	keyspaceName, tableName, _ := splitTableName(fullTableName)
+
+	// Streams without saved progress start from the start time
+	// of the table, if it is known
+	startTime := rg.readFrom
+	var tableStartTime time.Time
+	if saved, ok := r.tableStartTimes[fullTableName]; ok {
+		tableStartTime = rg.gen.startTime
+		if tableStartTime.Before(saved) {
+			tableStartTime = saved
+		}
+	}
+
+	// Fetch the current table's TTL
+	opts, err := r.config.DataSource.GetTableCDCOptions(ctx, keyspaceName, tableName)
+	if err == nil {
+		if ttl := opts.TTL; ttl != 0 {
+			l.Printf("the TTL for %s.%s is %d seconds", keyspaceName, tableName, int64(ttl/time.Second))
+			ttlBound := time.Now().Add(-ttl)
+			if startTime.Before(ttlBound) {
+				startTime = ttlBound
+			}
+			if !tableStartTime.IsZero() && tableStartTime.Before(ttlBound) {
+				tableStartTime = ttlBound
+			}
+		} else {
+			l.Printf("the table %s.%s has not TTL set", keyspaceName, tableName)
+		}
+	} else {
+		l.Printf("failed to fetch TTL for table %s.%s, assuming no TTL; error: %s", keyspaceName, tableName, err)
+	}
+
+	var tableStartFrom gocql.UUID
+	if !tableStartTime.IsZero() {
+		tableStartFrom = gocql.MinTimeUUID(tableStartTime)
+	}
+
+	readers := make([]*streamBatchReader, 0, len(groups))
+	for _, group := range groups {
+		reader := newStreamBatchReader(
+			r.config,
+			rg.gen.startTime,
+			group,
+			keyspaceName,
+			tableName,
+			gocql.MinTimeUUID(startTime),
+			tableStartFrom,
+		)
+		reader.disableRouting = rg.tableGeneration
+		readers = append(readers, reader)
+	}
+	return readers
+}
+
+// Must be called with the mutex held.
+func (r *Reader) isTableRead(tableName string) bool {
+	if _, ok := r.tableLoops[tableName]; ok {
+		return true
+	}
+	for _, name := range r.tableNames {
+		if name == tableName {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Reader) getReadFrom() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.readFrom
+}
+
+// Splits a fully qualified table name into keyspace and table names.
+func splitTableName(fullTableName string) (string, string, error) {
+	splitName := strings.SplitN(fullTableName, ".", 2)
+	if len(splitName) < 2 {
+		return "", "", fmt.Errorf("table name is not fully qualified: %s", fullTableName)
+	}
+	return splitName[0], splitName[1], nil
+}
+
 // Stop tells the reader to stop as soon as possible. There is no guarantee
 // related to how much data will be processed in each stream when the reader
 // stops. If you want to e.g. make sure that all cdc log data with timestamps
@@ -402,7 +1179,35 @@ func (r *Reader) StopAt(at time.Time) {
 	close(r.stoppedCh)
 }
 
+// TriggerRefresh tells the reader to check for new generations immediately,
+// and then more often for some time. It is meant to be called when
+// the topology of the cluster changes, e.g. from a callback registered
+// in ClusterEventPolicy.
+// This function does not wait until the check is performed.
+func (r *Reader) TriggerRefresh() {
+	r.genFetcher.TriggerRefresh()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, tl := range r.tableLoops {
+		tl.genFetcher.TriggerRefresh()
+	}
+}
+
 func (r *Reader) splitStreams(streams []StreamID) [][]StreamID {
+	// Readers which share the streams must group them in the same way
+	isShared := r.config.ShardCount > 0 || r.config.Coordination != nil
+	if r.config.ReplicaLocator != nil && !isShared {
+		groups, err := r.splitStreamsByReplicas(streams)
+		if err == nil {
+			return groups
+		}
+		r.config.Logger.Printf("failed to group streams by replicas, grouping them by vnodes: %s", err)
+	}
+	return r.splitStreamsByVnodes(streams)
+}
+
+func (r *Reader) splitStreamsByVnodes(streams []StreamID) [][]StreamID {
 	vnodesIdxToStreams := make(map[int64][]StreamID, 0)
 	for _, stream := range streams {
 		idx := getVnodeIndexForStream(stream)
@@ -424,21 +1229,109 @@ func (r *Reader) splitStreams(streams []StreamID) [][]StreamID {
 	return groups
 }
 
+// Groups the streams by their replicas in all keyspaces of the tables
+// which are currently read.
+func (r *Reader) splitStreamsByReplicas(streams []StreamID) ([][]StreamID, error) {
+	r.mu.Lock()
+	keyspaces := make(map[string]struct{})
+	for _, name := range r.tableNames {
+		keyspaceName, _, _ := splitTableName(name)
+		keyspaces[keyspaceName] = struct{}{}
+	}
+	r.mu.Unlock()
+
+	sortedKeyspaces := make([]string, 0, len(keyspaces))
+	for keyspace := range keyspaces {
+		sortedKeyspaces = append(sortedKeyspaces, keyspace)
+	}
+	sort.Strings(sortedKeyspaces)
+
+	keyToStreams := make(map[string][]StreamID)
+	groups := make([][]StreamID, 0)
+	for _, stream := range streams {
+		token, ok := getTokenForStream(stream)
+		if !ok {
+			// Don't know the token of the stream, put it into a separate group
+			groups = append(groups, []StreamID{stream})
+			continue
+		}
+
+		var key strings.Builder
+		for _, keyspace := range sortedKeyspaces {
+			replicas, err := r.config.ReplicaLocator.GetReplicas(keyspace, token)
+			if err != nil {
+				return nil, err
+			}
+			replicas = append([]string{}, replicas...)
+			sort.Strings(replicas)
+			key.WriteString(strings.Join(replicas, ","))
+			key.WriteByte(';')
+		}
+		keyToStreams[key.String()] = append(keyToStreams[key.String()], stream)
+	}
+
+	for _, group := range keyToStreams {
+		groups = append(groups, r.splitReplicaGroup(group)...)
+	}
+	return groups, nil
+}
+
+// Splits the streams owned by the same replicas into groups of at most
+// MaxStreamsPerGroup streams, made of whole vnodes.
+func (r *Reader) splitReplicaGroup(streams []StreamID) [][]StreamID {
+	vnodeGroups := r.splitStreamsByVnodes(streams)
+	sort.Slice(vnodeGroups, func(i, j int) bool {
+		return getVnodeIndexForStream(vnodeGroups[i][0]) < getVnodeIndexForStream(vnodeGroups[j][0])
+	})
+
+	groups := make([][]StreamID, 0)
+	var current []StreamID
+	for _, vnodeGroup := range vnodeGroups {
+		if len(current) > 0 && len(current)+len(vnodeGroup) > r.config.Advanced.MaxStreamsPerGroup {
+			groups = append(groups, current)
+			current = nil
+		}
+		current = append(current, vnodeGroup...)
+	}
+	if len(current) > 0 {
+		groups = append(groups, current)
+	}
+	return groups
+}
+
+// Returns the groups which are assigned to the shard of the Reader.
+func (r *Reader) filterShardStreamGroups(groups [][]StreamID) [][]StreamID {
+	filtered := make([][]StreamID, 0, len(groups)/r.config.ShardCount+1)
+	for _, group := range groups {
+		if getShardForStreamGroup(group, r.config.ShardCount) == r.config.ShardIndex {
+			filtered = append(filtered, group)
+		}
+	}
+	return filtered
+}
+
+// Assigns a group created by splitStreams to one of shardCount shards.
+// Groups of streams of the same vnode are assigned to the same shard
+// in all generations.
+func getShardForStreamGroup(group []StreamID, shardCount int) int {
+	h := fnv.New32a()
+	if idx := getVnodeIndexForStream(group[0]); idx != -1 {
+		var buf [8]byte
+		binary.BigEndian.PutUint64(buf[:], uint64(idx))
+		h.Write(buf[:])
+	} else {
+		// Streams of unknown format are put into separate groups
+		h.Write(group[0])
+	}
+	return int(h.Sum32() % uint32(shardCount))
+}
+
 // Computes vnode index from given stream ID.
 // Returns -1 if the stream ID format is unrecognized.
 func getVnodeIndexForStream(streamID StreamID) int64 {
-	if len(streamID) != 16 {
-		// Don't know how to handle other sizes
-		return -1
-	}
-
-	lowerQword := binary.BigEndian.Uint64(streamID[8:16])
-	version := lowerQword & (1<<4 - 1)
-	if version != 1 {
-		// Unrecognized version
+	info, err := DecodeStreamID(streamID)
+	if err != nil {
 		return -1
 	}
-
-	vnodeIdx := (lowerQword >> 4) & (1<<22 - 1)
-	return int64(vnodeIdx)
+	return info.VnodeIndex
 }
@@ -0,0 +1,544 @@
+package scyllacdc
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+func TestReaderAddAndRemoveTable(t *testing.T) {
+	now := time.Now()
+	streamA := StreamID{0x0A}
+	streamB := StreamID{0x0B}
+
+	ds := NewInMemoryDataSource()
+	ds.AddGeneration(now.Add(-time.Hour), []StreamID{streamA, streamB})
+	newTestInMemoryTable(t, ds, "tbl")
+	newTestInMemoryTable(t, ds, "tbl2")
+
+	// Changes of the first table go to stream A, and of the second to stream B
+	addTestUpdate(t, ds, "tbl", streamA, now.Add(-60*time.Second), 1, 1)
+	addTestUpdate(t, ds, "tbl2", streamB, now.Add(-60*time.Second), 2, 1)
+
+	consumer := newCollectingConsumer()
+	cfg := &ReaderConfig{
+		DataSource:            ds,
+		ChangeConsumerFactory: consumer,
+		TableNames:            []string{"ks.tbl"},
+		Advanced:              testAdvancedConfig,
+	}
+
+	reader, err := NewReader(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := reader.AddTable(context.Background(), "tbl2"); err == nil {
+		t.Error("expected an error when adding a table without keyspace name")
+	}
+	if err := reader.AddTable(context.Background(), "ks.tbl"); err == nil {
+		t.Error("expected an error when adding a table which is already read")
+	}
+	if err := reader.RemoveTable(context.Background(), "ks.other"); err == nil {
+		t.Error("expected an error when removing a table which is not read")
+	}
+
+	errC := make(chan error)
+	go func() { errC <- reader.Run(context.Background()) }()
+
+	waitFor(t, 5*time.Second, func() bool {
+		return len(consumer.GetChanges(streamA)) == 1
+	})
+	if changes := consumer.GetChanges(streamB); len(changes) != 0 {
+		t.Fatalf("expected no changes from a table which was not added, got %d", len(changes))
+	}
+
+	if err := reader.AddTable(context.Background(), "ks.tbl2"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, 5*time.Second, func() bool {
+		return len(consumer.GetChanges(streamB)) == 1
+	})
+
+	// Consumers of both streams of the removed table should be ended
+	if err := reader.RemoveTable(context.Background(), "ks.tbl"); err != nil {
+		t.Fatal(err)
+	}
+	if ended := consumer.GetEndedCount(); ended != 2 {
+		t.Errorf("expected 2 consumers to be ended after removing a table, got %d", ended)
+	}
+
+	addTestUpdate(t, ds, "tbl", streamA, time.Now(), 1, 2)
+	addTestUpdate(t, ds, "tbl2", streamB, time.Now(), 2, 2)
+	waitFor(t, 5*time.Second, func() bool {
+		return len(consumer.GetChanges(streamB)) == 2
+	})
+
+	reader.StopAt(time.Now())
+	if err := <-errC; err != nil {
+		t.Fatal(err)
+	}
+
+	if changes := consumer.GetChanges(streamA); len(changes) != 1 {
+		t.Errorf("expected no changes to be read from a removed table, got %d", len(changes)-1)
+	}
+	if ended := consumer.GetEndedCount(); ended != 4 {
+		t.Errorf("expected 4 consumers to be ended, got %d", ended)
+	}
+}
+
+func TestReaderRemovesTableWhileClosing(t *testing.T) {
+	now := time.Now()
+	streamA := StreamID{0x0A}
+
+	ds := NewInMemoryDataSource()
+	ds.AddGeneration(now.Add(-time.Hour), []StreamID{streamA})
+	newTestInMemoryTable(t, ds, "tbl")
+	newTestInMemoryTable(t, ds, "tbl2")
+
+	observer := &recordingGenerationObserver{}
+	cfg := &ReaderConfig{
+		DataSource:            ds,
+		ChangeConsumerFactory: newCollectingConsumer(),
+		TableNames:            []string{"ks.tbl", "ks.tbl2"},
+		GenerationObserver:    observer,
+		Advanced:              testAdvancedConfig,
+	}
+	reader, err := NewReader(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errC := make(chan error, 1)
+	go func() { errC <- reader.Run(context.Background()) }()
+
+	waitFor(t, 5*time.Second, func() bool {
+		reader.mu.Lock()
+		defer reader.mu.Unlock()
+		return reader.currentGen != nil
+	})
+
+	// The generation starts closing, but its readers keep reading
+	// until the stop time
+	reader.StopAt(now.Add(time.Hour))
+	waitFor(t, 5*time.Second, func() bool {
+		reader.mu.Lock()
+		defer reader.mu.Unlock()
+		return reader.currentGen != nil && reader.currentGen.closing
+	})
+
+	// Readers of removed tables are stopped right away
+	for _, tableName := range []string{"ks.tbl", "ks.tbl2"} {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := reader.RemoveTable(ctx, tableName)
+		cancel()
+		if err != nil {
+			t.Fatalf("failed to remove table %s: %v", tableName, err)
+		}
+	}
+	if err := <-errC; err != nil {
+		t.Fatal(err)
+	}
+
+	if len(observer.drains) != 1 || len(observer.drains[0].TableCloseTimes) != 0 {
+		t.Errorf("expected no close times of removed tables, got %v", observer.drains)
+	}
+}
+
+// Blocks consumption of changes of given table until unblocked.
+type blockingConsumer struct {
+	*collectingConsumer
+	tableName string
+	unblockCh chan struct{}
+}
+
+func (bc *blockingConsumer) CreateChangeConsumer(ctx context.Context, input CreateChangeConsumerInput) (ChangeConsumer, error) {
+	if input.TableName != bc.tableName {
+		return bc.collectingConsumer.CreateChangeConsumer(ctx, input)
+	}
+	return &blockingStreamConsumer{&collectingStreamConsumer{bc.collectingConsumer}, bc.unblockCh}, nil
+}
+
+type blockingStreamConsumer struct {
+	*collectingStreamConsumer
+	unblockCh chan struct{}
+}
+
+func (bsc *blockingStreamConsumer) Consume(ctx context.Context, change Change) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-bsc.unblockCh:
+	}
+	return bsc.collectingStreamConsumer.Consume(ctx, change)
+}
+
+func TestReaderAddsTableAfterNextGenerationIsFound(t *testing.T) {
+	now := time.Now()
+	streamA := StreamID{0x0A}
+	streamB := StreamID{0x0B}
+	streamC := StreamID{0x0C}
+
+	ds := NewInMemoryDataSource()
+	ds.AddGeneration(now.Add(-time.Hour), []StreamID{streamA, streamB})
+	newTestInMemoryTable(t, ds, "tbl")
+	newTestInMemoryTable(t, ds, "tbl2")
+
+	addTestUpdate(t, ds, "tbl", streamA, now.Add(-60*time.Second), 1, 1)
+	addTestUpdate(t, ds, "tbl2", streamB, now.Add(-50*time.Second), 2, 1)
+	ds.AddGeneration(now.Add(-30*time.Second), []StreamID{streamC})
+
+	// Keeps the first generation open after the next one is found
+	consumer := &blockingConsumer{
+		collectingConsumer: newCollectingConsumer(),
+		tableName:          "ks.tbl",
+		unblockCh:          make(chan struct{}),
+	}
+	cfg := &ReaderConfig{
+		DataSource:            ds,
+		ChangeConsumerFactory: consumer,
+		TableNames:            []string{"ks.tbl"},
+		Advanced:              testAdvancedConfig,
+	}
+
+	reader, err := NewReader(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errC := make(chan error)
+	go func() { errC <- reader.Run(context.Background()) }()
+
+	waitFor(t, 5*time.Second, func() bool {
+		reader.mu.Lock()
+		defer reader.mu.Unlock()
+		return reader.currentGen != nil && reader.currentGen.finished
+	})
+
+	// The rest of the first generation should still be read
+	if err := reader.AddTable(context.Background(), "ks.tbl2"); err != nil {
+		t.Fatal(err)
+	}
+	close(consumer.unblockCh)
+
+	waitFor(t, 5*time.Second, func() bool {
+		return len(consumer.GetChanges(streamB)) == 1
+	})
+
+	reader.StopAt(time.Now())
+	if err := <-errC; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReaderColumnProjection(t *testing.T) {
+	now := time.Now()
+	streamA := StreamID{0x0A}
+
+	ds := NewInMemoryDataSource()
+	ds.AddGeneration(now.Add(-time.Hour), []StreamID{streamA})
+	err := ds.AddTable("ks", "tbl", []gocql.ColumnInfo{
+		{Name: "pk", TypeInfo: gocql.NewNativeType(4, gocql.TypeInt, "")},
+		{Name: "v", TypeInfo: gocql.NewNativeType(4, gocql.TypeInt, "")},
+		{Name: "w", TypeInfo: gocql.NewNativeType(4, gocql.TypeInt, "")},
+		{Name: "cdc$deleted_v", TypeInfo: gocql.NewNativeType(4, gocql.TypeBoolean, "")},
+		{Name: "cdc$deleted_w", TypeInfo: gocql.NewNativeType(4, gocql.TypeBoolean, "")},
+	}, TableCDCOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addTestUpdate(t, ds, "tbl", streamA, now.Add(-60*time.Second), 1, 1)
+
+	consumer := newCollectingConsumer()
+	cfg := &ReaderConfig{
+		DataSource:            ds,
+		ChangeConsumerFactory: consumer,
+		TableNames:            []string{"ks.tbl"},
+		ColumnProjections: map[string][]string{
+			"ks.tbl": {"cdc$deleted_w"},
+		},
+		Advanced: testAdvancedConfig,
+	}
+
+	if _, err := NewReader(context.Background(), cfg); err == nil {
+		t.Error("expected an error when a cdc$ column is projected")
+	}
+
+	cfg.ColumnProjections["ks.tbl"] = []string{"pk", "v"}
+	reader, err := NewReader(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errC := make(chan error)
+	go func() { errC <- reader.Run(context.Background()) }()
+
+	waitFor(t, 5*time.Second, func() bool {
+		return len(consumer.GetChanges(streamA)) == 1
+	})
+
+	reader.StopAt(time.Now())
+	if err := <-errC; err != nil {
+		t.Fatal(err)
+	}
+
+	row := consumer.GetChanges(streamA)[0].Delta[0]
+	for _, col := range []string{"pk", "v", "cdc$deleted_v", "cdc$operation"} {
+		if _, ok := row.GetValue(col); !ok {
+			t.Errorf("expected column %s to be present", col)
+		}
+	}
+	for _, col := range []string{"w", "cdc$deleted_w"} {
+		if _, ok := row.GetValue(col); ok {
+			t.Errorf("expected column %s to be absent", col)
+		}
+	}
+	if len(row.Columns()) != len(cdcMetadataColumns)+3 {
+		t.Errorf("expected %d columns, got %d", len(cdcMetadataColumns)+3, len(row.Columns()))
+	}
+}
+
+func TestReaderReadsOnlyStreamsOfItsShard(t *testing.T) {
+	now := time.Now()
+	var streams []StreamID
+	for i := 0; i < 8; i++ {
+		streams = append(streams, StreamID{byte(i)})
+	}
+
+	ds := NewInMemoryDataSource()
+	ds.AddGeneration(now.Add(-time.Hour), streams)
+	newTestInMemoryTable(t, ds, "tbl")
+	for i, stream := range streams {
+		addTestUpdate(t, ds, "tbl", stream, now.Add(-60*time.Second), i, 1)
+	}
+
+	const shardCount = 2
+	var consumers []*collectingConsumer
+	var readers []*Reader
+	var errCs []chan error
+	for shard := 0; shard < shardCount; shard++ {
+		consumer := newCollectingConsumer()
+		cfg := &ReaderConfig{
+			DataSource:            ds,
+			ChangeConsumerFactory: consumer,
+			TableNames:            []string{"ks.tbl"},
+			ShardIndex:            shard,
+			ShardCount:            shardCount,
+			Advanced:              testAdvancedConfig,
+		}
+		reader, err := NewReader(context.Background(), cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		errC := make(chan error, 1)
+		go func() { errC <- reader.Run(context.Background()) }()
+
+		consumers = append(consumers, consumer)
+		readers = append(readers, reader)
+		errCs = append(errCs, errC)
+	}
+
+	waitFor(t, 5*time.Second, func() bool {
+		count := 0
+		for _, consumer := range consumers {
+			for _, stream := range streams {
+				count += len(consumer.GetChanges(stream))
+			}
+		}
+		return count == len(streams)
+	})
+
+	for _, stream := range streams {
+		expectedShard := getShardForStreamGroup([]StreamID{stream}, shardCount)
+		for shard, consumer := range consumers {
+			count := len(consumer.GetChanges(stream))
+			if shard == expectedShard && count != 1 {
+				t.Errorf("expected shard %d to read one change from stream %s, got %d", shard, stream, count)
+			} else if shard != expectedShard && count != 0 {
+				t.Errorf("expected shard %d not to read stream %s, got %d changes", shard, stream, count)
+			}
+		}
+	}
+
+	for i, reader := range readers {
+		reader.StopAt(time.Now())
+		if err := <-errCs[i]; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestStreamGroupShardIsStableAcrossGenerations(t *testing.T) {
+	makeStream := func(token uint64, vnodeIdx uint64) StreamID {
+		stream := make(StreamID, 16)
+		binary.BigEndian.PutUint64(stream[0:8], token)
+		binary.BigEndian.PutUint64(stream[8:16], vnodeIdx<<4|1)
+		return stream
+	}
+
+	const shardCount = 5
+	for vnodeIdx := uint64(0); vnodeIdx < 32; vnodeIdx++ {
+		oldGroup := []StreamID{makeStream(1, vnodeIdx), makeStream(2, vnodeIdx)}
+		newGroup := []StreamID{makeStream(3, vnodeIdx)}
+		if oldShard, newShard := getShardForStreamGroup(oldGroup, shardCount), getShardForStreamGroup(newGroup, shardCount); oldShard != newShard {
+			t.Errorf("groups of vnode %d were assigned to different shards: %d and %d", vnodeIdx, oldShard, newShard)
+		}
+	}
+}
+
+func TestReaderConfigRejectsInvalidShard(t *testing.T) {
+	for _, shard := range []struct {
+		index, count int
+		valid        bool
+	}{{0, 0, true}, {1, 2, true}, {2, 2, false}, {-1, 2, false}, {0, -1, false}} {
+		cfg := &ReaderConfig{
+			DataSource:            NewInMemoryDataSource(),
+			ChangeConsumerFactory: newCollectingConsumer(),
+			TableNames:            []string{"ks.tbl"},
+			ShardIndex:            shard.index,
+			ShardCount:            shard.count,
+		}
+		if err := cfg.validate(); (err == nil) != shard.valid {
+			t.Errorf("unexpected result of validation of shard %d of %d: %v", shard.index, shard.count, err)
+		}
+	}
+}
+
+func TestReaderStartsNewTablesAccordingToPolicy(t *testing.T) {
+	now := time.Now()
+	streamA := StreamID{0x0A}
+	streamB := StreamID{0x0B}
+	streamC := StreamID{0x0C}
+	applicationStartTime := now.Add(-50 * time.Minute)
+
+	ds := NewInMemoryDataSource()
+	ds.AddGeneration(now.Add(-time.Hour), []StreamID{streamA, streamB, streamC})
+	newTestInMemoryTable(t, ds, "tbl")
+	newTestInMemoryTable(t, ds, "tbl2")
+	newTestInMemoryTable(t, ds, "tbl3")
+
+	// The first table was read before, and the other ones are new
+	addTestUpdate(t, ds, "tbl", streamA, now.Add(-40*time.Minute), 1, 1)
+	addTestUpdate(t, ds, "tbl2", streamB, now.Add(-40*time.Minute), 2, 1)
+	addTestUpdate(t, ds, "tbl3", streamC, now.Add(-55*time.Minute), 3, 1)
+
+	progressManager := NewInMemoryProgressManager()
+	progressManager.SetCurrentGeneration(now.Add(-time.Hour))
+	ctx := context.Background()
+	if err := progressManager.SaveApplicationReadStartTime(ctx, applicationStartTime); err != nil {
+		t.Fatal(err)
+	}
+	if err := progressManager.SaveTableReadStartTime(ctx, "ks.tbl", applicationStartTime); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(policy NewTableStartPolicy, tableNames ...string) (*Reader, *collectingConsumer, chan error) {
+		consumer := newCollectingConsumer()
+		adv := testAdvancedConfig
+		adv.NewTableStartPolicy = policy
+		cfg := &ReaderConfig{
+			DataSource:            ds,
+			ChangeConsumerFactory: consumer,
+			TableNames:            tableNames,
+			ProgressManager:       progressManager,
+			Advanced:              adv,
+		}
+		reader, err := NewReader(ctx, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		errC := make(chan error, 1)
+		go func() { errC <- reader.Run(ctx) }()
+		return reader, consumer, errC
+	}
+
+	// A table added with NewTableStartFromNow should skip older changes
+	reader, consumer, errC := run(NewTableStartFromNow, "ks.tbl", "ks.tbl2")
+	addTestUpdate(t, ds, "tbl2", streamB, time.Now().Add(100*time.Millisecond), 2, 2)
+	waitFor(t, 5*time.Second, func() bool {
+		return len(consumer.GetChanges(streamA)) == 1 && len(consumer.GetChanges(streamB)) == 1
+	})
+	if v, _ := consumer.GetChanges(streamB)[0].Delta[0].GetValue("v"); *v.(*int) != 2 {
+		t.Errorf("expected only the change made after the table was added, got v = %d", *v.(*int))
+	}
+	if startTime, _ := progressManager.GetTableReadStartTime(ctx, "ks.tbl2"); startTime.Before(now) {
+		t.Errorf("expected the start time of the new table to be saved, got %v", startTime)
+	}
+
+	reader.StopAt(time.Now())
+	if err := <-errC; err != nil {
+		t.Fatal(err)
+	}
+
+	// A table added with NewTableStartFromEarliest should be read
+	// from before the application start time
+	reader, consumer, errC = run(NewTableStartFromEarliest, "ks.tbl", "ks.tbl2")
+	if err := reader.AddTable(ctx, "ks.tbl3"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, 5*time.Second, func() bool {
+		return len(consumer.GetChanges(streamC)) == 1
+	})
+
+	reader.StopAt(time.Now())
+	if err := <-errC; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReaderReadsTablesOfUpgradedApplicationFromApplicationStart(t *testing.T) {
+	now := time.Now()
+	streamA := StreamID{0x0A}
+	streamB := StreamID{0x0B}
+	applicationStartTime := now.Add(-50 * time.Minute)
+
+	ds := NewInMemoryDataSource()
+	ds.AddGeneration(now.Add(-time.Hour), []StreamID{streamA, streamB})
+	newTestInMemoryTable(t, ds, "tbl")
+	newTestInMemoryTable(t, ds, "tbl2")
+
+	addTestUpdate(t, ds, "tbl", streamA, now.Add(-40*time.Minute), 1, 1)
+	addTestUpdate(t, ds, "tbl2", streamB, now.Add(-40*time.Minute), 2, 1)
+
+	// The application was reading both tables before start times of tables
+	// were saved
+	progressManager := NewInMemoryProgressManager()
+	progressManager.SetCurrentGeneration(now.Add(-time.Hour))
+	ctx := context.Background()
+	if err := progressManager.SaveApplicationReadStartTime(ctx, applicationStartTime); err != nil {
+		t.Fatal(err)
+	}
+
+	consumer := newCollectingConsumer()
+	adv := testAdvancedConfig
+	adv.NewTableStartPolicy = NewTableStartFromNow
+	cfg := &ReaderConfig{
+		DataSource:            ds,
+		ChangeConsumerFactory: consumer,
+		TableNames:            []string{"ks.tbl", "ks.tbl2"},
+		ProgressManager:       progressManager,
+		Advanced:              adv,
+	}
+	reader, err := NewReader(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errC := make(chan error, 1)
+	go func() { errC <- reader.Run(ctx) }()
+
+	waitFor(t, 5*time.Second, func() bool {
+		return len(consumer.GetChanges(streamA)) == 1 && len(consumer.GetChanges(streamB)) == 1
+	})
+	for _, table := range cfg.TableNames {
+		if startTime, _ := progressManager.GetTableReadStartTime(ctx, table); !startTime.Equal(applicationStartTime) {
+			t.Errorf("expected the application start time to be saved for table %s, got %v", table, startTime)
+		}
+	}
+
+	reader.StopAt(time.Now())
+	if err := <-errC; err != nil {
+		t.Fatal(err)
+	}
+}
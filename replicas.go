@@ -0,0 +1,213 @@
+package scyllacdc
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gocql/gocql"
+)
+
+// ReplicaLocator determines which nodes of the cluster own partitions
+// of the CDC log. It allows the Reader to group streams owned by the same
+// nodes, so that a query of each group can be served by a single replica.
+//
+// ClusterEventPolicy implements this interface.
+type ReplicaLocator interface {
+	// GetReplicas returns IDs of the nodes which are replicas of given
+	// token in given keyspace. The order of the IDs is not important.
+	GetReplicas(keyspace string, token int64) ([]string, error)
+}
+
+// A node of the cluster as seen by the token ring.
+type ringNode struct {
+	id     string
+	dc     string
+	rack   string
+	tokens []string
+}
+
+type ringEntry struct {
+	token int64
+	node  *ringNode
+}
+
+// tokenRing maps tokens to their replicas, following the replication
+// strategies used by Scylla. Tokens are parsed as int64, so only
+// partitioners which use such tokens (Murmur3 and CDC) are supported.
+type tokenRing struct {
+	entries []ringEntry
+
+	nodesInDC map[string]int
+	racksInDC map[string]int
+}
+
+func newTokenRing(nodes []*ringNode) (*tokenRing, error) {
+	tr := &tokenRing{
+		nodesInDC: make(map[string]int),
+		racksInDC: make(map[string]int),
+	}
+	racks := make(map[string]map[string]struct{})
+
+	for _, node := range nodes {
+		for _, tokenStr := range node.tokens {
+			token, err := strconv.ParseInt(tokenStr, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse token %q of node %s: %w", tokenStr, node.id, err)
+			}
+			tr.entries = append(tr.entries, ringEntry{token, node})
+		}
+
+		tr.nodesInDC[node.dc]++
+		if racks[node.dc] == nil {
+			racks[node.dc] = make(map[string]struct{})
+		}
+		racks[node.dc][node.rack] = struct{}{}
+	}
+	for dc, dcRacks := range racks {
+		tr.racksInDC[dc] = len(dcRacks)
+	}
+
+	sort.Slice(tr.entries, func(i, j int) bool {
+		return tr.entries[i].token < tr.entries[j].token
+	})
+	return tr, nil
+}
+
+// Returns IDs of the replicas of given token in a keyspace with given
+// replication strategy. The first ID belongs to the primary replica.
+func (tr *tokenRing) getReplicas(kmeta *gocql.KeyspaceMetadata, token int64) ([]string, error) {
+	if len(tr.entries) == 0 {
+		return nil, errors.New("no tokens are known")
+	}
+
+	// The primary replica owns the first token which is not lower
+	// than given token, wrapping around the ring
+	first := sort.Search(len(tr.entries), func(i int) bool {
+		return tr.entries[i].token >= token
+	})
+
+	class := kmeta.StrategyClass
+	if idx := strings.LastIndexByte(class, '.'); idx != -1 {
+		class = class[idx+1:]
+	}
+
+	switch class {
+	case "SimpleStrategy":
+		rf, err := parseReplicationFactor(kmeta.StrategyOptions["replication_factor"])
+		if err != nil {
+			return nil, err
+		}
+		return tr.walk(first, func(node *ringNode, replicas []string) bool {
+			return len(replicas) < rf
+		}), nil
+
+	case "NetworkTopologyStrategy":
+		return tr.getNetworkTopologyReplicas(kmeta, first)
+
+	case "EverywhereStrategy":
+		return tr.walk(first, func(node *ringNode, replicas []string) bool {
+			return true
+		}), nil
+
+	default:
+		// Don't know how to place the replicas, use only the primary one
+		return []string{tr.entries[first%len(tr.entries)].node.id}, nil
+	}
+}
+
+// Walks the ring starting from given entry and collects distinct nodes
+// for which accept returns true.
+func (tr *tokenRing) walk(first int, accept func(node *ringNode, replicas []string) bool) []string {
+	var replicas []string
+	added := make(map[*ringNode]struct{})
+	for i := 0; i < len(tr.entries); i++ {
+		node := tr.entries[(first+i)%len(tr.entries)].node
+		if _, ok := added[node]; ok {
+			continue
+		}
+		if accept(node, replicas) {
+			added[node] = struct{}{}
+			replicas = append(replicas, node.id)
+		}
+	}
+	return replicas
+}
+
+// Places replicas in each datacenter on nodes from distinct racks first,
+// and only then on the nodes from racks which already have a replica.
+func (tr *tokenRing) getNetworkTopologyReplicas(kmeta *gocql.KeyspaceMetadata, first int) ([]string, error) {
+	wanted := make(map[string]int)
+	for dc, opt := range kmeta.StrategyOptions {
+		if dc == "class" {
+			continue
+		}
+		rf, err := parseReplicationFactor(opt)
+		if err != nil {
+			return nil, err
+		}
+		if rf > tr.nodesInDC[dc] {
+			rf = tr.nodesInDC[dc]
+		}
+		wanted[dc] = rf
+	}
+
+	placed := make(map[string]int)
+	seenRacks := make(map[string]map[string]struct{})
+	skipped := make(map[string][]*ringNode)
+	for dc := range wanted {
+		seenRacks[dc] = make(map[string]struct{})
+	}
+
+	var replicas []string
+	added := make(map[*ringNode]struct{})
+	add := func(node *ringNode) {
+		if _, ok := added[node]; ok || placed[node.dc] >= wanted[node.dc] {
+			return
+		}
+		added[node] = struct{}{}
+		replicas = append(replicas, node.id)
+		placed[node.dc]++
+	}
+
+	for i := 0; i < len(tr.entries); i++ {
+		node := tr.entries[(first+i)%len(tr.entries)].node
+		dc := node.dc
+		if _, ok := added[node]; ok || placed[dc] >= wanted[dc] {
+			continue
+		}
+
+		if len(seenRacks[dc]) == tr.racksInDC[dc] {
+			// All racks already have a replica
+			add(node)
+			continue
+		}
+		if _, ok := seenRacks[dc][node.rack]; ok {
+			skipped[dc] = append(skipped[dc], node)
+			continue
+		}
+
+		add(node)
+		seenRacks[dc][node.rack] = struct{}{}
+		if len(seenRacks[dc]) == tr.racksInDC[dc] {
+			// Use the nodes which were skipped because of their racks
+			for _, skippedNode := range skipped[dc] {
+				add(skippedNode)
+			}
+			skipped[dc] = nil
+		}
+	}
+	return replicas, nil
+}
+
+func parseReplicationFactor(opt interface{}) (int, error) {
+	// Depending on the version of the schema tables, gocql reports
+	// the replication options as strings or as numbers
+	rf, err := strconv.Atoi(fmt.Sprint(opt))
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse replication factor %v: %w", opt, err)
+	}
+	return rf, nil
+}
@@ -0,0 +1,296 @@
+package scyllacdc
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+func TestTokenRingReplicas(t *testing.T) {
+	// Tokens: a:-100 b:0 c:100 d:200 a:300
+	nodes := []*ringNode{
+		{id: "a", dc: "dc1", rack: "r1", tokens: []string{"-100", "300"}},
+		{id: "b", dc: "dc1", rack: "r1", tokens: []string{"0"}},
+		{id: "c", dc: "dc1", rack: "r2", tokens: []string{"100"}},
+		{id: "d", dc: "dc2", rack: "r1", tokens: []string{"200"}},
+	}
+	ring, err := newTokenRing(nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	simple := &gocql.KeyspaceMetadata{
+		StrategyClass:   "org.apache.cassandra.locator.SimpleStrategy",
+		StrategyOptions: map[string]interface{}{"replication_factor": "2"},
+	}
+	networkTopology := &gocql.KeyspaceMetadata{
+		StrategyClass:   "org.apache.cassandra.locator.NetworkTopologyStrategy",
+		StrategyOptions: map[string]interface{}{"dc1": 2, "dc2": "3"},
+	}
+	local := &gocql.KeyspaceMetadata{
+		StrategyClass: "org.apache.cassandra.locator.LocalStrategy",
+	}
+
+	tests := []struct {
+		name     string
+		kmeta    *gocql.KeyspaceMetadata
+		token    int64
+		expected []string
+	}{
+		{"simple", simple, -50, []string{"b", "c"}},
+		{"simple exact token", simple, 0, []string{"b", "c"}},
+		{"simple wraps around", simple, 250, []string{"a", "b"}},
+		{"simple after the last token", simple, 1000, []string{"a", "b"}},
+		{"network topology", networkTopology, -50, []string{"b", "c", "d"}},
+		// b is skipped in favour of c, which is in a different rack than a
+		{"network topology skips racks", networkTopology, -150, []string{"a", "c", "d"}},
+		{"unknown strategy", local, 50, []string{"c"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			replicas, err := ring.getReplicas(tc.kmeta, tc.token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(replicas, tc.expected) {
+				t.Errorf("expected replicas %v, got %v", tc.expected, replicas)
+			}
+		})
+	}
+}
+
+func TestTokenRingRejectsInvalidTokens(t *testing.T) {
+	_, err := newTokenRing([]*ringNode{{id: "a", tokens: []string{"not a number"}}})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+// A ReplicaLocator which assigns tokens to replicas by their sign.
+type testReplicaLocator struct{}
+
+func (testReplicaLocator) GetReplicas(keyspace string, token int64) ([]string, error) {
+	if token < 0 {
+		return []string{"b", "a"}, nil
+	}
+	return []string{"a", "b", "c"}, nil
+}
+
+func TestReaderGroupsStreamsByReplicas(t *testing.T) {
+	now := time.Now()
+	genTime := now.Add(-time.Hour)
+
+	makeStream := func(token int64, vnodeIdx uint64) StreamID {
+		stream := make(StreamID, 16)
+		binary.BigEndian.PutUint64(stream[0:8], uint64(token))
+		binary.BigEndian.PutUint64(stream[8:16], vnodeIdx<<4|1)
+		return stream
+	}
+
+	// Four vnodes, but only two distinct sets of replicas
+	streams := []StreamID{
+		makeStream(-200, 0),
+		makeStream(-100, 1),
+		makeStream(100, 2),
+		makeStream(200, 3),
+		{0x01},
+	}
+
+	ds := &recordingDataSource{InMemoryDataSource: NewInMemoryDataSource()}
+	ds.AddGeneration(genTime, streams)
+	newTestInMemoryTable(t, ds.InMemoryDataSource, "tbl")
+	for i, stream := range streams {
+		addTestUpdate(t, ds.InMemoryDataSource, "tbl", stream, now.Add(-time.Minute), i, 1)
+	}
+
+	consumer := newCollectingConsumer()
+	observer := &recordingGenerationObserver{}
+	cfg := &ReaderConfig{
+		DataSource:            ds,
+		ChangeConsumerFactory: consumer,
+		TableNames:            []string{"ks.tbl"},
+		GenerationObserver:    observer,
+		ReplicaLocator:        testReplicaLocator{},
+		Advanced:              testAdvancedConfig,
+	}
+	reader, err := NewReader(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errC := make(chan error, 1)
+	go func() { errC <- reader.Run(context.Background()) }()
+
+	waitFor(t, 5*time.Second, func() bool {
+		for _, stream := range streams {
+			if len(consumer.GetChanges(stream)) == 0 {
+				return false
+			}
+		}
+		return true
+	})
+	reader.Stop()
+	if err := <-errC; err != nil {
+		t.Fatal(err)
+	}
+
+	// Two groups of known streams, and one for the stream of unknown format
+	observer.mu.Lock()
+	expectedEvent := fmt.Sprintf("started %d 5/3", genTime.Unix())
+	if len(observer.events) < 2 || observer.events[1] != expectedEvent {
+		t.Errorf("expected event %q, got events %v", expectedEvent, observer.events)
+	}
+	observer.mu.Unlock()
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	for _, input := range ds.inputs {
+		streamSet := make([]string, 0, len(input.Streams))
+		for _, stream := range input.Streams {
+			streamSet = append(streamSet, stream.String())
+		}
+		sort.Strings(streamSet)
+
+		var expected []string
+		switch {
+		case len(input.Streams) == 1 && len(input.Streams[0]) != 16:
+			expected = []string{streams[4].String()}
+		case input.Streams[0][0]&0x80 != 0:
+			expected = []string{streams[0].String(), streams[1].String()}
+		default:
+			expected = []string{streams[2].String(), streams[3].String()}
+		}
+		if !reflect.DeepEqual(streamSet, expected) {
+			t.Errorf("expected streams %v to be queried together, got %v", expected, streamSet)
+		}
+		if input.RoutingStream == nil {
+			t.Errorf("expected the query of streams %v to be routed", streamSet)
+		}
+	}
+}
+
+// A ReplicaLocator which assigns all tokens to the same replicas, as if
+// the replication factor was equal to the number of nodes.
+type sameReplicasLocator struct{}
+
+func (sameReplicasLocator) GetReplicas(keyspace string, token int64) ([]string, error) {
+	return []string{"a", "b", "c"}, nil
+}
+
+func TestReplicaGroupsAreLimited(t *testing.T) {
+	// 50 vnodes with 5 streams each
+	var streams []StreamID
+	for vnodeIdx := uint64(0); vnodeIdx < 50; vnodeIdx++ {
+		for i := int64(0); i < 5; i++ {
+			stream := make(StreamID, 16)
+			binary.BigEndian.PutUint64(stream[0:8], uint64(int64(vnodeIdx)*10+i))
+			binary.BigEndian.PutUint64(stream[8:16], vnodeIdx<<4|1)
+			streams = append(streams, stream)
+		}
+	}
+
+	cfg := &ReaderConfig{ReplicaLocator: sameReplicasLocator{}}
+	cfg.Advanced.MaxStreamsPerGroup = 12
+	cfg.Advanced.setDefaults()
+	reader := &Reader{config: cfg, tableNames: []string{"ks.tbl"}}
+
+	groups, err := reader.splitStreamsByReplicas(streams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 250 streams in groups of at most 2 whole vnodes
+	if len(groups) != 25 {
+		t.Errorf("expected 25 groups, got %d", len(groups))
+	}
+	vnodeGroups := make(map[int64]int)
+	for i, group := range groups {
+		if len(group) > cfg.Advanced.MaxStreamsPerGroup {
+			t.Errorf("expected at most %d streams in a group, got %d", cfg.Advanced.MaxStreamsPerGroup, len(group))
+		}
+		for _, stream := range group {
+			idx := getVnodeIndexForStream(stream)
+			if prev, ok := vnodeGroups[idx]; ok && prev != i {
+				t.Errorf("streams of vnode %d were put into different groups", idx)
+			}
+			vnodeGroups[idx] = i
+		}
+	}
+	if len(vnodeGroups) != 50 {
+		t.Errorf("expected streams of 50 vnodes, got %d", len(vnodeGroups))
+	}
+}
+
+func TestShardedReadersWithReplicaLocatorReadEachStreamOnce(t *testing.T) {
+	now := time.Now()
+	genTime := now.Add(-time.Hour)
+
+	var streams []StreamID
+	for vnodeIdx := uint64(0); vnodeIdx < 8; vnodeIdx++ {
+		for i := int64(0); i < 2; i++ {
+			stream := make(StreamID, 16)
+			binary.BigEndian.PutUint64(stream[0:8], uint64((int64(vnodeIdx)-1)*100+i))
+			binary.BigEndian.PutUint64(stream[8:16], vnodeIdx<<4|1)
+			streams = append(streams, stream)
+		}
+	}
+
+	ds := NewInMemoryDataSource()
+	ds.AddGeneration(genTime, streams)
+	newTestInMemoryTable(t, ds, "tbl")
+	for i, stream := range streams {
+		addTestUpdate(t, ds, "tbl", stream, now.Add(-time.Minute), i, 1)
+	}
+
+	// The Readers see different replicas of the same tokens
+	consumer := newCollectingConsumer()
+	locators := []ReplicaLocator{testReplicaLocator{}, sameReplicasLocator{}}
+	var errCs []chan error
+	var readers []*Reader
+	for shard, locator := range locators {
+		cfg := &ReaderConfig{
+			DataSource:            ds,
+			ChangeConsumerFactory: consumer,
+			TableNames:            []string{"ks.tbl"},
+			ReplicaLocator:        locator,
+			ShardIndex:            shard,
+			ShardCount:            len(locators),
+			Advanced:              testAdvancedConfig,
+		}
+		reader, err := NewReader(context.Background(), cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		errC := make(chan error, 1)
+		go func() { errC <- reader.Run(context.Background()) }()
+		readers = append(readers, reader)
+		errCs = append(errCs, errC)
+	}
+
+	waitFor(t, 5*time.Second, func() bool {
+		for _, stream := range streams {
+			if len(consumer.GetChanges(stream)) == 0 {
+				return false
+			}
+		}
+		return true
+	})
+	for i, reader := range readers {
+		reader.StopAt(time.Now())
+		if err := <-errCs[i]; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, stream := range streams {
+		if changes := consumer.GetChanges(stream); len(changes) != 1 {
+			t.Errorf("expected stream %s to be read once, got %d changes", stream, len(changes))
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package scyllacdc
+
+import (
+	"errors"
+	"fmt"
+)
+
+// RowFilter selects which rows of the CDC log are delivered to consumers.
+// Rows which are filtered out are not included in the Change passed
+// to the consumer. If all rows of a change are filtered out, the change
+// is not delivered at all, but the progress of the stream still advances
+// past it.
+//
+// The zero value of RowFilter delivers all rows.
+type RowFilter struct {
+	// Operation types of delta rows which should be delivered. If empty,
+	// delta rows of all operation types are delivered. PreImage and PostImage
+	// are not delta operation types and cannot be listed here.
+	DeltaOperations []OperationType
+
+	// If true, preimage rows are not delivered.
+	SkipPreImage bool
+
+	// If true, delta rows are not delivered.
+	SkipDelta bool
+
+	// If true, postimage rows are not delivered.
+	SkipPostImage bool
+}
+
+func (rf *RowFilter) validate() error {
+	if rf.SkipPreImage && rf.SkipDelta && rf.SkipPostImage {
+		return errors.New("the row filter does not allow any rows to be delivered")
+	}
+	for _, op := range rf.DeltaOperations {
+		if op <= PreImage || op >= PostImage {
+			return fmt.Errorf("invalid delta operation type in the row filter: %s (%d)", op, op)
+		}
+	}
+	return nil
+}
+
+// A precomputed form of RowFilter which is cheap to evaluate.
+type rowFilter struct {
+	skipPreImage  bool
+	skipDelta     bool
+	skipPostImage bool
+	deltaOps      map[OperationType]struct{}
+}
+
+func newRowFilter(rf RowFilter) *rowFilter {
+	f := &rowFilter{
+		skipPreImage:  rf.SkipPreImage,
+		skipDelta:     rf.SkipDelta,
+		skipPostImage: rf.SkipPostImage,
+	}
+	if len(rf.DeltaOperations) > 0 {
+		f.deltaOps = make(map[OperationType]struct{}, len(rf.DeltaOperations))
+		for _, op := range rf.DeltaOperations {
+			f.deltaOps[op] = struct{}{}
+		}
+	}
+	return f
+}
+
+func (f *rowFilter) accepts(op OperationType) bool {
+	switch op {
+	case PreImage:
+		return !f.skipPreImage
+	case PostImage:
+		return !f.skipPostImage
+	}
+	if f.skipDelta {
+		return false
+	}
+	if f.deltaOps == nil {
+		return true
+	}
+	_, ok := f.deltaOps[op]
+	return ok
+}
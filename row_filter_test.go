@@ -0,0 +1,160 @@
+package scyllacdc
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+func TestReaderFiltersRows(t *testing.T) {
+	now := time.Now()
+	streamA := StreamID{0x0A}
+
+	ds := NewInMemoryDataSource()
+	ds.AddGeneration(now.Add(-time.Hour), []StreamID{streamA})
+	newTestInMemoryTable(t, ds, "tbl")
+
+	pk, v := 1, 1
+	values := map[string]interface{}{"pk": &pk, "v": &v}
+
+	withImages := gocql.UUIDFromTime(now.Add(-90 * time.Second))
+	err := ds.AddChange("ks", "tbl", streamA, withImages,
+		InMemoryLogRow{Operation: PreImage, Values: values},
+		InMemoryLogRow{Operation: Update, Values: values},
+		InMemoryLogRow{Operation: PostImage, Values: values},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Should not be delivered, as all of its rows are filtered out
+	rowDelete := gocql.UUIDFromTime(now.Add(-80 * time.Second))
+	err = ds.AddChange("ks", "tbl", streamA, rowDelete, InMemoryLogRow{Operation: RowDelete, Values: values})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	update := addTestUpdate(t, ds, "tbl", streamA, now.Add(-70*time.Second), 1, 2)
+
+	consumer := newCollectingConsumer()
+	cfg := &ReaderConfig{
+		DataSource:            ds,
+		ChangeConsumerFactory: consumer,
+		TableNames:            []string{"ks.tbl"},
+		RowFilter: RowFilter{
+			DeltaOperations: []OperationType{Update, PostImage},
+			SkipPreImage:    true,
+			SkipPostImage:   true,
+		},
+		Advanced: testAdvancedConfig,
+	}
+
+	if _, err := NewReader(context.Background(), cfg); err == nil {
+		t.Error("expected an error when PostImage is listed as a delta operation")
+	}
+
+	cfg.RowFilter.DeltaOperations = []OperationType{Update}
+	reader, err := NewReader(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errC := make(chan error)
+	go func() { errC <- reader.Run(context.Background()) }()
+
+	waitFor(t, 5*time.Second, func() bool {
+		return len(consumer.GetChanges(streamA)) == 2
+	})
+
+	reader.StopAt(time.Now())
+	if err := <-errC; err != nil {
+		t.Fatal(err)
+	}
+
+	changes := consumer.GetChanges(streamA)
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 changes, got %d", len(changes))
+	}
+	for i, expectedTime := range []gocql.UUID{withImages, update} {
+		change := changes[i]
+		if change.Time != expectedTime {
+			t.Errorf("expected change %d to have time %s, got %s", i, expectedTime, change.Time)
+		}
+		if len(change.PreImage) != 0 || len(change.PostImage) != 0 {
+			t.Errorf("expected change %d to have no images", i)
+		}
+		if len(change.Delta) != 1 || change.Delta[0].GetOperation() != Update {
+			t.Errorf("expected change %d to have a single update row", i)
+		}
+	}
+}
+
+func TestReaderReportsEmptyWindowsWithFilteredRows(t *testing.T) {
+	now := time.Now()
+	streamA := StreamID{0x0A}
+
+	ds := NewInMemoryDataSource()
+	ds.AddGeneration(now.Add(-time.Hour), []StreamID{streamA})
+	newTestInMemoryTable(t, ds, "tbl")
+
+	pk, v := 1, 1
+	values := map[string]interface{}{"pk": &pk, "v": &v}
+
+	// Both changes are filtered out, and they are in different windows
+	for _, changeTime := range []time.Time{now.Add(-80 * time.Second), now.Add(-30 * time.Second)} {
+		err := ds.AddChange("ks", "tbl", streamA, gocql.UUIDFromTime(changeTime), InMemoryLogRow{Operation: RowDelete, Values: values})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	consumer := &recordingConsumer{mu: &sync.Mutex{}}
+	cfg := &ReaderConfig{
+		DataSource:            ds,
+		ChangeConsumerFactory: consumer,
+		TableNames:            []string{"ks.tbl"},
+		RowFilter:             RowFilter{DeltaOperations: []OperationType{Update}},
+		Advanced:              testAdvancedConfig,
+	}
+	reader, err := NewReader(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errC := make(chan error)
+	go func() { errC <- reader.Run(context.Background()) }()
+
+	waitFor(t, 5*time.Second, func() bool {
+		return len(consumer.GetTimestamps()) > 0
+	})
+
+	reader.StopAt(time.Now())
+	if err := <-errC; err != nil {
+		t.Fatal(err)
+	}
+
+	// The window with the first change should be reported as empty
+	if first := consumer.GetTimestamps()[0].Time(); !first.Before(now.Add(-30 * time.Second)) {
+		t.Errorf("expected the window with only filtered rows to be reported as empty, first reported time is %v", first)
+	}
+}
+
+func TestRowFilterValidation(t *testing.T) {
+	for _, rf := range []RowFilter{
+		{SkipPreImage: true, SkipDelta: true, SkipPostImage: true},
+		{DeltaOperations: []OperationType{PreImage}},
+		{DeltaOperations: []OperationType{OperationType(42)}},
+		{DeltaOperations: []OperationType{OperationType(-1)}},
+	} {
+		if err := rf.validate(); err == nil {
+			t.Errorf("expected row filter %+v to be invalid", rf)
+		}
+	}
+
+	if err := (&RowFilter{SkipDelta: true}).validate(); err != nil {
+		t.Errorf("expected a row filter delivering only images to be valid, got %s", err)
+	}
+}
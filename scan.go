@@ -0,0 +1,209 @@
+package scyllacdc
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/gocql/gocql"
+)
+
+var (
+	atomicChangeType = reflect.TypeOf(AtomicChange{})
+	listChangeType   = reflect.TypeOf(ListChange{})
+	setChangeType    = reflect.TypeOf(SetChange{})
+	mapChangeType    = reflect.TypeOf(MapChange{})
+	udtChangeType    = reflect.TypeOf(UDTChange{})
+)
+
+// Scan fills fields of the struct pointed to by dst with values of columns
+// of the row. Only fields with a `cql` tag are filled, and the tag specifies
+// the name of the column, optionally followed by an option:
+//
+//	type Row struct {
+//	    PK        int              `cql:"pk"`
+//	    V         *string          `cql:"v"`
+//	    VDeleted  bool             `cql:"v,deleted"`
+//	    L         ListChange       `cql:"l"`
+//	    S         []int            `cql:"s"`
+//	    SRemoved  []int            `cql:"s,deleted_elements"`
+//	}
+//
+// Values are assigned according to the representation described in
+// the ChangeRow documentation. A field can have the same type as the value
+// - for example, *string for a text column, which allows to differentiate
+// a null from an empty string. A field can also have the type pointed to by
+// the value (here: string), in which case a null is scanned as the zero value.
+//
+// Fields of type AtomicChange, ListChange, SetChange, MapChange or UDTChange
+// are filled using the corresponding Get*Change method, and the column must
+// be of the type the method expects. The "deleted" option
+// fills a bool field with the result of IsDeleted, and the "deleted_elements"
+// option fills a field with the value of the cdc$deleted_elements_ column.
+//
+// Scan returns an error if a column is not present in the row or its value
+// cannot be assigned to the field.
+func (c *ChangeRow) Scan(dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("scan destination must be a non-nil pointer to a struct, got %T", dst)
+	}
+	v = v.Elem()
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, ok := field.Tag.Lookup("cql")
+		if !ok || tag == "-" {
+			continue
+		}
+		if field.PkgPath != "" {
+			return fmt.Errorf("field %s is not exported and cannot be scanned into", field.Name)
+		}
+
+		column, option := tag, ""
+		if idx := strings.IndexByte(tag, ','); idx >= 0 {
+			column, option = tag[:idx], tag[idx+1:]
+		}
+		if err := c.scanField(v.Field(i), field, column, option); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *ChangeRow) scanField(fv reflect.Value, field reflect.StructField, column, option string) error {
+	if _, ok := c.fieldNameToIdx[column]; !ok {
+		return fmt.Errorf("cannot scan into field %s: column %s is not present in the row", field.Name, column)
+	}
+
+	switch option {
+	case "":
+	case "deleted":
+		if field.Type.Kind() != reflect.Bool {
+			return fmt.Errorf("cannot scan into field %s: fields with the deleted option must be of type bool, got %s", field.Name, field.Type)
+		}
+		isDeleted, ok := c.IsDeleted(column)
+		if !ok {
+			return fmt.Errorf("cannot scan into field %s: column cdc$deleted_%s is not present in the row", field.Name, column)
+		}
+		fv.SetBool(isDeleted)
+		return nil
+	case "deleted_elements":
+		deletedElements, ok := c.GetDeletedElements(column)
+		if !ok {
+			return fmt.Errorf("cannot scan into field %s: column cdc$deleted_elements_%s is not present in the row", field.Name, column)
+		}
+		return assignScannedValue(fv, field, "cdc$deleted_elements_"+column, deletedElements)
+	default:
+		return fmt.Errorf("cannot scan into field %s: unknown option %q", field.Name, option)
+	}
+
+	switch field.Type {
+	case atomicChangeType, listChangeType, setChangeType, mapChangeType, udtChangeType:
+		if err := c.checkChangeColumnType(field, column); err != nil {
+			return err
+		}
+	}
+
+	switch field.Type {
+	case atomicChangeType:
+		fv.Set(reflect.ValueOf(c.GetAtomicChange(column)))
+		return nil
+	case listChangeType:
+		fv.Set(reflect.ValueOf(c.GetListChange(column)))
+		return nil
+	case setChangeType:
+		fv.Set(reflect.ValueOf(c.GetSetChange(column)))
+		return nil
+	case mapChangeType:
+		fv.Set(reflect.ValueOf(c.GetMapChange(column)))
+		return nil
+	case udtChangeType:
+		fv.Set(reflect.ValueOf(c.GetUDTChange(column)))
+		return nil
+	}
+
+	value, _ := c.GetValue(column)
+	return assignScannedValue(fv, field, column, value)
+}
+
+// Returns a ScanTypeError if the column can't be represented by the Get*Change
+// type of the field. Only non-frozen collections and UDTs have
+// the cdc$deleted_elements_ column, which tells them apart from atomic values.
+func (c *ChangeRow) checkChangeColumnType(field reflect.StructField, column string) error {
+	info, _ := c.GetType(column)
+	_, hasDeletedElements := c.fieldNameToIdx["cdc$deleted_elements_"+column]
+
+	var ok bool
+	switch field.Type {
+	case atomicChangeType:
+		ok = !hasDeletedElements
+	case listChangeType:
+		// Lists are represented as maps from cell timestamps to values
+		collection, isCollection := info.(gocql.CollectionType)
+		ok = isCollection && collection.Type() == gocql.TypeMap && collection.Key.Type() == gocql.TypeTimeUUID
+	case setChangeType:
+		ok = info.Type() == gocql.TypeSet
+	case mapChangeType:
+		ok = info.Type() == gocql.TypeMap
+	case udtChangeType:
+		ok = info.Type() == gocql.TypeUDT
+	}
+	if ok {
+		return nil
+	}
+	return &ScanTypeError{
+		Column:    column,
+		Field:     field.Name,
+		ValueType: reflect.TypeOf(nullValueForType(info)),
+		FieldType: field.Type,
+	}
+}
+
+func assignScannedValue(fv reflect.Value, field reflect.StructField, column string, value interface{}) error {
+	if value == nil {
+		fv.Set(reflect.Zero(field.Type))
+		return nil
+	}
+
+	vv := reflect.ValueOf(value)
+	if vv.Type().AssignableTo(field.Type) {
+		fv.Set(vv)
+		return nil
+	}
+
+	// Allow scanning *T into T, null becomes the zero value
+	if vv.Kind() == reflect.Ptr && vv.Type().Elem().AssignableTo(field.Type) {
+		if vv.IsNil() {
+			fv.Set(reflect.Zero(field.Type))
+		} else {
+			fv.Set(vv.Elem())
+		}
+		return nil
+	}
+
+	return &ScanTypeError{
+		Column:    column,
+		Field:     field.Name,
+		ValueType: vv.Type(),
+		FieldType: field.Type,
+	}
+}
+
+// ScanTypeError is returned by ChangeRow.Scan if a value of a column
+// cannot be assigned to a field of the destination struct.
+type ScanTypeError struct {
+	Column    string
+	Field     string
+	ValueType reflect.Type
+	FieldType reflect.Type
+}
+
+// Error is needed to implement the error interface.
+func (ste *ScanTypeError) Error() string {
+	return fmt.Sprintf(
+		"cannot scan column %s of type %s into field %s of type %s",
+		ste.Column, ste.ValueType, ste.Field, ste.FieldType,
+	)
+}
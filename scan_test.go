@@ -0,0 +1,149 @@
+package scyllacdc
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+func TestChangeRowScan(t *testing.T) {
+	intType := gocql.NewNativeType(4, gocql.TypeInt, "")
+	textType := gocql.NewNativeType(4, gocql.TypeText, "")
+	boolType := gocql.NewNativeType(4, gocql.TypeBoolean, "")
+	setType := gocql.CollectionType{
+		NativeType: gocql.NewNativeType(4, gocql.TypeSet, ""),
+		Elem:       intType,
+	}
+
+	ds := NewInMemoryDataSource()
+	err := ds.AddTable("ks", "tbl", []gocql.ColumnInfo{
+		{Name: "pk", TypeInfo: intType},
+		{Name: "v", TypeInfo: textType},
+		{Name: "w", TypeInfo: textType},
+		{Name: "s", TypeInfo: setType},
+		{Name: "cdc$deleted_v", TypeInfo: boolType},
+		{Name: "cdc$deleted_s", TypeInfo: boolType},
+		{Name: "cdc$deleted_elements_s", TypeInfo: setType},
+	}, TableCDCOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pk, v, deleted := 1, "abc", true
+	streamID := StreamID{0x0A}
+	now := time.Now()
+	err = ds.AddChange("ks", "tbl", streamID, gocql.UUIDFromTime(now), InMemoryLogRow{
+		Operation: Update,
+		Values: map[string]interface{}{
+			"pk":                     &pk,
+			"v":                      &v,
+			"s":                      []int{1, 2},
+			"cdc$deleted_v":          &deleted,
+			"cdc$deleted_elements_s": []int{3},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iter, err := ds.QueryRange(context.Background(), QueryRangeInput{
+		KeyspaceName: "ks",
+		TableName:    "tbl",
+		Streams:      []StreamID{streamID},
+		Start:        gocql.MinTimeUUID(now.Add(-time.Second)),
+		End:          gocql.MaxTimeUUID(now),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := iter.Next()
+	if row == nil {
+		t.Fatal("expected a row")
+	}
+
+	var dst struct {
+		PK       int       `cql:"pk"`
+		V        *string   `cql:"v"`
+		VDeleted bool      `cql:"v,deleted"`
+		W        *string   `cql:"w"`
+		WValue   string    `cql:"w"`
+		S        SetChange `cql:"s"`
+		SAdded   []int     `cql:"s"`
+		SRemoved []int     `cql:"s,deleted_elements"`
+		Ignored  string
+	}
+	dst.WValue = "should be overwritten"
+
+	if err := row.Scan(&dst); err != nil {
+		t.Fatal(err)
+	}
+
+	if dst.PK != 1 {
+		t.Errorf("expected pk to be 1, got %d", dst.PK)
+	}
+	if dst.V == nil || *dst.V != "abc" {
+		t.Errorf("expected v to be \"abc\", got %v", dst.V)
+	}
+	if !dst.VDeleted {
+		t.Error("expected v to be marked as deleted")
+	}
+	if dst.W != nil || dst.WValue != "" {
+		t.Errorf("expected w to be null, got %v and %q", dst.W, dst.WValue)
+	}
+	if !reflect.DeepEqual(dst.S.AddedElements, []int{1, 2}) || !reflect.DeepEqual(dst.S.RemovedElements, []int{3}) || dst.S.IsReset {
+		t.Errorf("unexpected set change: %+v", dst.S)
+	}
+	if !reflect.DeepEqual(dst.SAdded, []int{1, 2}) || !reflect.DeepEqual(dst.SRemoved, []int{3}) {
+		t.Errorf("unexpected set elements: %v, %v", dst.SAdded, dst.SRemoved)
+	}
+
+	var wrongType struct {
+		V int `cql:"v"`
+	}
+	var typeErr *ScanTypeError
+	if err := row.Scan(&wrongType); !errors.As(err, &typeErr) || typeErr.Column != "v" {
+		t.Errorf("expected a type error for column v, got %v", err)
+	}
+
+	// Get*Change types must match the type of the column
+	for _, wrongChange := range []interface{}{
+		&struct {
+			S ListChange `cql:"s"`
+		}{},
+		&struct {
+			S MapChange `cql:"s"`
+		}{},
+		&struct {
+			S AtomicChange `cql:"s"`
+		}{},
+		&struct {
+			V SetChange `cql:"v"`
+		}{},
+	} {
+		if err := row.Scan(wrongChange); !errors.As(err, &typeErr) {
+			t.Errorf("expected a type error when scanning into %T, got %v", wrongChange, err)
+		}
+	}
+
+	var noColumn struct {
+		X int `cql:"x"`
+	}
+	if err := row.Scan(&noColumn); err == nil {
+		t.Error("expected an error when scanning a column which is not present")
+	}
+
+	var wrongDeleted struct {
+		V int `cql:"v,deleted"`
+	}
+	if err := row.Scan(&wrongDeleted); err == nil {
+		t.Error("expected an error when scanning a deleted flag into a non-bool field")
+	}
+
+	if err := row.Scan(dst); err == nil {
+		t.Error("expected an error when scanning into a non-pointer")
+	}
+}
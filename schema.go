@@ -0,0 +1,75 @@
+package scyllacdc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gocql/gocql"
+)
+
+// SchemaChangeConsumer is an extension to the ChangeConsumer interface.
+// It allows the consumer to learn about changes to the schema of the CDC log
+// table, e.g. columns which were added to or dropped from the base table.
+type SchemaChangeConsumer interface {
+	ChangeConsumer
+
+	// Invoked when the reader notices that the set of columns of the CDC log
+	// table is different than in the previous query. This method is called
+	// before the first change read with the new schema is passed to Consume,
+	// so it can be used as a migration point for schemas derived from
+	// the CDC log table.
+	//
+	// The schema observed in the first query after the consumer was created
+	// is not reported - use ChangeRow.Columns to learn about it.
+	//
+	// If this method returns an error, the library will stop with an error.
+	SchemaChanged(ctx context.Context, change SchemaChange) error
+}
+
+// SchemaChange describes a change of the schema of a CDC log table.
+type SchemaChange struct {
+	// Fully qualified name of the base table.
+	TableName string
+
+	// Columns of the CDC log table before the change.
+	OldColumns []gocql.ColumnInfo
+
+	// Columns of the CDC log table after the change.
+	NewColumns []gocql.ColumnInfo
+}
+
+// AddedColumns returns columns which are present only in the new schema.
+func (sc *SchemaChange) AddedColumns() []gocql.ColumnInfo {
+	return columnsDifference(sc.NewColumns, sc.OldColumns)
+}
+
+// DroppedColumns returns columns which are present only in the old schema.
+func (sc *SchemaChange) DroppedColumns() []gocql.ColumnInfo {
+	return columnsDifference(sc.OldColumns, sc.NewColumns)
+}
+
+// Returns columns from a which do not have a column with the same name
+// and type in b.
+func columnsDifference(a, b []gocql.ColumnInfo) []gocql.ColumnInfo {
+	types := make(map[string]string, len(b))
+	for _, col := range b {
+		types[col.Name] = typeInfoString(col.TypeInfo)
+	}
+	var diff []gocql.ColumnInfo
+	for _, col := range a {
+		if typ, ok := types[col.Name]; !ok || typ != typeInfoString(col.TypeInfo) {
+			diff = append(diff, col)
+		}
+	}
+	return diff
+}
+
+// Compares columns by names and types. The order of columns returned
+// by queries is not stable, so it is not taken into account.
+func sameColumns(a, b []gocql.ColumnInfo) bool {
+	return len(a) == len(b) && len(columnsDifference(a, b)) == 0
+}
+
+func typeInfoString(info gocql.TypeInfo) string {
+	return fmt.Sprintf("%v", info)
+}
@@ -0,0 +1,141 @@
+package scyllacdc
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+type schemaRecordingConsumer struct {
+	mu     *sync.Mutex
+	events []interface{}
+}
+
+func (src *schemaRecordingConsumer) CreateChangeConsumer(
+	ctx context.Context,
+	input CreateChangeConsumerInput,
+) (ChangeConsumer, error) {
+	return src, nil
+}
+
+func (src *schemaRecordingConsumer) Consume(ctx context.Context, change Change) error {
+	src.mu.Lock()
+	src.events = append(src.events, change)
+	src.mu.Unlock()
+	return nil
+}
+
+func (src *schemaRecordingConsumer) SchemaChanged(ctx context.Context, change SchemaChange) error {
+	src.mu.Lock()
+	src.events = append(src.events, change)
+	src.mu.Unlock()
+	return nil
+}
+
+func (src *schemaRecordingConsumer) End() error {
+	return nil
+}
+
+func (src *schemaRecordingConsumer) GetEvents() []interface{} {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	return append([]interface{}{}, src.events...)
+}
+
+func TestReaderNotifiesAboutSchemaChanges(t *testing.T) {
+	now := time.Now()
+	streamA := StreamID{0x0A}
+
+	ds := NewInMemoryDataSource()
+	ds.AddGeneration(now.Add(-time.Hour), []StreamID{streamA})
+	newTestInMemoryTable(t, ds, "tbl")
+
+	addTestUpdate(t, ds, "tbl", streamA, now.Add(-60*time.Second), 1, 1)
+
+	consumer := &schemaRecordingConsumer{mu: &sync.Mutex{}}
+	cfg := &ReaderConfig{
+		DataSource:            ds,
+		ChangeConsumerFactory: consumer,
+		TableNames:            []string{"ks.tbl"},
+		Advanced:              testAdvancedConfig,
+	}
+
+	reader, err := NewReader(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errC := make(chan error)
+	go func() { errC <- reader.Run(context.Background()) }()
+
+	waitFor(t, 5*time.Second, func() bool {
+		return len(consumer.GetEvents()) == 1
+	})
+
+	// Add a column w, and drop the cdc$deleted_v column
+	err = ds.AlterTable("ks", "tbl", []gocql.ColumnInfo{
+		{Name: "pk", TypeInfo: gocql.NewNativeType(4, gocql.TypeInt, "")},
+		{Name: "v", TypeInfo: gocql.NewNativeType(4, gocql.TypeInt, "")},
+		{Name: "w", TypeInfo: gocql.NewNativeType(4, gocql.TypeText, "")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addTestUpdate(t, ds, "tbl", streamA, time.Now(), 1, 2)
+
+	waitFor(t, 5*time.Second, func() bool {
+		return len(consumer.GetEvents()) == 3
+	})
+
+	reader.StopAt(time.Now())
+	if err := <-errC; err != nil {
+		t.Fatal(err)
+	}
+
+	events := consumer.GetEvents()
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(events))
+	}
+	if _, ok := events[0].(Change); !ok {
+		t.Errorf("expected the first event to be a change, got %T", events[0])
+	}
+	if _, ok := events[2].(Change); !ok {
+		t.Errorf("expected the last event to be a change, got %T", events[2])
+	}
+
+	sc, ok := events[1].(SchemaChange)
+	if !ok {
+		t.Fatalf("expected a schema change to be reported before the change, got %T", events[1])
+	}
+	if sc.TableName != "ks.tbl" {
+		t.Errorf("expected the schema change to concern ks.tbl, got %s", sc.TableName)
+	}
+	if added := sc.AddedColumns(); len(added) != 1 || added[0].Name != "w" {
+		t.Errorf("expected column w to be added, got %v", added)
+	}
+	if dropped := sc.DroppedColumns(); len(dropped) != 1 || dropped[0].Name != "cdc$deleted_v" {
+		t.Errorf("expected column cdc$deleted_v to be dropped, got %v", dropped)
+	}
+}
+
+func TestSameColumnsIgnoresOrder(t *testing.T) {
+	intType := gocql.NewNativeType(4, gocql.TypeInt, "")
+	textType := gocql.NewNativeType(4, gocql.TypeText, "")
+
+	a := []gocql.ColumnInfo{{Name: "x", TypeInfo: intType}, {Name: "y", TypeInfo: textType}}
+	b := []gocql.ColumnInfo{{Name: "y", TypeInfo: textType}, {Name: "x", TypeInfo: intType}}
+	c := []gocql.ColumnInfo{{Name: "y", TypeInfo: intType}, {Name: "x", TypeInfo: intType}}
+
+	if !sameColumns(a, b) {
+		t.Error("expected columns in different order to be the same")
+	}
+	if sameColumns(a, c) {
+		t.Error("expected columns with a different type to differ")
+	}
+	if sameColumns(a, a[:1]) {
+		t.Error("expected columns with a dropped column to differ")
+	}
+}
@@ -18,11 +18,31 @@ type streamBatchReader struct {
 	lastTimestamp gocql.UUID
 	endTimestamp  atomic.Value
 
+	// If set, streams without saved progress start from this point
+	// instead of lastTimestamp
+	tableStartFrom gocql.UUID
+
 	consumers map[string]ChangeConsumer
 
+	// Trackers for consumers which implement AsyncChangeConsumer
+	ackTrackers  map[string]*ackTracker
+	asyncFailure *asyncFailure
+
+	pollController *pollController
+	rowFilter      *rowFilter
+
+	// If set, queries are not routed to the replicas of the streams
+	disableRouting bool
+
+	// Columns of the CDC log table seen in the most recently read row
+	columns []gocql.ColumnInfo
+
 	perStreamProgress map[string]gocql.UUID
 
 	interruptCh chan struct{}
+
+	// Closed after the reader finishes and all its consumers are ended
+	doneCh chan struct{}
 }
 
 func newStreamBatchReader(
@@ -32,6 +52,7 @@ func newStreamBatchReader(
 	keyspaceName string,
 	tableName string,
 	startFrom gocql.UUID,
+	tableStartFrom gocql.UUID,
 ) *streamBatchReader {
 	return &streamBatchReader{
 		config:         config,
@@ -40,21 +61,33 @@ func newStreamBatchReader(
 		keyspaceName:   keyspaceName,
 		tableName:      tableName,
 
-		lastTimestamp: startFrom,
+		lastTimestamp:  startFrom,
+		tableStartFrom: tableStartFrom,
 
 		consumers: make(map[string]ChangeConsumer),
 
+		ackTrackers:  make(map[string]*ackTracker),
+		asyncFailure: newAsyncFailure(),
+
+		pollController: newPollController(&config.Advanced),
+		rowFilter:      newRowFilter(config.RowFilter),
+
 		perStreamProgress: make(map[string]gocql.UUID, len(streams)),
 
 		interruptCh: make(chan struct{}, 1),
+		doneCh:      make(chan struct{}),
 	}
 }
 
 func (sbr *streamBatchReader) run(ctx context.Context) (err error) {
+	defer close(sbr.doneCh)
+
 	if err := sbr.loadProgressForStreams(ctx); err != nil {
 		return err
 	}
 
+	defer sbr.config.Metrics.StreamBatchFinished(sbr.getStreamBatchInfo())
+
 	defer func(err *error) {
 		for s, c := range sbr.consumers {
 			err2 := c.End()
@@ -64,6 +97,34 @@ func (sbr *streamBatchReader) run(ctx context.Context) (err error) {
 			if *err == nil {
 				*err = err2
 			}
+
+			// Changes acknowledged before End returned are included
+			// in the final progress
+			if tracker, ok := sbr.ackTrackers[s]; ok {
+				err2 := tracker.reporter.SaveAndStop(context.Background())
+				if err2 != nil {
+					sbr.config.Logger.Printf("error while saving final progress of stream %s (will quit): %s", StreamID(s), err2)
+				}
+				if *err == nil {
+					*err = err2
+				}
+			}
+		}
+		if withFlush, ok := sbr.config.ProgressManager.(ProgressManagerWithFlush); ok {
+			err2 := withFlush.Flush(context.Background())
+			if err2 != nil {
+				sbr.config.Logger.Printf("error while flushing progress of stream batch %v (will quit): %s", sbr.streams, err2)
+			}
+			if *err == nil {
+				*err = err2
+			}
+		}
+		if *err == nil {
+			select {
+			case <-sbr.asyncFailure.ch:
+				*err = sbr.asyncFailure.err
+			default:
+			}
 		}
 	}(&err)
 
@@ -82,44 +143,71 @@ func (sbr *streamBatchReader) run(ctx context.Context) (err error) {
 		consumer, err := sbr.config.ChangeConsumerFactory.CreateChangeConsumer(ctx, input)
 		if err != nil {
 			sbr.config.Logger.Printf("error while creating change consumer (will quit): %s", err)
+			return err
 		}
 
 		sbr.consumers[string(s)] = consumer
-	}
 
-	crq := newChangeRowQuerier(sbr.config.Session, sbr.streams, sbr.keyspaceName, sbr.tableName, sbr.config.Consistency)
+		if asyncConsumer, ok := consumer.(AsyncChangeConsumer); ok {
+			reporter := NewPeriodicProgressReporter(sbr.config.Logger, sbr.config.Advanced.AsyncProgressSaveInterval, input.ProgressReporter)
+			reporter.Start(ctx)
+			sbr.ackTrackers[string(s)] = newAckTracker(asyncConsumer, reporter, sbr.asyncFailure, sbr.config.Advanced.MaxInFlightChanges)
+		}
+	}
 
 	wnd := sbr.getPollWindow()
 
 outer:
 	for {
 		var err error
-		var hadRows bool
+		var rowCount, changeCount int
 
 		windowProcessingStartTime := time.Now()
+		queriedWindow := wnd
 
 		if compareTimeuuid(wnd.begin, wnd.end) < 0 {
-			var iter *changeRowIterator
-			iter, err = crq.queryRange(wnd.begin, wnd.end)
+			result := PollResult{
+				Lag: windowProcessingStartTime.Sub(wnd.begin.Time()),
+			}
+
+			var iter ChangeRowIterator
+			iter, err = sbr.config.DataSource.QueryRange(ctx, QueryRangeInput{
+				KeyspaceName: sbr.keyspaceName,
+				TableName:    sbr.tableName,
+				Streams:      sbr.streams,
+				Start:        wnd.begin,
+				End:          wnd.end,
+				Consistency:  sbr.config.Consistency,
+				Columns:      sbr.config.ColumnProjections[sbr.getBaseTableName()],
+
+				RoutingStream: sbr.getRoutingStream(),
+			})
 			if err != nil {
 				sbr.config.Logger.Printf("error while sending a query (will retry): %s", err)
 			} else {
-				rowCount, consumerErr := sbr.processRows(ctx, iter)
+				consumerErr := sbr.processRows(ctx, iter, &result)
 				if err = iter.Close(); err != nil {
 					sbr.config.Logger.Printf("error while querying (will retry): %s", err)
 				}
 				if consumerErr != nil {
 					return consumerErr
 				}
-				hadRows = rowCount > 0
+				rowCount = result.Rows
+				changeCount = result.Changes
 			}
 
+			result.Latency = time.Since(windowProcessingStartTime) - result.ConsumerTime
+			result.Err = err
+			sbr.config.Metrics.ObservePoll(sbr.getStreamBatchInfo(), result)
+
 			if err == nil {
 				// If there were no errors, then we can safely advance
 				// all streams to the window end
 				sbr.advanceAllStreamsTo(wnd.end)
 
-				if !hadRows {
+				// Rows which were filtered out or already processed
+				// don't count, so that the progress still advances
+				if changeCount == 0 {
 					for _, c := range sbr.consumers {
 						if enc, ok := c.(ChangeOrEmptyNotificationConsumer); ok {
 							err = enc.Empty(ctx, wnd.end)
@@ -129,16 +217,14 @@ outer:
 			}
 		}
 
-		wnd = sbr.getPollWindow()
+		delay := sbr.pollController.nextDelay(pollOutcome{
+			failed: err != nil,
+			rows:   rowCount,
+			behind: !queriedWindow.touchesConfidenceWindow,
+		})
 
-		var delay time.Duration
-		if err != nil {
-			delay = sbr.config.Advanced.PostFailedQueryDelay
-		} else if hadRows {
-			delay = sbr.config.Advanced.PostNonEmptyQueryDelay
-		} else {
-			delay = sbr.config.Advanced.PostEmptyQueryDelay
-		}
+		// The controller may have changed the size of the query window
+		wnd = sbr.getPollWindow()
 
 		delayUntil := windowProcessingStartTime.Add(delay)
 		if time.Until(delayUntil) < time.Duration(0) {
@@ -154,6 +240,8 @@ outer:
 			select {
 			case <-ctx.Done():
 				return ctx.Err()
+			case <-sbr.asyncFailure.ch:
+				return sbr.asyncFailure.err
 			case <-time.After(time.Until(delayUntil)):
 				break delay
 			case <-sbr.interruptCh:
@@ -175,7 +263,9 @@ func (sbr *streamBatchReader) loadProgressForStreams(ctx context.Context) error
 		if err != nil {
 			return err
 		}
-		if compareTimeuuid(sbr.lastTimestamp, progress.LastProcessedRecordTime) < 0 {
+		if progress.LastProcessedRecordTime == (gocql.UUID{}) && sbr.tableStartFrom != (gocql.UUID{}) {
+			sbr.perStreamProgress[string(stream)] = sbr.tableStartFrom
+		} else if compareTimeuuid(sbr.lastTimestamp, progress.LastProcessedRecordTime) < 0 {
 			sbr.config.Logger.Printf("loaded progress for stream %s: %s (%s)\n", stream, progress.LastProcessedRecordTime, progress.LastProcessedRecordTime.Time())
 			sbr.perStreamProgress[string(stream)] = progress.LastProcessedRecordTime
 		} else {
@@ -191,6 +281,9 @@ func (sbr *streamBatchReader) advanceAllStreamsTo(point gocql.UUID) {
 		if compareTimeuuid(sbr.perStreamProgress[id], point) < 0 {
 			sbr.perStreamProgress[id] = point
 		}
+		if tracker, ok := sbr.ackTrackers[id]; ok {
+			tracker.advanceTo(sbr.perStreamProgress[id])
+		}
 	}
 }
 
@@ -206,7 +299,7 @@ func (sbr *streamBatchReader) getPollWindow() pollWindow {
 	windowStart := sbr.getPollWindowStart()
 
 	// Right range end is the minimum of (left range + query window size, now - confidence window size)
-	queryWindowRightEnd := windowStart.Time().Add(sbr.config.Advanced.QueryTimeWindowSize)
+	queryWindowRightEnd := windowStart.Time().Add(sbr.pollController.queryWindowSize())
 	confidenceWindowStart := sbr.getConfidenceLimitPoint()
 	if queryWindowRightEnd.Before(confidenceWindowStart) {
 		return pollWindow{
@@ -240,41 +333,62 @@ func (sbr *streamBatchReader) getConfidenceLimitPoint() time.Time {
 	return time.Now().Add(-sbr.config.Advanced.ConfidenceWindowSize)
 }
 
-func (sbr *streamBatchReader) processRows(ctx context.Context, iter *changeRowIterator) (int, error) {
-	rowCount := 0
+// Consumes rows returned by the iterator, and records the number of rows
+// and changes and the time spent in consumers in the result.
+func (sbr *streamBatchReader) processRows(ctx context.Context, iter ChangeRowIterator, result *PollResult) error {
 	var change Change
 
 	for {
-		changeBatchCols, c := iter.Next()
+		c := iter.Next()
 		if c == nil {
 			break
 		}
-		if c.GetOperation() == PreImage {
+		if err := sbr.checkSchema(ctx, c.colInfos); err != nil {
+			return err
+		}
+		if op := c.GetOperation(); !sbr.rowFilter.accepts(op) {
+			// Rows which were filtered out are never assembled into the change
+		} else if op == PreImage {
 			change.PreImage = append(change.PreImage, c)
-		} else if c.GetOperation() == PostImage {
+		} else if op == PostImage {
 			change.PostImage = append(change.PostImage, c)
 		} else {
 			change.Delta = append(change.Delta, c)
 		}
 
-		rowCount++
+		result.Rows++
 
 		if c.cdcCols.endOfBatch {
 			// Since we are reading in batches and we started from the lowest progress mark
 			// of all streams in the batch, we might have to manually filter out changes
 			// from streams that had a save point later than the earliest progress mark
-			if compareTimeuuid(sbr.perStreamProgress[string(changeBatchCols.streamID)], changeBatchCols.time) < 0 {
-				change.StreamID = changeBatchCols.streamID
-				change.Time = changeBatchCols.time
-				consumer := sbr.consumers[string(changeBatchCols.streamID)]
-				if err := consumer.Consume(ctx, change); err != nil {
+			isEmpty := len(change.PreImage) == 0 && len(change.Delta) == 0 && len(change.PostImage) == 0
+			if isEmpty {
+				// All rows were filtered out, so there is nothing to deliver,
+				// but the stream can advance past the change
+				if compareTimeuuid(sbr.perStreamProgress[string(c.batchCols.streamID)], c.batchCols.time) < 0 {
+					sbr.perStreamProgress[string(c.batchCols.streamID)] = c.batchCols.time
+				}
+			} else if compareTimeuuid(sbr.perStreamProgress[string(c.batchCols.streamID)], c.batchCols.time) < 0 {
+				change.StreamID = c.batchCols.streamID
+				change.Time = c.batchCols.time
+				consumeStartTime := time.Now()
+				var err error
+				if tracker, ok := sbr.ackTrackers[string(c.batchCols.streamID)]; ok {
+					err = tracker.consume(ctx, change)
+				} else {
+					err = sbr.consumers[string(c.batchCols.streamID)].Consume(ctx, change)
+				}
+				result.ConsumerTime += time.Since(consumeStartTime)
+				if err != nil {
 					sbr.config.Logger.Printf("error while processing change (will quit): %s", err)
-					return 0, err
+					return err
 				}
+				result.Changes++
 
 				// It's important to save progress here. If fetching of a page fails,
 				// we will have to poll again, and filter out some rows.
-				sbr.perStreamProgress[string(changeBatchCols.streamID)] = changeBatchCols.time
+				sbr.perStreamProgress[string(c.batchCols.streamID)] = c.batchCols.time
 			}
 
 			change.PreImage = nil
@@ -283,13 +397,59 @@ func (sbr *streamBatchReader) processRows(ctx context.Context, iter *changeRowIt
 		}
 	}
 
-	return rowCount, nil
+	return nil
+}
+
+// Notifies consumers if the columns differ from the ones seen previously.
+func (sbr *streamBatchReader) checkSchema(ctx context.Context, columns []gocql.ColumnInfo) error {
+	if len(columns) > 0 && len(sbr.columns) > 0 && &columns[0] == &sbr.columns[0] {
+		// Rows returned by the same query share the columns
+		return nil
+	}
+
+	oldColumns := sbr.columns
+	sbr.columns = columns
+	if oldColumns == nil || sameColumns(oldColumns, columns) {
+		return nil
+	}
+
+	sbr.config.Logger.Printf("schema of the CDC log of table %s has changed", sbr.getBaseTableName())
+	for s, c := range sbr.consumers {
+		if scc, ok := c.(SchemaChangeConsumer); ok {
+			err := scc.SchemaChanged(ctx, SchemaChange{
+				TableName:  sbr.getBaseTableName(),
+				OldColumns: oldColumns,
+				NewColumns: columns,
+			})
+			if err != nil {
+				sbr.config.Logger.Printf("error while processing schema change for stream %s (will quit): %s", StreamID(s), err)
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (sbr *streamBatchReader) getStreamBatchInfo() StreamBatchInfo {
+	return StreamBatchInfo{
+		TableName:      sbr.getBaseTableName(),
+		GenerationTime: sbr.generationTime,
+		Streams:        sbr.streams,
+	}
 }
 
 func (sbr *streamBatchReader) getBaseTableName() string {
 	return sbr.keyspaceName + "." + sbr.tableName
 }
 
+// Streams are grouped by their replicas only if ReplicaLocator is set.
+func (sbr *streamBatchReader) getRoutingStream() StreamID {
+	if sbr.config.ReplicaLocator == nil || sbr.disableRouting {
+		return nil
+	}
+	return sbr.streams[0]
+}
+
 func (sbr *streamBatchReader) reachedEndOfTheGeneration(windowEnd gocql.UUID) bool {
 	end, isClosed := sbr.endTimestamp.Load().(gocql.UUID)
 	return isClosed && (end == gocql.UUID{} || compareTimeuuid(end, windowEnd) <= 0)
@@ -299,7 +459,12 @@ func (sbr *streamBatchReader) reachedEndOfTheGeneration(windowEnd gocql.UUID) bo
 
 func (sbr *streamBatchReader) close(processUntil gocql.UUID) {
 	sbr.endTimestamp.Store(processUntil)
-	sbr.interruptCh <- struct{}{}
+	// The reader may have been closed before, in which case an interrupt
+	// is already pending and is enough to notice the new end
+	select {
+	case sbr.interruptCh <- struct{}{}:
+	default:
+	}
 }
 
 func (sbr *streamBatchReader) stopNow() {
@@ -0,0 +1,343 @@
+package scyllacdc
+
+import (
+	"bytes"
+	"context"
+	"hash/fnv"
+	"sort"
+	"time"
+)
+
+// streamCoordinator acquires and renews leases of stream groups of
+// a generation, and runs stream batch readers for the groups whose leases
+// it holds. It finishes after all groups of the generation were read,
+// either by this Reader or by other ones, or when the Reader is stopping
+// and all of its stream batch readers have finished.
+type streamCoordinator struct {
+	r      *Reader
+	rg     *runningGeneration
+	config *StreamCoordinationConfig
+
+	owned map[string]*ownedStreamGroup
+
+	// Receives IDs of groups whose readers have finished
+	readerDoneCh chan string
+}
+
+type ownedStreamGroup struct {
+	tableName string
+	reader    *streamBatchReader
+
+	// Set if the reader was stopped before reaching the end
+	// of the generation, because the lease was lost or is being released
+	stopped bool
+
+	// Set if the lease was lost and must not be released
+	lost bool
+}
+
+func newStreamCoordinator(r *Reader, rg *runningGeneration) *streamCoordinator {
+	return &streamCoordinator{
+		r:      r,
+		rg:     rg,
+		config: r.config.Coordination,
+
+		owned: make(map[string]*ownedStreamGroup),
+
+		readerDoneCh: make(chan string),
+	}
+}
+
+func (sc *streamCoordinator) run(ctx context.Context) error {
+	ticker := time.NewTicker(sc.config.RenewInterval)
+	defer ticker.Stop()
+
+	for {
+		done, err := sc.coordinate(ctx)
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		case groupID := <-sc.readerDoneCh:
+			sc.handleReaderDone(ctx, groupID)
+		}
+
+		// Handle other readers which have finished in the meantime
+	drain:
+		for {
+			select {
+			case groupID := <-sc.readerDoneCh:
+				sc.handleReaderDone(ctx, groupID)
+			default:
+				break drain
+			}
+		}
+	}
+}
+
+// Performs a single round of coordination. Returns true if the coordinator
+// should finish.
+func (sc *streamCoordinator) coordinate(ctx context.Context) (bool, error) {
+	l := sc.r.config.Logger
+	store := sc.config.LeaseStore
+	gen := sc.rg.gen.startTime
+
+	sc.r.mu.Lock()
+	closing, finished := sc.rg.closing, sc.rg.finished
+	sc.r.mu.Unlock()
+
+	if closing && !finished {
+		// The Reader is stopping, wait until all readers finish
+		// and their leases are released
+		if len(sc.owned) > 0 {
+			return false, nil
+		}
+		if err := store.Leave(ctx, sc.config.OwnerID); err != nil {
+			l.Printf("failed to leave the group of readers: %s", err)
+		}
+		return true, nil
+	}
+
+	members, err := store.Heartbeat(ctx, sc.config.OwnerID, sc.config.LeaseTTL)
+	if err != nil {
+		l.Printf("failed to record heartbeat of the reader (will retry): %s", err)
+		return false, nil
+	}
+
+	for groupID, og := range sc.owned {
+		if og.stopped {
+			continue
+		}
+		renewed, err := store.Renew(ctx, gen, groupID, sc.config.OwnerID, sc.config.LeaseTTL)
+		if err != nil {
+			l.Printf("failed to renew lease of stream group %s (will retry): %s", groupID, err)
+			continue
+		}
+		if !renewed {
+			l.Printf("lease of stream group %s was lost, stopping its reader", groupID)
+			og.lost = true
+			sc.stopReader(og)
+		}
+	}
+
+	leases, err := store.ListLeases(ctx, gen)
+	if err != nil {
+		l.Printf("failed to list leases of generation %v (will retry): %s", gen, err)
+		return false, nil
+	}
+	leaseByGroup := make(map[string]StreamLease, len(leases))
+	for _, lease := range leases {
+		leaseByGroup[lease.GroupID] = lease
+	}
+
+	groups := sc.getGroups()
+	var free []string
+	unfinished := 0
+	for groupID := range groups {
+		lease := leaseByGroup[groupID]
+		if lease.Finished {
+			continue
+		}
+		unfinished++
+		if _, ok := sc.owned[groupID]; !ok && lease.Owner == "" {
+			free = append(free, groupID)
+		}
+	}
+
+	if unfinished == 0 && len(sc.owned) == 0 {
+		l.Printf("all stream groups of generation %v were read", gen)
+		return true, nil
+	}
+
+	memberCount := len(members)
+	if memberCount == 0 {
+		memberCount = 1
+	}
+	share := (unfinished + memberCount - 1) / memberCount
+
+	var active []string
+	for groupID, og := range sc.owned {
+		if !og.stopped {
+			active = append(active, groupID)
+		}
+	}
+
+	if len(active) > share {
+		if closing {
+			// The readers are about to reach the end of the generation,
+			// rebalancing would only make other Readers repeat their work
+			return false, nil
+		}
+		// Other readers have joined, give away the excess groups
+		sort.Strings(active)
+		for _, groupID := range active[share:] {
+			l.Printf("releasing stream group %s in order to rebalance", groupID)
+			sc.stopReader(sc.owned[groupID])
+		}
+		return false, nil
+	}
+
+	// Different readers try to acquire free groups starting from
+	// different positions, so that they don't compete for the same ones
+	sort.Strings(free)
+	if len(free) > 0 {
+		h := fnv.New32a()
+		h.Write([]byte(sc.config.OwnerID))
+		offset := int(h.Sum32() % uint32(len(free)))
+		free = append(free[offset:], free[:offset]...)
+	}
+
+	toAcquire := share - len(active)
+	for _, groupID := range free {
+		if toAcquire == 0 {
+			break
+		}
+		acquired, err := store.Acquire(ctx, gen, groupID, sc.config.OwnerID, sc.config.LeaseTTL)
+		if err != nil {
+			l.Printf("failed to acquire lease of stream group %s (will retry): %s", groupID, err)
+			continue
+		}
+		if !acquired {
+			continue
+		}
+		group := groups[groupID]
+		if !sc.startReader(groupID, group.tableName, group.streams) {
+			// The Reader is stopping
+			if err := store.Release(ctx, gen, groupID, sc.config.OwnerID, false); err != nil {
+				l.Printf("failed to release lease of stream group %s: %s", groupID, err)
+			}
+			break
+		}
+		l.Printf("acquired stream group %s", groupID)
+		toAcquire--
+	}
+
+	return false, nil
+}
+
+type coordinatedStreamGroup struct {
+	tableName string
+	streams   []StreamID
+}
+
+// Returns all groups of the generation for tables which are currently read,
+// indexed by group ID.
+func (sc *streamCoordinator) getGroups() map[string]coordinatedStreamGroup {
+	sc.r.mu.Lock()
+	defer sc.r.mu.Unlock()
+
+	groups := make(map[string]coordinatedStreamGroup)
+	for _, tableName := range sc.r.tableNames {
+		for _, streams := range sc.rg.split {
+			groups[streamGroupID(tableName, streams)] = coordinatedStreamGroup{
+				tableName: tableName,
+				streams:   streams,
+			}
+		}
+	}
+	return groups
+}
+
+// Starts a reader for the group. Returns false if the generation
+// is closing and no new readers can be started.
+func (sc *streamCoordinator) startReader(groupID string, tableName string, streams []StreamID) bool {
+	sc.r.mu.Lock()
+	defer sc.r.mu.Unlock()
+
+	rg := sc.rg
+	if rg.closing && !rg.finished {
+		return false
+	}
+
+	reader := sc.r.newReadersForTable(rg.ctx, rg, tableName, [][]StreamID{streams})[0]
+	rg.readers[tableName] = append(rg.readers[tableName], reader)
+	if rg.closing {
+		rg.closeReader(reader)
+	}
+	sc.owned[groupID] = &ownedStreamGroup{
+		tableName: tableName,
+		reader:    reader,
+	}
+
+	rg.errG.Go(func() error {
+		err := reader.run(rg.ctx)
+		select {
+		case sc.readerDoneCh <- groupID:
+		case <-rg.ctx.Done():
+		}
+		return err
+	})
+	return true
+}
+
+// Stops the reader of the group before it reaches the end of the generation.
+func (sc *streamCoordinator) stopReader(og *ownedStreamGroup) {
+	sc.r.mu.Lock()
+	defer sc.r.mu.Unlock()
+
+	if sc.rg.closing {
+		// The reader was already closed, and will finish on its own
+		return
+	}
+	og.stopped = true
+
+	tableReaders := sc.rg.readers[og.tableName]
+	for i, reader := range tableReaders {
+		if reader == og.reader {
+			sc.rg.readers[og.tableName] = append(tableReaders[:i:i], tableReaders[i+1:]...)
+			reader.stopNow()
+			break
+		}
+	}
+}
+
+func (sc *streamCoordinator) handleReaderDone(ctx context.Context, groupID string) {
+	l := sc.r.config.Logger
+
+	og, ok := sc.owned[groupID]
+	if !ok {
+		return
+	}
+	delete(sc.owned, groupID)
+
+	sc.r.mu.Lock()
+	// A group is finished only if its reader reached the end of the generation,
+	// and was not stopped because the table was removed
+	finished := sc.rg.finished && !og.stopped && sc.r.isTableRead(og.tableName)
+	tableReaders := sc.rg.readers[og.tableName]
+	for i, reader := range tableReaders {
+		if reader == og.reader {
+			sc.rg.readers[og.tableName] = append(tableReaders[:i:i], tableReaders[i+1:]...)
+			break
+		}
+	}
+	sc.r.mu.Unlock()
+
+	if og.lost {
+		return
+	}
+	err := sc.config.LeaseStore.Release(ctx, sc.rg.gen.startTime, groupID, sc.config.OwnerID, finished)
+	if err != nil {
+		// The lease will expire on its own
+		l.Printf("failed to release lease of stream group %s: %s", groupID, err)
+	}
+}
+
+// Returns an ID of a group of streams of a table, which is unique
+// within a generation.
+func streamGroupID(tableName string, streams []StreamID) string {
+	var first StreamID
+	for _, stream := range streams {
+		if first == nil || bytes.Compare(stream, first) < 0 {
+			first = stream
+		}
+	}
+	return tableName + "/" + first.String()
+}
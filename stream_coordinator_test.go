@@ -0,0 +1,237 @@
+package scyllacdc
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A StreamLeaseStore which keeps leases in memory.
+type testLeaseStore struct {
+	mu      sync.Mutex
+	members map[string]time.Time
+	leases  map[int64]map[string]*testLease
+}
+
+type testLease struct {
+	owner    string
+	expires  time.Time
+	finished bool
+}
+
+func newTestLeaseStore() *testLeaseStore {
+	return &testLeaseStore{
+		members: make(map[string]time.Time),
+		leases:  make(map[int64]map[string]*testLease),
+	}
+}
+
+func (tls *testLeaseStore) Heartbeat(ctx context.Context, owner string, ttl time.Duration) ([]string, error) {
+	tls.mu.Lock()
+	defer tls.mu.Unlock()
+	now := time.Now()
+	tls.members[owner] = now.Add(ttl)
+	var members []string
+	for member, expires := range tls.members {
+		if expires.After(now) {
+			members = append(members, member)
+		}
+	}
+	return members, nil
+}
+
+func (tls *testLeaseStore) Leave(ctx context.Context, owner string) error {
+	tls.mu.Lock()
+	defer tls.mu.Unlock()
+	delete(tls.members, owner)
+	return nil
+}
+
+// Must be called with the mutex held.
+func (tls *testLeaseStore) getLease(gen time.Time, groupID string) *testLease {
+	genLeases, ok := tls.leases[gen.UnixNano()]
+	if !ok {
+		genLeases = make(map[string]*testLease)
+		tls.leases[gen.UnixNano()] = genLeases
+	}
+	lease, ok := genLeases[groupID]
+	if !ok {
+		lease = &testLease{}
+		genLeases[groupID] = lease
+	}
+	if lease.owner != "" && !lease.expires.After(time.Now()) {
+		lease.owner = ""
+	}
+	return lease
+}
+
+func (tls *testLeaseStore) ListLeases(ctx context.Context, gen time.Time) ([]StreamLease, error) {
+	tls.mu.Lock()
+	defer tls.mu.Unlock()
+	var leases []StreamLease
+	for groupID := range tls.leases[gen.UnixNano()] {
+		lease := tls.getLease(gen, groupID)
+		if lease.owner != "" || lease.finished {
+			leases = append(leases, StreamLease{GroupID: groupID, Owner: lease.owner, Finished: lease.finished})
+		}
+	}
+	return leases, nil
+}
+
+func (tls *testLeaseStore) Acquire(ctx context.Context, gen time.Time, groupID string, owner string, ttl time.Duration) (bool, error) {
+	tls.mu.Lock()
+	defer tls.mu.Unlock()
+	lease := tls.getLease(gen, groupID)
+	if lease.owner != "" || lease.finished {
+		return false, nil
+	}
+	lease.owner = owner
+	lease.expires = time.Now().Add(ttl)
+	return true, nil
+}
+
+func (tls *testLeaseStore) Renew(ctx context.Context, gen time.Time, groupID string, owner string, ttl time.Duration) (bool, error) {
+	tls.mu.Lock()
+	defer tls.mu.Unlock()
+	lease := tls.getLease(gen, groupID)
+	if lease.owner != owner {
+		return false, nil
+	}
+	lease.expires = time.Now().Add(ttl)
+	return true, nil
+}
+
+func (tls *testLeaseStore) Release(ctx context.Context, gen time.Time, groupID string, owner string, finished bool) error {
+	tls.mu.Lock()
+	defer tls.mu.Unlock()
+	lease := tls.getLease(gen, groupID)
+	if lease.owner == owner {
+		lease.owner = ""
+		lease.finished = finished
+	}
+	return nil
+}
+
+func (tls *testLeaseStore) getOwnedCount(gen time.Time, owner string) int {
+	tls.mu.Lock()
+	defer tls.mu.Unlock()
+	count := 0
+	for groupID := range tls.leases[gen.UnixNano()] {
+		if tls.getLease(gen, groupID).owner == owner {
+			count++
+		}
+	}
+	return count
+}
+
+var _ StreamLeaseStore = (*testLeaseStore)(nil)
+
+func TestReadersShareStreamGroups(t *testing.T) {
+	now := time.Now()
+	gen1 := now.Add(-time.Hour)
+	gen2 := now.Add(-90 * time.Second)
+
+	// Streams of an unknown format are put into separate groups
+	streams1 := []StreamID{{0x01}, {0x02}, {0x03}, {0x04}}
+	streams2 := []StreamID{{0x11}, {0x12}, {0x13}, {0x14}}
+
+	ds := NewInMemoryDataSource()
+	ds.AddGeneration(gen1, streams1)
+	ds.AddGeneration(gen2, streams2)
+	newTestInMemoryTable(t, ds, "tbl")
+
+	// All changes of the first generation need to be read before
+	// any reader switches to the second one
+	for i, stream := range streams1 {
+		addTestUpdate(t, ds, "tbl", stream, gen2.Add(-time.Duration(i+1)*time.Second), i, 1)
+	}
+	for i, stream := range streams2 {
+		addTestUpdate(t, ds, "tbl", stream, gen2.Add(time.Duration(i+1)*time.Second), i, 2)
+	}
+
+	store := newTestLeaseStore()
+	progressManager := NewInMemoryProgressManager()
+	progressManager.SetCurrentGeneration(gen1)
+
+	startReader := func(ctx context.Context, owner string, consumer *collectingConsumer) (*Reader, chan error) {
+		cfg := &ReaderConfig{
+			DataSource:            ds,
+			ChangeConsumerFactory: consumer,
+			TableNames:            []string{"ks.tbl"},
+			ProgressManager:       progressManager,
+			Advanced:              testAdvancedConfig,
+			Coordination: &StreamCoordinationConfig{
+				LeaseStore:    store,
+				OwnerID:       owner,
+				LeaseTTL:      300 * time.Millisecond,
+				RenewInterval: 50 * time.Millisecond,
+			},
+		}
+		reader, err := NewReader(ctx, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		errC := make(chan error, 1)
+		go func() { errC <- reader.Run(ctx) }()
+		return reader, errC
+	}
+
+	consumed := func(consumers []*collectingConsumer, streams []StreamID) int {
+		count := 0
+		for _, consumer := range consumers {
+			for _, stream := range streams {
+				count += len(consumer.GetChanges(stream))
+			}
+		}
+		return count
+	}
+
+	consumer1 := newCollectingConsumer()
+	consumer2 := newCollectingConsumer()
+	reader1, errC1 := startReader(context.Background(), "reader1", consumer1)
+	crashCtx, crash := context.WithCancel(context.Background())
+	_, errC2 := startReader(crashCtx, "reader2", consumer2)
+
+	consumers := []*collectingConsumer{consumer1, consumer2}
+	waitFor(t, 5*time.Second, func() bool {
+		return consumed(consumers, streams1) >= len(streams1) && consumed(consumers, streams2) >= len(streams2)
+	})
+
+	// The groups of the current generation should be split evenly
+	waitFor(t, 5*time.Second, func() bool {
+		return store.getOwnedCount(gen2, "reader1") == 2 && store.getOwnedCount(gen2, "reader2") == 2
+	})
+
+	// After the second reader crashes, the first one should take over its groups
+	crash()
+	<-errC2
+
+	// The changes are slightly in the future, so that readers which
+	// have already caught up don't skip them
+	for i, stream := range streams2 {
+		addTestUpdate(t, ds, "tbl", stream, time.Now().Add(100*time.Millisecond), i, 3)
+	}
+	waitFor(t, 5*time.Second, func() bool {
+		count := 0
+		for _, stream := range streams2 {
+			for _, change := range consumer1.GetChanges(stream) {
+				if v, _ := change.Delta[0].GetValue("v"); *v.(*int) == 3 {
+					count++
+				}
+			}
+		}
+		return count == len(streams2)
+	})
+	if owned := store.getOwnedCount(gen2, "reader1"); owned != len(streams2) {
+		t.Errorf("expected the first reader to own all %d groups, got %d", len(streams2), owned)
+	}
+
+	reader1.StopAt(time.Now())
+	if err := <-errC1; err != nil {
+		t.Fatal(err)
+	}
+	if owned := store.getOwnedCount(gen2, "reader1"); owned != 0 {
+		t.Errorf("expected leases to be released after the reader stopped, got %d", owned)
+	}
+}
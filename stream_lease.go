@@ -0,0 +1,238 @@
+package scyllacdc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// StreamLeaseStore keeps track of Readers which share the work of reading
+// changes, and of leases which give them exclusive ownership of groups of
+// streams. It is used when ReaderConfig.Coordination is set.
+//
+// A group of streams is identified by an ID which is unique within
+// a generation. A lease of a group can be in one of three states: free,
+// owned by a Reader, or finished - which means that all changes of the group
+// in its generation were read, and the group must not be acquired again.
+//
+// Leases and memberships expire if they are not renewed, which allows other
+// Readers to take over the work of a Reader which crashed.
+//
+// All methods need to be safe to call concurrently, also by multiple
+// processes.
+type StreamLeaseStore interface {
+	// Heartbeat records that the Reader with given owner ID is alive for
+	// at least the given period of time, and returns IDs of all Readers
+	// which are alive, including the calling one.
+	Heartbeat(ctx context.Context, owner string, ttl time.Duration) ([]string, error)
+
+	// Leave removes the Reader with given owner ID from the list of Readers
+	// which are alive.
+	Leave(ctx context.Context, owner string) error
+
+	// ListLeases returns leases of groups of given generation which are
+	// either owned or finished. Groups which are not listed are free.
+	ListLeases(ctx context.Context, gen time.Time) ([]StreamLease, error)
+
+	// Acquire takes a lease of a free group for given period of time.
+	// It reports false if the group is owned or finished.
+	Acquire(ctx context.Context, gen time.Time, groupID string, owner string, ttl time.Duration) (bool, error)
+
+	// Renew extends a lease held by given owner. It reports false if
+	// the owner does not hold the lease anymore.
+	Renew(ctx context.Context, gen time.Time, groupID string, owner string, ttl time.Duration) (bool, error)
+
+	// Release gives up a lease held by given owner. If finished is true,
+	// the group is marked as finished, otherwise it becomes free.
+	Release(ctx context.Context, gen time.Time, groupID string, owner string, finished bool) error
+}
+
+// StreamLease describes the state of a lease of a group of streams.
+type StreamLease struct {
+	// ID of the group of streams.
+	GroupID string
+
+	// ID of the Reader which holds the lease, or empty if the lease
+	// is not held.
+	Owner string
+
+	// Whether all changes of the group were read.
+	Finished bool
+}
+
+// TableBackedStreamLeaseStore is a StreamLeaseStore which keeps leases
+// in a Scylla table, and uses lightweight transactions to modify them.
+//
+// The schema is as follows:
+//
+//	CREATE TABLE IF NOT EXISTS <table name> (
+//	    application_name text,
+//	    generation timestamp,
+//	    group_id text,
+//	    owner text,
+//	    finished boolean,
+//	    PRIMARY KEY ((application_name, generation), group_id)
+//	)
+//
+// Leases of groups of a generation are kept in a single partition. Readers
+// which are alive are recorded in a partition with the generation set
+// to the Unix epoch, with group_id set to the owner ID.
+//
+// Owned leases and memberships expire using TTL. Finished leases are kept
+// for a week.
+type TableBackedStreamLeaseStore struct {
+	session         *gocql.Session
+	leaseTableName  string
+	applicationName string
+
+	finishedTTL int32
+}
+
+var streamLeaseMembersGeneration = time.Unix(0, 0)
+
+// NewTableBackedStreamLeaseStore creates a new TableBackedStreamLeaseStore.
+// Readers which should share the work need to use the same table and
+// application name.
+func NewTableBackedStreamLeaseStore(session *gocql.Session, leaseTableName string, applicationName string) (*TableBackedStreamLeaseStore, error) {
+	tbsls := &TableBackedStreamLeaseStore{
+		session:         session,
+		leaseTableName:  leaseTableName,
+		applicationName: applicationName,
+
+		finishedTTL: 7 * 24 * 60 * 60, // 1 week
+	}
+
+	if err := tbsls.ensureTableExists(); err != nil {
+		return nil, err
+	}
+	return tbsls, nil
+}
+
+func (tbsls *TableBackedStreamLeaseStore) ensureTableExists() error {
+	return tbsls.session.Query(
+		fmt.Sprintf(
+			"CREATE TABLE IF NOT EXISTS %s "+
+				"(application_name text, generation timestamp, group_id text, owner text, finished boolean, "+
+				"PRIMARY KEY ((application_name, generation), group_id))",
+			tbsls.leaseTableName,
+		),
+	).Exec()
+}
+
+// Heartbeat is needed to implement the StreamLeaseStore interface.
+func (tbsls *TableBackedStreamLeaseStore) Heartbeat(ctx context.Context, owner string, ttl time.Duration) ([]string, error) {
+	err := tbsls.session.Query(
+		fmt.Sprintf("UPDATE %s USING TTL ? SET owner = ? WHERE application_name = ? AND generation = ? AND group_id = ?", tbsls.leaseTableName),
+		ttlSeconds(ttl), owner, tbsls.applicationName, streamLeaseMembersGeneration, owner,
+	).WithContext(ctx).Exec()
+	if err != nil {
+		return nil, err
+	}
+
+	iter := tbsls.session.Query(
+		fmt.Sprintf("SELECT owner FROM %s WHERE application_name = ? AND generation = ?", tbsls.leaseTableName),
+		tbsls.applicationName, streamLeaseMembersGeneration,
+	).WithContext(ctx).Iter()
+
+	var (
+		members []string
+		member  string
+	)
+	for iter.Scan(&member) {
+		if member != "" {
+			members = append(members, member)
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// Leave is needed to implement the StreamLeaseStore interface.
+func (tbsls *TableBackedStreamLeaseStore) Leave(ctx context.Context, owner string) error {
+	return tbsls.session.Query(
+		fmt.Sprintf("DELETE FROM %s WHERE application_name = ? AND generation = ? AND group_id = ?", tbsls.leaseTableName),
+		tbsls.applicationName, streamLeaseMembersGeneration, owner,
+	).WithContext(ctx).Exec()
+}
+
+// ListLeases is needed to implement the StreamLeaseStore interface.
+func (tbsls *TableBackedStreamLeaseStore) ListLeases(ctx context.Context, gen time.Time) ([]StreamLease, error) {
+	iter := tbsls.session.Query(
+		fmt.Sprintf("SELECT group_id, owner, finished FROM %s WHERE application_name = ? AND generation = ?", tbsls.leaseTableName),
+		tbsls.applicationName, gen,
+	).WithContext(ctx).Consistency(gocql.Serial).Iter()
+
+	var (
+		leases []StreamLease
+		lease  StreamLease
+	)
+	for iter.Scan(&lease.GroupID, &lease.Owner, &lease.Finished) {
+		leases = append(leases, lease)
+		lease = StreamLease{}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return leases, nil
+}
+
+// Acquire is needed to implement the StreamLeaseStore interface.
+func (tbsls *TableBackedStreamLeaseStore) Acquire(ctx context.Context, gen time.Time, groupID string, owner string, ttl time.Duration) (bool, error) {
+	// The row of a free group does not exist: finished groups have
+	// the finished column set, and owned groups have the owner column set
+	return tbsls.session.Query(
+		fmt.Sprintf(
+			"INSERT INTO %s (application_name, generation, group_id, owner) VALUES (?, ?, ?, ?) "+
+				"IF NOT EXISTS USING TTL ?",
+			tbsls.leaseTableName,
+		),
+		tbsls.applicationName, gen, groupID, owner, ttlSeconds(ttl),
+	).WithContext(ctx).MapScanCAS(make(map[string]interface{}))
+}
+
+// Renew is needed to implement the StreamLeaseStore interface.
+func (tbsls *TableBackedStreamLeaseStore) Renew(ctx context.Context, gen time.Time, groupID string, owner string, ttl time.Duration) (bool, error) {
+	return tbsls.session.Query(
+		fmt.Sprintf(
+			"UPDATE %s USING TTL ? SET owner = ? WHERE application_name = ? AND generation = ? AND group_id = ? IF owner = ?",
+			tbsls.leaseTableName,
+		),
+		ttlSeconds(ttl), owner, tbsls.applicationName, gen, groupID, owner,
+	).WithContext(ctx).MapScanCAS(make(map[string]interface{}))
+}
+
+// Release is needed to implement the StreamLeaseStore interface.
+func (tbsls *TableBackedStreamLeaseStore) Release(ctx context.Context, gen time.Time, groupID string, owner string, finished bool) error {
+	var q *gocql.Query
+	if finished {
+		q = tbsls.session.Query(
+			fmt.Sprintf(
+				"UPDATE %s USING TTL ? SET owner = null, finished = true WHERE application_name = ? AND generation = ? AND group_id = ? IF owner = ?",
+				tbsls.leaseTableName,
+			),
+			tbsls.finishedTTL, tbsls.applicationName, gen, groupID, owner,
+		)
+	} else {
+		q = tbsls.session.Query(
+			fmt.Sprintf("DELETE FROM %s WHERE application_name = ? AND generation = ? AND group_id = ? IF owner = ?", tbsls.leaseTableName),
+			tbsls.applicationName, gen, groupID, owner,
+		)
+	}
+	// If the lease is not held anymore, there is nothing to release
+	_, err := q.WithContext(ctx).MapScanCAS(make(map[string]interface{}))
+	return err
+}
+
+func ttlSeconds(ttl time.Duration) int32 {
+	seconds := int32((ttl + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
+
+var _ StreamLeaseStore = (*TableBackedStreamLeaseStore)(nil)
@@ -0,0 +1,274 @@
+package scyllacdc
+
+import (
+	"context"
+	"time"
+
+	"github.com/gocql/gocql"
+	"golang.org/x/sync/errgroup"
+)
+
+// Lists generations of a single table which has its own generations.
+type tableGenerationLister struct {
+	dataSource   DataSourceWithTableGenerations
+	keyspaceName string
+	tableName    string
+}
+
+func (tgl *tableGenerationLister) GetGenerationTimes(ctx context.Context) ([]time.Time, error) {
+	return tgl.dataSource.GetTableGenerationTimes(ctx, tgl.keyspaceName, tgl.tableName)
+}
+
+func (tgl *tableGenerationLister) GetGenerationStreams(ctx context.Context, genTime time.Time) ([]StreamID, error) {
+	return tgl.dataSource.GetTableGenerationStreams(ctx, tgl.keyspaceName, tgl.tableName, genTime)
+}
+
+// Reads a table which has its own generations, e.g. a table of a tablet-based
+// keyspace. The table switches generations independently of the cluster-wide
+// generations and of other tables.
+type tableGenerationLoop struct {
+	tableName  string
+	genFetcher *generationFetcher
+
+	// Closed when the table is removed from the Reader
+	removedCh chan struct{}
+
+	// Closed after the loop finishes, if it was started
+	doneCh chan struct{}
+
+	// Protected by the mutex of the Reader
+	started    bool
+	readFrom   time.Time
+	currentGen *runningGeneration
+}
+
+// Returns true if given table has its own generations, i.e. it must be read
+// by a tableGenerationLoop instead of following the cluster-wide generations.
+func (r *Reader) hasTableGenerations(ctx context.Context, tableName string) (bool, error) {
+	withTableGens, ok := r.config.DataSource.(DataSourceWithTableGenerations)
+	if !ok {
+		return false, nil
+	}
+
+	// The name was validated before
+	keyspaceName, baseTableName, _ := splitTableName(tableName)
+	return withTableGens.HasTableGenerations(ctx, keyspaceName, baseTableName)
+}
+
+// Creates a loop for the table which has its own generations. The loop starts
+// from the generation saved by the ProgressManager, if it was saved.
+func (r *Reader) newTableGenerationLoop(ctx context.Context, tableName string) (*tableGenerationLoop, error) {
+	readFrom := r.applicationReadFrom
+	if withTableGen, ok := r.config.ProgressManager.(ProgressManagerWithTableGeneration); ok {
+		savedGen, err := withTableGen.GetTableGeneration(ctx, tableName)
+		if err != nil {
+			return nil, err
+		}
+		if !savedGen.IsZero() {
+			r.config.Logger.Printf("last saved progress of table %s was at its generation %v", tableName, savedGen)
+			readFrom = savedGen
+		}
+	}
+
+	keyspaceName, baseTableName, _ := splitTableName(tableName)
+	lister := &tableGenerationLister{
+		dataSource:   r.config.DataSource.(DataSourceWithTableGenerations),
+		keyspaceName: keyspaceName,
+		tableName:    baseTableName,
+	}
+
+	return &tableGenerationLoop{
+		tableName:  tableName,
+		genFetcher: newGenerationFetcher(lister, readFrom, r.config.Advanced.GenerationFetchPeriod, r.config.Logger),
+		removedCh:  make(chan struct{}),
+		doneCh:     make(chan struct{}),
+		readFrom:   readFrom,
+	}, nil
+}
+
+// Starts the loop in the errgroup of Run. Must be called with the mutex held,
+// after Run has started.
+func (r *Reader) startTableGenerationLoop(tl *tableGenerationLoop) {
+	tl.started = true
+	r.runErrG.Go(func() error {
+		defer close(tl.doneCh)
+		return r.runTableGenerations(r.runCtx, tl)
+	})
+}
+
+func (r *Reader) runTableGenerations(ctx context.Context, tl *tableGenerationLoop) error {
+	l := r.config.Logger
+
+	errG, loopCtx := errgroup.WithContext(ctx)
+
+	errG.Go(func() error {
+		select {
+		case <-loopCtx.Done():
+			return loopCtx.Err()
+		case <-r.stoppedCh:
+		case <-tl.removedCh:
+		}
+		tl.genFetcher.Stop()
+		return nil
+	})
+	errG.Go(func() error {
+		return tl.genFetcher.Run(loopCtx)
+	})
+	errG.Go(func() error {
+		observer := r.observer
+
+		gen, err := tl.genFetcher.Get(loopCtx)
+		if gen == nil {
+			return err
+		}
+		err = observer.GenerationDiscovered(loopCtx, GenerationInfo{
+			StartTime:   gen.startTime,
+			TableName:   tl.tableName,
+			StreamCount: len(gen.streams),
+		})
+		if err != nil {
+			return err
+		}
+
+		for {
+			r.mu.Lock()
+			if tl.readFrom.Before(gen.startTime) {
+				tl.readFrom = gen.startTime
+			}
+			readFrom := tl.readFrom
+			r.mu.Unlock()
+
+			l.Printf("starting reading generation %v of table %s from timestamp %v", gen.startTime, tl.tableName, readFrom)
+
+			if withTableGen, ok := r.config.ProgressManager.(ProgressManagerWithTableGeneration); ok {
+				if err := withTableGen.StartTableGeneration(loopCtx, tl.tableName, gen.startTime); err != nil {
+					return err
+				}
+			}
+
+			// Streams of such tables don't follow the token ring used
+			// by ReplicaLocator, so they are always grouped by vnodes
+			split := r.splitStreamsByVnodes(gen.streams)
+			l.Printf("grouped %d streams of table %s into %d batches", len(gen.streams), tl.tableName, len(split))
+
+			if r.config.ShardCount > 0 {
+				split = r.filterShardStreamGroups(split)
+				l.Printf("%d batches of table %s are assigned to shard %d of %d", len(split), tl.tableName, r.config.ShardIndex, r.config.ShardCount)
+			}
+
+			genInfo := GenerationInfo{
+				StartTime:   gen.startTime,
+				TableName:   tl.tableName,
+				StreamCount: len(gen.streams),
+				GroupCount:  len(split),
+			}
+			if err := observer.GenerationStarted(loopCtx, genInfo); err != nil {
+				return err
+			}
+
+			genErrG, genCtx := errgroup.WithContext(loopCtx)
+
+			r.mu.Lock()
+			rg := &runningGeneration{
+				gen:             gen,
+				split:           split,
+				errG:            genErrG,
+				ctx:             genCtx,
+				readFrom:        readFrom,
+				readers:         make(map[string][]*streamBatchReader),
+				tableGeneration: true,
+			}
+			tl.currentGen = rg
+			readers := r.newReadersForTable(genCtx, rg, tl.tableName, split)
+			rg.readers[tl.tableName] = readers
+			r.mu.Unlock()
+
+			for i := range readers {
+				reader := readers[i]
+				genErrG.Go(func() error {
+					return reader.run(genCtx)
+				})
+			}
+
+			var nextGen *generation
+			genErrG.Go(func() error {
+				var err error
+				nextGen, err = tl.genFetcher.Get(genCtx)
+				if err != nil {
+					return err
+				}
+				if nextGen != nil {
+					err = observer.GenerationDiscovered(genCtx, GenerationInfo{
+						StartTime:   nextGen.startTime,
+						TableName:   tl.tableName,
+						StreamCount: len(nextGen.streams),
+					})
+					if err != nil {
+						return err
+					}
+				}
+
+				r.mu.Lock()
+				defer r.mu.Unlock()
+				rg.closing = true
+				// Stays empty if the table was removed
+				rg.tableCloseTimes = make(map[string]time.Time, 1)
+				if nextGen != nil {
+					rg.finished = true
+					rg.closeAt = gocql.MinTimeUUID(nextGen.startTime)
+					tl.readFrom = nextGen.startTime
+					rg.tableCloseTimes[tl.tableName] = nextGen.startTime
+				} else if !isClosed(tl.removedCh) {
+					// The reader was stopped
+					stopAt, _ := r.stopTime.Load().(time.Time)
+					if !stopAt.IsZero() {
+						rg.closeAt = gocql.MaxTimeUUID(stopAt)
+					}
+					rg.tableCloseTimes[tl.tableName] = stopAt
+				}
+				for _, reader := range rg.readers[tl.tableName] {
+					rg.closeReader(reader)
+				}
+				return nil
+			})
+
+			err := genErrG.Wait()
+
+			r.mu.Lock()
+			tl.currentGen = nil
+			r.mu.Unlock()
+
+			if err != nil {
+				return err
+			}
+			l.Printf("stopped reading from generation %v of table %s", gen.startTime, tl.tableName)
+
+			drainInfo := GenerationDrainInfo{
+				GenerationInfo:  genInfo,
+				TableCloseTimes: rg.tableCloseTimes,
+			}
+			if nextGen != nil {
+				drainInfo.NextStartTime = nextGen.startTime
+			}
+			if err := observer.GenerationDrained(ctx, drainInfo); err != nil {
+				return err
+			}
+
+			if nextGen == nil {
+				return nil
+			}
+			gen = nextGen
+		}
+	})
+
+	return errG.Wait()
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,244 @@
+package scyllacdc
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+func TestReaderReadsTablesWithOwnGenerations(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	streamA := StreamID{0x0A}
+	streamX := StreamID{0x1A}
+	streamY := StreamID{0x1B}
+	tabletGen1 := now.Add(-time.Hour)
+	tabletGen2 := now.Add(-30 * time.Second)
+
+	ds := NewInMemoryDataSource()
+	ds.AddGeneration(now.Add(-time.Hour), []StreamID{streamA})
+	ds.AddTableGeneration("ks", "tablets", tabletGen1, []StreamID{streamX})
+	ds.AddTableGeneration("ks", "tablets", tabletGen2, []StreamID{streamY})
+	newTestInMemoryTable(t, ds, "tbl")
+	newTestInMemoryTable(t, ds, "tablets")
+
+	expectedA := addTestUpdate(t, ds, "tbl", streamA, now.Add(-80*time.Second), 1, 1)
+	expectedX := addTestUpdate(t, ds, "tablets", streamX, now.Add(-90*time.Second), 2, 1)
+	expectedY := addTestUpdate(t, ds, "tablets", streamY, now.Add(-20*time.Second), 3, 1)
+
+	consumer := newCollectingConsumer()
+	progressManager := NewInMemoryProgressManager()
+	observer := &recordingGenerationObserver{}
+	cfg := &ReaderConfig{
+		DataSource:            ds,
+		ChangeConsumerFactory: consumer,
+		ProgressManager:       progressManager,
+		GenerationObserver:    observer,
+		TableNames:            []string{"ks.tbl", "ks.tablets"},
+		Advanced:              testAdvancedConfig,
+	}
+
+	reader, err := NewReader(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errC := make(chan error)
+	go func() { errC <- reader.Run(ctx) }()
+
+	waitFor(t, 5*time.Second, func() bool {
+		return len(consumer.GetChanges(streamY)) == 1 && len(consumer.GetChanges(streamA)) == 1
+	})
+
+	reader.StopAt(time.Now())
+	if err := <-errC; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		streamID StreamID
+		expected gocql.UUID
+	}{
+		{streamA, expectedA},
+		{streamX, expectedX},
+		{streamY, expectedY},
+	} {
+		changes := consumer.GetChanges(tc.streamID)
+		if len(changes) != 1 || changes[0].Time != tc.expected {
+			t.Errorf("expected one change with time %s in stream %s, got %v", tc.expected, tc.streamID, changes)
+		}
+	}
+
+	if gen, _ := progressManager.GetTableGeneration(ctx, "ks.tablets"); !gen.Equal(tabletGen2) {
+		t.Errorf("expected generation %v of the table to be saved, got %v", tabletGen2, gen)
+	}
+	if gen, _ := progressManager.GetTableGeneration(ctx, "ks.tbl"); !gen.IsZero() {
+		t.Errorf("expected no generation of a table which uses cluster-wide generations, got %v", gen)
+	}
+
+	// Generations of the table are reported along with the cluster-wide one
+	var started []string
+	for _, event := range observer.events {
+		if strings.HasPrefix(event, "started") {
+			started = append(started, event)
+		}
+	}
+	sort.Strings(started)
+	expectedStarted := []string{
+		fmt.Sprintf("started %d 1/1", now.Add(-time.Hour).Unix()),
+		fmt.Sprintf("started %d 1/1 ks.tablets", tabletGen1.Unix()),
+		fmt.Sprintf("started %d 1/1 ks.tablets", tabletGen2.Unix()),
+	}
+	sort.Strings(expectedStarted)
+	if fmt.Sprint(started) != fmt.Sprint(expectedStarted) {
+		t.Errorf("expected events %v, got %v", expectedStarted, started)
+	}
+
+	drained := false
+	for _, drain := range observer.drains {
+		if drain.TableName != "ks.tablets" || !drain.StartTime.Equal(tabletGen1) {
+			continue
+		}
+		drained = true
+		if !drain.NextStartTime.Equal(tabletGen2) || !drain.TableCloseTimes["ks.tablets"].Equal(tabletGen2) {
+			t.Errorf("expected the first generation of the table to be closed at %v, got %v and %v", tabletGen2, drain.NextStartTime, drain.TableCloseTimes)
+		}
+	}
+	if !drained {
+		t.Error("expected the first generation of the table to be drained")
+	}
+}
+
+func TestReaderResumesTableFromSavedGeneration(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	streamX := StreamID{0x1A}
+	streamY := StreamID{0x1B}
+	tabletGen2 := now.Add(-30 * time.Second)
+
+	ds := NewInMemoryDataSource()
+	ds.AddTableGeneration("ks", "tablets", now.Add(-time.Hour), []StreamID{streamX})
+	ds.AddTableGeneration("ks", "tablets", tabletGen2, []StreamID{streamY})
+	newTestInMemoryTable(t, ds, "tablets")
+
+	// The previous generation was already read
+	addTestUpdate(t, ds, "tablets", streamX, now.Add(-90*time.Second), 1, 1)
+	expectedY := addTestUpdate(t, ds, "tablets", streamY, now.Add(-20*time.Second), 2, 1)
+
+	progressManager := NewInMemoryProgressManager()
+	if err := progressManager.StartTableGeneration(ctx, "ks.tablets", tabletGen2); err != nil {
+		t.Fatal(err)
+	}
+
+	consumer := newCollectingConsumer()
+	cfg := &ReaderConfig{
+		DataSource:            ds,
+		ChangeConsumerFactory: consumer,
+		ProgressManager:       progressManager,
+		TableNames:            []string{"ks.tablets"},
+		Advanced:              testAdvancedConfig,
+	}
+
+	reader, err := NewReader(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errC := make(chan error)
+	go func() { errC <- reader.Run(ctx) }()
+
+	waitFor(t, 5*time.Second, func() bool {
+		return len(consumer.GetChanges(streamY)) == 1
+	})
+
+	reader.StopAt(time.Now())
+	if err := <-errC; err != nil {
+		t.Fatal(err)
+	}
+
+	if changes := consumer.GetChanges(streamX); len(changes) != 0 {
+		t.Errorf("expected no changes from the previous generation, got %d", len(changes))
+	}
+	if changes := consumer.GetChanges(streamY); changes[0].Time != expectedY {
+		t.Errorf("expected change with time %s, got %s", expectedY, changes[0].Time)
+	}
+}
+
+func TestReaderAddsAndRemovesTableWithOwnGenerations(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	streamA := StreamID{0x0A}
+	streamX := StreamID{0x1A}
+
+	ds := NewInMemoryDataSource()
+	ds.AddGeneration(now.Add(-time.Hour), []StreamID{streamA})
+	ds.AddTableGeneration("ks", "tablets", now.Add(-time.Hour), []StreamID{streamX})
+	newTestInMemoryTable(t, ds, "tbl")
+	newTestInMemoryTable(t, ds, "tablets")
+
+	addTestUpdate(t, ds, "tablets", streamX, now.Add(-20*time.Second), 1, 1)
+
+	consumer := newCollectingConsumer()
+	cfg := &ReaderConfig{
+		DataSource:            ds,
+		ChangeConsumerFactory: consumer,
+		TableNames:            []string{"ks.tbl"},
+		Advanced:              testAdvancedConfig,
+	}
+
+	reader, err := NewReader(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errC := make(chan error)
+	go func() { errC <- reader.Run(ctx) }()
+
+	if err := reader.AddTable(ctx, "ks.tablets"); err != nil {
+		t.Fatal(err)
+	}
+	if err := reader.AddTable(ctx, "ks.tablets"); err == nil {
+		t.Error("expected an error when adding the same table twice")
+	}
+
+	waitFor(t, 5*time.Second, func() bool {
+		return len(consumer.GetChanges(streamX)) == 1
+	})
+
+	if err := reader.RemoveTable(ctx, "ks.tablets"); err != nil {
+		t.Fatal(err)
+	}
+	endedAfterRemoval := consumer.GetEndedCount()
+	if endedAfterRemoval != 1 {
+		t.Errorf("expected the consumer of the removed table to be ended, got %d ended consumers", endedAfterRemoval)
+	}
+
+	reader.Stop()
+	if err := <-errC; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReaderRejectsCoordinationOfTablesWithOwnGenerations(t *testing.T) {
+	ds := NewInMemoryDataSource()
+	ds.AddTableGeneration("ks", "tablets", time.Now().Add(-time.Hour), []StreamID{{0x1A}})
+	newTestInMemoryTable(t, ds, "tablets")
+
+	cfg := &ReaderConfig{
+		DataSource:            ds,
+		ChangeConsumerFactory: newCollectingConsumer(),
+		TableNames:            []string{"ks.tablets"},
+		Advanced:              testAdvancedConfig,
+		Coordination: &StreamCoordinationConfig{
+			LeaseStore: newTestLeaseStore(),
+		},
+	}
+	if _, err := NewReader(context.Background(), cfg); err == nil {
+		t.Error("expected an error when coordinating a table with its own generations")
+	}
+}
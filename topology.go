@@ -23,10 +23,21 @@ const (
 	timestampsTableSince4_4 = "system_distributed.cdc_generation_timestamps"
 	streamsTableSince4_4    = "system_distributed.cdc_streams_descriptions_v2"
 
-	// TODO: Switch to a model which reacts to cluster state changes
-	// and forces a refresh when all worker goroutines did not report any
-	// changes for some time
-	generationFetchPeriod time.Duration = 15 * time.Second
+	// Tables of tablet-based keyspaces have their own generations
+	tabletTimestampsTable = "system.cdc_timestamps"
+	tabletStreamsTable    = "system.cdc_streams"
+	scyllaKeyspacesTable  = "system_schema.scylla_keyspaces"
+
+	// Rows of tabletStreamsTable with this state list all streams
+	// of a generation. Other states describe streams which were closed
+	// or opened, compared to the previous generation.
+	tabletStreamStateCurrent = 0
+
+	// After a new generation is found or a refresh is triggered,
+	// generations are fetched with this period. The period is doubled
+	// after each fetch which didn't find anything new, up to
+	// AdvancedReaderConfig.GenerationFetchPeriod.
+	minGenerationFetchPeriod time.Duration = 1 * time.Second
 )
 
 type generation struct {
@@ -56,42 +67,42 @@ func (tl timeList) Swap(i, j int) {
 	tl[i], tl[j] = tl[j], tl[i]
 }
 
+// The part of DataSource used by generationFetcher. It lists either
+// the cluster-wide generations, or the generations of a single table.
+type generationLister interface {
+	GetGenerationTimes(ctx context.Context) ([]time.Time, error)
+	GetGenerationStreams(ctx context.Context, genTime time.Time) ([]StreamID, error)
+}
+
 type generationFetcher struct {
-	session  *gocql.Session
-	lastTime time.Time
-	logger   Logger
+	dataSource  generationLister
+	lastTime    time.Time
+	fetchPeriod time.Duration
+	logger      Logger
 
 	pushedFirst bool
 
 	generationCh chan *generation
 	refreshCh    chan struct{}
 	stopCh       chan struct{}
-
-	source generationSource
 }
 
 func newGenerationFetcher(
-	session *gocql.Session,
+	dataSource generationLister,
 	startFrom time.Time,
+	fetchPeriod time.Duration,
 	logger Logger,
-) (*generationFetcher, error) {
-	source, err := chooseGenerationSource(session, logger)
-	if err != nil {
-		return nil, fmt.Errorf("failed to detect version of the generation tables used by the cluster: %v", err)
-	}
-
-	gf := &generationFetcher{
-		session:  session,
-		lastTime: startFrom,
-		logger:   logger,
+) *generationFetcher {
+	return &generationFetcher{
+		dataSource:  dataSource,
+		lastTime:    startFrom,
+		fetchPeriod: fetchPeriod,
+		logger:      logger,
 
 		generationCh: make(chan *generation, 1),
 		stopCh:       make(chan struct{}),
 		refreshCh:    make(chan struct{}, 1),
-
-		source: source,
 	}
-	return gf, nil
 }
 
 func chooseGenerationSource(session *gocql.Session, logger Logger) (generationSource, error) {
@@ -105,6 +116,16 @@ func chooseGenerationSource(session *gocql.Session, logger Logger) (generationSo
 	}
 
 	if !hasPost4_4 && !hasPre4_4 {
+		hasTablets, err := isTableInSchema(session, tabletTimestampsTable)
+		if err != nil {
+			return nil, err
+		}
+		if hasTablets {
+			// Only tables of tablet-based keyspaces can have CDC enabled,
+			// and they have their own generations
+			return noGenerationSource{}, nil
+		}
+
 		// There are no tables we know how to use - return an error
 		return nil, ErrNoSupportedGenerationTablesPresent
 	}
@@ -135,13 +156,30 @@ func (gf *generationFetcher) Run(ctx context.Context) error {
 
 	l.Printf("starting generation fetcher loop")
 
+	minPeriod := minGenerationFetchPeriod
+	if minPeriod > gf.fetchPeriod {
+		minPeriod = gf.fetchPeriod
+	}
+	period := minPeriod
+	refreshed := false
+
 outer:
 	for {
 		// Generation processing can take some time, so start calculating
 		// the next poll time starting from now
-		waitC := time.After(generationFetchPeriod)
+		fetchStart := time.Now()
+
+		// A new generation may appear soon after a change of the topology,
+		// so poll often for some time after a generation was found
+		// or a refresh was triggered, and back off otherwise
+		if found := gf.tryFetchGenerations(ctx); found || refreshed {
+			period = minPeriod
+		} else if period *= 2; period > gf.fetchPeriod {
+			period = gf.fetchPeriod
+		}
+		refreshed = false
 
-		gf.tryFetchGenerations()
+		waitC := time.After(time.Until(fetchStart.Add(period)))
 
 		select {
 		// Give priority to the stop channel and the context
@@ -157,6 +195,7 @@ outer:
 				return ctx.Err()
 			case <-waitC:
 			case <-gf.refreshCh:
+				refreshed = true
 			}
 		}
 	}
@@ -166,37 +205,18 @@ outer:
 	return nil
 }
 
-func (gf *generationFetcher) tryFetchGenerations() {
-	// Decide on the consistency to use
-	size, err := gf.getClusterSize()
-	if err != nil {
-		gf.logger.Printf("an error occurred while determining cluster size: %s", err)
-		return
-	}
-
-	consistency := gocql.One
-	if size >= 2 {
-		consistency = gocql.Quorum
-	}
-
-	// Try switching to a new format before fetching any generations
-	newSource, err := gf.source.maybeUpgrade()
-	if err != nil {
-		gf.logger.Printf("an error occurred while trying to switch to new generations format: %s", err)
-	} else {
-		gf.source = newSource
-	}
-
+// Returns true if any generation was pushed.
+func (gf *generationFetcher) tryFetchGenerations(ctx context.Context) (pushed bool) {
 	// Fetch some generation times
-	times, err := gf.source.getGenerationTimes(consistency)
+	times, err := gf.dataSource.GetGenerationTimes(ctx)
 	if err != nil {
 		gf.logger.Printf("an error occured while fetching generation times: %s", err)
-		return
+		return false
 	}
 	sort.Sort(timeList(times))
 
 	fetchAndPush := func(t time.Time) (shouldBreak bool) {
-		streams, err := gf.source.getGeneration(t, consistency)
+		streams, err := gf.dataSource.GetGenerationStreams(ctx, t)
 		if err != nil {
 			gf.logger.Printf("an error occured while fetching generation streams for %s: %s", t, err)
 			return true
@@ -205,6 +225,7 @@ func (gf *generationFetcher) tryFetchGenerations() {
 		if shouldStop := gf.pushGeneration(gen); shouldStop {
 			return true
 		}
+		pushed = true
 		return false
 	}
 
@@ -234,11 +255,11 @@ func (gf *generationFetcher) tryFetchGenerations() {
 		if gf.lastTime.Before(t) {
 
 			if shouldBreak := maybePushFirst(); shouldBreak {
-				return
+				return pushed
 			}
 
 			if shouldBreak := fetchAndPush(t); shouldBreak {
-				return
+				return pushed
 			}
 			gf.lastTime = t
 		}
@@ -246,6 +267,7 @@ func (gf *generationFetcher) tryFetchGenerations() {
 	}
 
 	_ = maybePushFirst()
+	return pushed
 }
 
 func (gf *generationFetcher) Get(ctx context.Context) (*generation, error) {
@@ -279,17 +301,6 @@ func (gf *generationFetcher) pushGeneration(gen *generation) (shouldStop bool) {
 	}
 }
 
-// Unfortunately, gocql does not expose information about the cluster,
-// therefore we need to poll system.peers manually
-func (gf *generationFetcher) getClusterSize() (int, error) {
-	var size int
-	err := gf.session.Query("SELECT COUNT(*) FROM system.peers").Scan(&size)
-	if err != nil {
-		return 0, err
-	}
-	return size + 1, nil
-}
-
 type generationSource interface {
 	getGeneration(genTime time.Time, consistency gocql.Consistency) ([]StreamID, error)
 	getGenerationTimes(consistency gocql.Consistency) ([]time.Time, error)
@@ -412,6 +423,101 @@ func (gs *generationSourceSince4_4) maybeUpgrade() (generationSource, error) {
 	return gs, nil
 }
 
+// Reads generations of a single table of a tablet-based keyspace. Unlike
+// cluster-wide generations, they change when tablets of the table are split
+// or merged.
+type generationSourceTablets struct {
+	session      *gocql.Session
+	keyspaceName string
+	tableName    string
+}
+
+func (gs *generationSourceTablets) getGeneration(genTime time.Time, consistency gocql.Consistency) ([]StreamID, error) {
+	var streams []StreamID
+	iter := gs.session.Query(
+		"SELECT stream_id FROM "+tabletStreamsTable+
+			" WHERE keyspace_name = ? AND table_name = ? AND timestamp = ? AND stream_state = ?",
+		gs.keyspaceName, gs.tableName, genTime, tabletStreamStateCurrent,
+	).Consistency(consistency).Iter()
+
+	var stream StreamID
+	for iter.Scan(&stream) {
+		streams = append(streams, stream)
+		stream = nil
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return streams, nil
+}
+
+func (gs *generationSourceTablets) getGenerationTimes(consistency gocql.Consistency) ([]time.Time, error) {
+	iter := gs.session.Query(
+		"SELECT timestamp FROM "+tabletTimestampsTable+" WHERE keyspace_name = ? AND table_name = ?",
+		gs.keyspaceName, gs.tableName,
+	).Consistency(consistency).Iter()
+	var (
+		times    []time.Time
+		currTime time.Time
+	)
+	for iter.Scan(&currTime) {
+		times = append(times, currTime)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return times, nil
+}
+
+func (gs *generationSourceTablets) maybeUpgrade() (generationSource, error) {
+	// No newer format is known
+	return gs, nil
+}
+
+// Used if the cluster has no cluster-wide generations.
+type noGenerationSource struct{}
+
+func (noGenerationSource) getGeneration(genTime time.Time, consistency gocql.Consistency) ([]StreamID, error) {
+	return nil, fmt.Errorf("no generation with timestamp %s", genTime)
+}
+
+func (noGenerationSource) getGenerationTimes(consistency gocql.Consistency) ([]time.Time, error) {
+	return nil, nil
+}
+
+func (gs noGenerationSource) maybeUpgrade() (generationSource, error) {
+	return gs, nil
+}
+
+// Returns true if the keyspace uses tablets. Keyspaces of clusters
+// which don't support tablets use vnodes.
+func isTabletKeyspace(ctx context.Context, session *gocql.Session, keyspaceName string) (bool, error) {
+	meta, err := session.KeyspaceMetadata("system_schema")
+	if err != nil {
+		return false, err
+	}
+	tmeta, ok := meta.Tables["scylla_keyspaces"]
+	if !ok {
+		return false, nil
+	}
+	if _, ok := tmeta.Columns["initial_tablets"]; !ok {
+		return false, nil
+	}
+
+	var initialTablets *int
+	err = session.Query(
+		"SELECT initial_tablets FROM "+scyllaKeyspacesTable+" WHERE keyspace_name = ?",
+		keyspaceName,
+	).WithContext(ctx).Scan(&initialTablets)
+	if err == gocql.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return initialTablets != nil, nil
+}
+
 // Takes a fully-qualified name of a table and returns if a table of given name
 // is in the schema.
 // Panics if the table name is not qualified, i.e. it does not contain a dot.
@@ -0,0 +1,50 @@
+package scyllacdc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGenerationFetcherRefresh(t *testing.T) {
+	now := time.Now()
+	gen1 := now.Add(-time.Hour)
+	gen2 := now.Add(time.Minute)
+
+	ds := NewInMemoryDataSource()
+	ds.AddGeneration(gen1, []StreamID{{0x01}})
+
+	// The period is long enough so that the fetcher won't notice
+	// the second generation unless a refresh is triggered
+	gf := newGenerationFetcher(ds, now, time.Hour, noLogger{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	errC := make(chan error, 1)
+	go func() { errC <- gf.Run(ctx) }()
+
+	gen, err := gf.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gen.startTime.Equal(gen1) {
+		t.Fatalf("expected generation %v, got %v", gen1, gen.startTime)
+	}
+
+	ds.AddGeneration(gen2, []StreamID{{0x02}})
+	gf.TriggerRefresh()
+
+	gen, err = gf.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gen.startTime.Equal(gen2) {
+		t.Fatalf("expected generation %v, got %v", gen2, gen.startTime)
+	}
+
+	gf.Stop()
+	if err := <-errC; err != nil {
+		t.Fatal(err)
+	}
+}
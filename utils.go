@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"io"
 	"regexp"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -167,11 +166,12 @@ func escapeColumnName(s string) string {
 	return "\"" + strings.ReplaceAll(s, "\"", "\\\"") + "\""
 }
 
-func fetchScyllaCDCExtensionTTL(
+func fetchScyllaCDCExtension(
+	ctx context.Context,
 	session *gocql.Session,
 	keyspaceName string,
 	tableName string,
-) (int64, error) {
+) (map[string]string, error) {
 	// Extensions are not available in the metadata,
 	// fetch and parse them manually until this is implemented in gocql
 	var exts map[string][]byte
@@ -179,31 +179,21 @@ func fetchScyllaCDCExtensionTTL(
 		"SELECT extensions FROM system_schema.tables "+
 			"WHERE keyspace_name = ? AND table_name = ?",
 		keyspaceName, tableName,
-	).Scan(&exts)
+	).WithContext(ctx).Scan(&exts)
 	if err != nil {
-		return 0, fmt.Errorf("failed to query system tables: %w", err)
+		return nil, fmt.Errorf("failed to query system tables: %w", err)
 	}
 
 	ext, ok := exts["cdc"]
 	if !ok {
-		return 0, errors.New("cdc extension not found")
+		return nil, errors.New("cdc extension not found")
 	}
 
 	m, err := newExtensionParser(ext).parseStringMap()
 	if err != nil {
-		return 0, fmt.Errorf("failed to parse the CDC extension: %w", err)
+		return nil, fmt.Errorf("failed to parse the CDC extension: %w", err)
 	}
-
-	ttlS, ok := m["ttl"]
-	if !ok {
-		return 0, errors.New("ttl not set")
-	}
-
-	ttl, err := strconv.ParseInt(ttlS, 10, 64)
-	if err != nil {
-		return 0, fmt.Errorf("failed to parse TTL from schema extension: %w", err)
-	}
-	return ttl, nil
+	return m, nil
 }
 
 type extensionParser struct {